@@ -0,0 +1,620 @@
+package aggregate
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	google_datastore "cloud.google.com/go/datastore"
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	// AccountVersion is bumped whenever the way account aggregates are computed changes, so that stored aggregates get
+	// rebuilt from the player entities the next time they are read.
+	AccountVersion = 3
+
+	// accountShards is how many shards the reports of an account are spread over. Reading an account reads all of them,
+	// while reports of the same account only contend if they land in the same shard.
+	accountShards = 8
+)
+
+// LoadAccount reads the precomputed aggregate of an account and merges its shards, rebuilding it from the account's
+// players if it is missing or outdated.
+func LoadAccount(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	accountName string,
+) (datastore.Account, error) {
+	accountKey := datastore.AccountKey(accountName)
+	account, current, err := getAccount(func(key *google_datastore.Key, dst interface{}) error {
+		return datastoreClient.Get(ctx, key, dst)
+	}, accountKey)
+	if err != nil {
+		return account, err
+	}
+	if !current {
+		return RebuildAccount(ctx, datastoreClient, accountName)
+	}
+
+	shards, err := getAccountShards(ctx, datastoreClient, accountKey)
+	if err != nil {
+		return account, err
+	}
+	mergeAccountShards(&account, shards)
+	return account, nil
+}
+
+// RebuildAccount recomputes the aggregate of an account from all of its players and stores it. If the account keeps
+// changing while its players are queried, the rebuilt aggregate is returned without storing it.
+func RebuildAccount(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	accountName string,
+) (datastore.Account, error) {
+	accountKey := datastore.AccountKey(accountName)
+	var account datastore.Account
+	var shards []datastore.AccountShard
+	build := func() (interface{}, bool, error) {
+		players, err := QueryAccountPlayers(ctx, datastoreClient, accountName)
+		if err != nil {
+			return nil, false, err
+		}
+		account, shards = BuildAccount(players)
+		account.UpdateTime = time.Now()
+		return &account, len(account.Characters) > 0, nil
+	}
+	writeChildren := func(store bool) error {
+		keys := []*google_datastore.Key{}
+		children := []interface{}{}
+		if store {
+			for i := range shards {
+				keys = append(keys, datastore.AccountShardKey(accountKey, i))
+				children = append(children, &shards[i])
+			}
+		}
+		return replaceChildren(ctx, datastoreClient, accountKey, "account_shard", keys, children)
+	}
+
+	stored, err := rebuild(ctx, datastoreClient, accountKey, build, writeChildren)
+	if err != nil {
+		return account, fmt.Errorf("failed to rebuild account %v: %v", accountName, err)
+	}
+	if !stored {
+		log.Printf("Account %v kept changing while rebuilding its aggregate, not storing it.\n", accountName)
+	}
+	return account, nil
+}
+
+// UpdateAccount applies an incremental update to the aggregate of an account as part of a transaction. The update
+// returns whether it changed the account entity itself, which is only written if it did, so that reports of the same
+// account only contend on its shards. Aggregates that are missing or outdated are not updated since they will be
+// rebuilt anyway, but their update time is still bumped so that rebuilds running concurrently notice the change.
+func UpdateAccount(
+	tx *google_datastore.Transaction,
+	accountName string,
+	update func(tx *google_datastore.Transaction, accountKey *google_datastore.Key, account *datastore.Account) (bool, error),
+) error {
+	accountKey := datastore.AccountKey(accountName)
+	account, current, err := getAccount(tx.Get, accountKey)
+	if err != nil {
+		return err
+	}
+
+	changed := true
+	if current {
+		changed, err = update(tx, accountKey, &account)
+		if err != nil {
+			return err
+		}
+	}
+	if !changed {
+		return nil
+	}
+	account.UpdateTime = time.Now()
+
+	_, err = tx.Put(accountKey, &account)
+	if err != nil {
+		return fmt.Errorf("datastore write account %v failed: %v", accountName, err)
+	}
+	return nil
+}
+
+// InvalidateAccount marks the aggregate of an account as outdated, for changes that can't be applied incrementally
+// such as characters being claimed or unclaimed.
+func InvalidateAccount(
+	tx *google_datastore.Transaction,
+	accountKey *google_datastore.Key,
+	account *datastore.Account,
+) (bool, error) {
+	account.Version = 0
+	return true, nil
+}
+
+// BuildAccount computes the aggregate of an account from all of its players, together with the shards its counts are
+// stored in. Reports are spread over the shards like incremental updates spread them, so that moving a report between
+// guilds later updates the shard that counted it. Coraiders are only counted per player, so they all go into the first
+// shard.
+func BuildAccount(players map[int64]datastore.Player) (datastore.Account, []datastore.AccountShard) {
+	account := datastore.Account{
+		Characters:       []datastore.AccountCharacter{},
+		CoraiderAccounts: []datastore.PlayerCoraiderAccount{},
+		Version:          AccountVersion,
+	}
+	shards := make([]datastore.AccountShard, accountShards)
+
+	for playerId, player := range players {
+		account.Characters = append(account.Characters, datastore.AccountCharacter{
+			PlayerId: playerId,
+			Name:     player.Name,
+			Class:    player.Class,
+			Server:   player.Server,
+		})
+
+		for _, playerReport := range player.Reports {
+			shard := &shards[reportShard(playerReport.Code, accountShards)]
+			if playerReport.GuildId != 0 {
+				addAccountGuild(&shard.Guilds, playerReport.GuildId, playerReport.GuildName, 1)
+			}
+
+			if !playerReport.Duplicate {
+				addAccountCharacterRaids(shard, playerId, 1)
+				addAccountRole(&shard.RoleCounts, accountRaid(playerId, player.Class, playerReport))
+			}
+		}
+
+		for _, playerCoraider := range player.Coraiders {
+			// Skip our own characters
+			if _, ok := players[playerCoraider.Id]; ok {
+				continue
+			}
+			addAccountCoraider(&shards[0], datastore.AccountCoraider{
+				Id:     playerCoraider.Id,
+				Name:   playerCoraider.Name,
+				Class:  playerCoraider.Class,
+				Server: playerCoraider.Server,
+				Count:  playerCoraider.Count,
+			})
+		}
+
+		for _, playerCoraiderAccount := range player.CoraiderAccounts {
+			SetAccountCoraiderAccount(&account, playerCoraiderAccount.PlayerId, playerCoraiderAccount.Name)
+		}
+	}
+
+	mergeAccountShards(&account, shards)
+	return account, shards
+}
+
+// AddAccountPlayerReport counts a report that was newly added to one of the account's players in the shard of the
+// report as part of the transaction, and returns whether the account entity itself changed. The other shards are read
+// outside of the transaction, so that the account is filled in with counts over all shards without contending on
+// them. It returns the coraiders it counted with those counts.
+func AddAccountPlayerReport(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	tx *google_datastore.Transaction,
+	accountKey *google_datastore.Key,
+	account *datastore.Account,
+	playerId int64,
+	player datastore.Player,
+	playerReport datastore.PlayerReport,
+	report datastore.Report,
+) ([]datastore.AccountCoraider, bool, error) {
+	changed := false
+	characters := map[int64]struct{}{}
+	for _, character := range account.Characters {
+		characters[character.PlayerId] = struct{}{}
+	}
+	if _, ok := characters[playerId]; !ok {
+		changed = true
+		characters[playerId] = struct{}{}
+		account.Characters = append(account.Characters, datastore.AccountCharacter{
+			PlayerId: playerId,
+			Name:     player.Name,
+			Class:    player.Class,
+			Server:   player.Server,
+		})
+	}
+
+	shardIndex := reportShard(playerReport.Code, accountShards)
+	shardKey := datastore.AccountShardKey(accountKey, shardIndex)
+	var shard datastore.AccountShard
+	err := tx.Get(shardKey, &shard)
+	if err != nil && err != google_datastore.ErrNoSuchEntity {
+		return nil, false, fmt.Errorf("datastore get shard of account %v failed: %v", accountKey.Name, err)
+	}
+
+	if playerReport.GuildId != 0 {
+		addAccountGuild(&shard.Guilds, playerReport.GuildId, playerReport.GuildName, 1)
+	}
+
+	counted := map[int64]struct{}{}
+	if !playerReport.Duplicate {
+		addAccountCharacterRaids(&shard, playerId, 1)
+		addAccountRole(&shard.RoleCounts, accountRaid(playerId, player.Class, playerReport))
+
+		for _, reportPlayer := range report.Players {
+			if _, ok := counted[reportPlayer.Id]; ok {
+				continue
+			}
+			// Skip our own characters
+			if _, ok := characters[reportPlayer.Id]; ok {
+				continue
+			}
+			counted[reportPlayer.Id] = struct{}{}
+
+			addAccountCoraider(&shard, datastore.AccountCoraider{
+				Id:     reportPlayer.Id,
+				Name:   reportPlayer.Name,
+				Class:  reportPlayer.Class,
+				Server: reportPlayer.Server,
+				Count:  1,
+			})
+		}
+	}
+
+	_, err = tx.Put(shardKey, &shard)
+	if err != nil {
+		return nil, false, fmt.Errorf("datastore write shard of account %v failed: %v", accountKey.Name, err)
+	}
+	if len(counted) == 0 {
+		return nil, changed, nil
+	}
+
+	// Transactions don't read their own writes, so the shard just written takes the place of the stored one.
+	shards, err := getAccountShards(ctx, datastoreClient, accountKey)
+	if err != nil {
+		return nil, false, err
+	}
+	shards[shardIndex] = shard
+	mergeAccountShards(account, shards)
+
+	coraiders := []datastore.AccountCoraider{}
+	for _, coraider := range account.Coraiders {
+		if _, ok := counted[coraider.Id]; ok {
+			coraiders = append(coraiders, coraider)
+		}
+	}
+	return coraiders, changed, nil
+}
+
+// UpdateAccountReportGuild moves a report of one of the account's players that got its guild filled in or changed, in
+// the shard of the report as part of a transaction.
+func UpdateAccountReportGuild(
+	tx *google_datastore.Transaction,
+	accountKey *google_datastore.Key,
+	oldGuildId int32,
+	playerReport datastore.PlayerReport,
+) error {
+	if oldGuildId == 0 && playerReport.GuildId == 0 {
+		return nil
+	}
+
+	shardKey := datastore.AccountShardKey(accountKey, reportShard(playerReport.Code, accountShards))
+	var shard datastore.AccountShard
+	err := tx.Get(shardKey, &shard)
+	if err != nil && err != google_datastore.ErrNoSuchEntity {
+		return fmt.Errorf("datastore get shard of account %v failed: %v", accountKey.Name, err)
+	}
+
+	if oldGuildId == playerReport.GuildId {
+		addAccountGuild(&shard.Guilds, playerReport.GuildId, playerReport.GuildName, 0)
+	} else {
+		if oldGuildId != 0 {
+			addAccountGuild(&shard.Guilds, oldGuildId, "", -1)
+		}
+		if playerReport.GuildId != 0 {
+			addAccountGuild(&shard.Guilds, playerReport.GuildId, playerReport.GuildName, 1)
+		}
+	}
+
+	_, err = tx.Put(shardKey, &shard)
+	if err != nil {
+		return fmt.Errorf("datastore write shard of account %v failed: %v", accountKey.Name, err)
+	}
+	return nil
+}
+
+// SetAccountCoraiderAccount records the account name that a coraider of the account is claimed by, and returns whether
+// it changed.
+func SetAccountCoraiderAccount(account *datastore.Account, playerId int64, accountName string) bool {
+	for i := range account.CoraiderAccounts {
+		if account.CoraiderAccounts[i].PlayerId != playerId {
+			continue
+		}
+		if account.CoraiderAccounts[i].Name == accountName {
+			return false
+		}
+		account.CoraiderAccounts[i].Name = accountName
+		return true
+	}
+
+	account.CoraiderAccounts = append(account.CoraiderAccounts, datastore.PlayerCoraiderAccount{
+		PlayerId: playerId,
+		Name:     accountName,
+	})
+	return true
+}
+
+// SumAccountCoraiderAccount counts the raids of an account with all characters claimed by another account, from the
+// coraiders of an account filled in by LoadAccount or AddAccountPlayerReport.
+func SumAccountCoraiderAccount(account datastore.Account, coraiderAccount string) int64 {
+	sum := int64(0)
+	for _, coraider := range account.Coraiders {
+		if coraider.Account == coraiderAccount {
+			sum += coraider.Count
+		}
+	}
+	return sum
+}
+
+// QueryAccountRaids reads the non-duplicate raids of an account's characters that started at or after a point in
+// time, from the reports of the characters rather than the aggregate.
+func QueryAccountRaids(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	account datastore.Account,
+	since time.Time,
+) ([]datastore.AccountRaid, error) {
+	raids := []datastore.AccountRaid{}
+	for _, character := range account.Characters {
+		playerKey := google_datastore.IDKey("player", character.PlayerId, nil)
+		var player datastore.Player
+		err := datastoreClient.Get(ctx, playerKey, &player)
+		if err == google_datastore.ErrNoSuchEntity {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("datastore get player %v failed: %v", character.PlayerId, err)
+		}
+
+		playerReports, err := datastore.LoadPlayerReportsSince(ctx, datastoreClient, playerKey, player, since)
+		if err != nil {
+			return nil, err
+		}
+		for _, playerReport := range playerReports {
+			if !playerReport.Duplicate {
+				raids = append(raids, accountRaid(character.PlayerId, player.Class, playerReport))
+			}
+		}
+	}
+	return raids, nil
+}
+
+// CountRaidRoles counts the roles and specs of some raids in the same form as the counters of an account.
+func CountRaidRoles(raids []datastore.AccountRaid) []datastore.AccountRoleCount {
+	roleCounts := []datastore.AccountRoleCount{}
+	for _, raid := range raids {
+		addAccountRole(&roleCounts, raid)
+	}
+	return roleCounts
+}
+
+// PlayerRaids lists the non-duplicate raids of a single player in the same form as the raids of an account.
+func PlayerRaids(playerId int64, player datastore.Player) []datastore.AccountRaid {
+	raids := []datastore.AccountRaid{}
+	for _, playerReport := range player.Reports {
+		if !playerReport.Duplicate {
+			raids = append(raids, accountRaid(playerId, player.Class, playerReport))
+		}
+	}
+	return raids
+}
+
+// QueryAccountPlayers fetches all player entities claimed by the given account name, including their history.
+func QueryAccountPlayers(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	accountName string,
+) (map[int64]datastore.Player, error) {
+	players := map[int64]datastore.Player{}
+	query := google_datastore.NewQuery("player").FilterField("Account", "=", accountName)
+	responseIter := datastoreClient.Run(ctx, query)
+	for {
+		var player datastore.Player
+		key, err := responseIter.Next(&player)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("datastore query failed: %v", err)
+		}
+		players[key.ID] = player
+	}
+
+	err := datastore.LoadPlayersHistory(ctx, datastoreClient, players)
+	if err != nil {
+		return nil, err
+	}
+	return players, nil
+}
+
+func accountRaid(playerId int64, class string, playerReport datastore.PlayerReport) datastore.AccountRaid {
+	spec := playerReport.Spec
+	if spec == "" {
+		// Tanks don't have a spec in the report player details.
+		spec = class + "-" + playerReport.Role
+	}
+	return datastore.AccountRaid{
+		Code:      playerReport.Code,
+		PlayerId:  playerId,
+		StartTime: playerReport.StartTime,
+		Role:      playerReport.Role,
+		Spec:      spec,
+	}
+}
+
+// addAccountGuild adds delta raids to a guild in the counts of a shard, dropping guilds that no raids are left in.
+func addAccountGuild(guilds *[]datastore.AccountGuild, guildId int32, guildName string, delta int64) {
+	for i := range *guilds {
+		guild := &(*guilds)[i]
+		if guild.GuildId != guildId {
+			continue
+		}
+
+		guild.Count += delta
+		if guildName != "" {
+			guild.GuildName = guildName
+		}
+		if guild.Count == 0 {
+			*guilds = append((*guilds)[:i], (*guilds)[i+1:]...)
+		}
+		return
+	}
+
+	if delta != 0 {
+		*guilds = append(*guilds, datastore.AccountGuild{
+			GuildId:   guildId,
+			GuildName: guildName,
+			Count:     delta,
+		})
+	}
+}
+
+// addAccountRole counts a raid towards the role and spec it was played with.
+func addAccountRole(roleCounts *[]datastore.AccountRoleCount, raid datastore.AccountRaid) {
+	for i := range *roleCounts {
+		roleCount := &(*roleCounts)[i]
+		if roleCount.Role == raid.Role && roleCount.Spec == raid.Spec {
+			roleCount.Count++
+			return
+		}
+	}
+	*roleCounts = append(*roleCounts, datastore.AccountRoleCount{
+		Role:  raid.Role,
+		Spec:  raid.Spec,
+		Count: 1,
+	})
+}
+
+// addAccountCharacterRaids adds raids of one of the account's characters to a shard.
+func addAccountCharacterRaids(shard *datastore.AccountShard, playerId int64, numRaids int64) {
+	for i := range shard.Characters {
+		if shard.Characters[i].PlayerId == playerId {
+			shard.Characters[i].NumRaids += numRaids
+			return
+		}
+	}
+	shard.Characters = append(shard.Characters, datastore.AccountCharacterRaids{
+		PlayerId: playerId,
+		NumRaids: numRaids,
+	})
+}
+
+// addAccountCoraider adds the raids with a coraider to a shard, keeping the coraider's latest name.
+func addAccountCoraider(shard *datastore.AccountShard, coraider datastore.AccountCoraider) {
+	for i := range shard.Coraiders {
+		if shard.Coraiders[i].Id != coraider.Id {
+			continue
+		}
+		shard.Coraiders[i].Name = coraider.Name
+		shard.Coraiders[i].Class = coraider.Class
+		shard.Coraiders[i].Server = coraider.Server
+		shard.Coraiders[i].Count += coraider.Count
+		return
+	}
+	shard.Coraiders = append(shard.Coraiders, coraider)
+}
+
+// mergeAccountShards fills in the raids of the characters, the guilds, role counts and coraiders of an account from its
+// shards, together with the accounts its coraiders are claimed by.
+func mergeAccountShards(account *datastore.Account, shards []datastore.AccountShard) {
+	characters := map[int64]int{}
+	for i := range account.Characters {
+		account.Characters[i].NumRaids = 0
+		characters[account.Characters[i].PlayerId] = i
+	}
+	coraiderAccounts := map[int64]string{}
+	for _, coraiderAccount := range account.CoraiderAccounts {
+		coraiderAccounts[coraiderAccount.PlayerId] = coraiderAccount.Name
+	}
+
+	guilds := []datastore.AccountGuild{}
+	roleCounts := []datastore.AccountRoleCount{}
+	account.Coraiders = []datastore.AccountCoraider{}
+	coraiders := map[int64]int{}
+	for _, shard := range shards {
+		for _, character := range shard.Characters {
+			if i, ok := characters[character.PlayerId]; ok {
+				account.Characters[i].NumRaids += character.NumRaids
+			}
+		}
+		for _, guild := range shard.Guilds {
+			addAccountGuild(&guilds, guild.GuildId, guild.GuildName, guild.Count)
+		}
+		for _, roleCount := range shard.RoleCounts {
+			found := false
+			for i := range roleCounts {
+				if roleCounts[i].Role == roleCount.Role && roleCounts[i].Spec == roleCount.Spec {
+					roleCounts[i].Count += roleCount.Count
+					found = true
+					break
+				}
+			}
+			if !found {
+				roleCounts = append(roleCounts, roleCount)
+			}
+		}
+		for _, coraider := range shard.Coraiders {
+			if i, ok := coraiders[coraider.Id]; ok {
+				account.Coraiders[i].Count += coraider.Count
+				continue
+			}
+			coraiders[coraider.Id] = len(account.Coraiders)
+			coraider.Account = coraiderAccounts[coraider.Id]
+			account.Coraiders = append(account.Coraiders, coraider)
+		}
+	}
+
+	account.Guilds = []datastore.AccountGuild{}
+	for _, guild := range guilds {
+		if guild.Count > 0 {
+			account.Guilds = append(account.Guilds, guild)
+		}
+	}
+	account.RoleCounts = roleCounts
+}
+
+// getAccountShards reads all shards of an account outside of a transaction, leaving the ones that don't exist yet
+// empty.
+func getAccountShards(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	accountKey *google_datastore.Key,
+) ([]datastore.AccountShard, error) {
+	keys := []*google_datastore.Key{}
+	for shard := 0; shard < accountShards; shard++ {
+		keys = append(keys, datastore.AccountShardKey(accountKey, shard))
+	}
+	shards := make([]datastore.AccountShard, len(keys))
+	err := datastoreClient.GetMulti(ctx, keys, shards)
+	if multiErr, ok := err.(google_datastore.MultiError); ok {
+		for _, keyErr := range multiErr {
+			if keyErr != nil && keyErr != google_datastore.ErrNoSuchEntity {
+				return nil, fmt.Errorf("datastore get shards of account %v failed: %v", accountKey.Name, keyErr)
+			}
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("datastore get shards of account %v failed: %v", accountKey.Name, err)
+	}
+	return shards, nil
+}
+
+// getAccount reads the aggregate of an account and returns whether it is up to date. Aggregates stored by older
+// versions may have properties that don't exist anymore, which only makes them outdated.
+func getAccount(
+	get func(key *google_datastore.Key, dst interface{}) error,
+	accountKey *google_datastore.Key,
+) (datastore.Account, bool, error) {
+	var account datastore.Account
+	err := get(accountKey, &account)
+	if err == google_datastore.ErrNoSuchEntity {
+		return account, false, nil
+	}
+	if _, ok := err.(*google_datastore.ErrFieldMismatch); err != nil && !ok {
+		return account, false, fmt.Errorf("datastore get account %v failed: %v", accountKey.Name, err)
+	}
+	return account, err == nil && account.Version == AccountVersion, nil
+}
@@ -0,0 +1,436 @@
+package aggregate
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	google_datastore "cloud.google.com/go/datastore"
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	// GuildAggregateVersion is bumped whenever the way guild aggregates are computed changes, so that stored
+	// aggregates get rebuilt from the report entities the next time they are read.
+	GuildAggregateVersion = 3
+
+	// guildAggregateShards is how many shards the reports of a guild are spread over. Reading an aggregate reads all of
+	// them, while reports of the same guild only contend if they land in the same shard.
+	guildAggregateShards = 8
+	// maxGuildAggregateRaids bounds how many of the most recent raids of a guild are kept, per shard and in total.
+	maxGuildAggregateRaids = 100
+)
+
+// LoadGuildAggregate reads the precomputed aggregate of a guild and merges its shards, rebuilding it from the guild's
+// reports if it is missing or outdated. Only the most recent raids are filled in, while NumRaids counts all of them.
+func LoadGuildAggregate(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	guildId int32,
+) (datastore.GuildAggregate, error) {
+	guildAggregateKey := datastore.GuildAggregateKey(guildId)
+	guildAggregate, current, err := getGuildAggregate(func(key *google_datastore.Key, dst interface{}) error {
+		return datastoreClient.Get(ctx, key, dst)
+	}, guildAggregateKey)
+	if err != nil {
+		return guildAggregate, err
+	}
+	if !current {
+		return RebuildGuildAggregate(ctx, datastoreClient, guildId)
+	}
+
+	keys := []*google_datastore.Key{}
+	for shard := 0; shard < guildAggregateShards; shard++ {
+		keys = append(keys, datastore.GuildAggregateShardKey(guildAggregateKey, shard))
+	}
+	shards := make([]datastore.GuildAggregateShard, len(keys))
+	err = datastoreClient.GetMulti(ctx, keys, shards)
+	if multiErr, ok := err.(google_datastore.MultiError); ok {
+		for _, keyErr := range multiErr {
+			if keyErr != nil && keyErr != google_datastore.ErrNoSuchEntity {
+				return guildAggregate, fmt.Errorf("datastore get shards of guild aggregate %v failed: %v", guildId, keyErr)
+			}
+		}
+	} else if err != nil {
+		return guildAggregate, fmt.Errorf("datastore get shards of guild aggregate %v failed: %v", guildId, err)
+	}
+	mergeGuildShards(&guildAggregate, shards)
+	return guildAggregate, nil
+}
+
+// RebuildGuildAggregate recomputes the aggregate of a guild from all of its reports and stores it. If the guild keeps
+// changing while its reports are queried, the rebuilt aggregate is returned without storing it.
+func RebuildGuildAggregate(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	guildId int32,
+) (datastore.GuildAggregate, error) {
+	guildAggregateKey := datastore.GuildAggregateKey(guildId)
+	var guildAggregate datastore.GuildAggregate
+	var shards []datastore.GuildAggregateShard
+	build := func() (interface{}, bool, error) {
+		guildAggregate = datastore.GuildAggregate{
+			Version: GuildAggregateVersion,
+		}
+		shards = make([]datastore.GuildAggregateShard, guildAggregateShards)
+		query := google_datastore.NewQuery("report").FilterField("GuildId", "=", guildId)
+		responseIter := datastoreClient.Run(ctx, query)
+		for {
+			var report datastore.Report
+			key, err := responseIter.Next(&report)
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				return nil, false, fmt.Errorf("datastore report query failed: %v", err)
+			}
+			addGuildRaid(&shards[reportShard(key.Name, guildAggregateShards)], key.Name, report)
+		}
+		mergeGuildShards(&guildAggregate, shards)
+		guildAggregate.UpdateTime = time.Now()
+		return &guildAggregate, guildAggregate.NumRaids > 0, nil
+	}
+	writeChildren := func(store bool) error {
+		keys := []*google_datastore.Key{}
+		children := []interface{}{}
+		if store {
+			for i := range shards {
+				keys = append(keys, datastore.GuildAggregateShardKey(guildAggregateKey, i))
+				children = append(children, &shards[i])
+			}
+		}
+		return replaceChildren(ctx, datastoreClient, guildAggregateKey, "guild_aggregate_shard", keys, children)
+	}
+
+	stored, err := rebuild(ctx, datastoreClient, guildAggregateKey, build, writeChildren)
+	if err != nil {
+		return guildAggregate, fmt.Errorf("failed to rebuild guild aggregate %v: %v", guildId, err)
+	}
+	if !stored {
+		log.Printf("Guild %v kept changing while rebuilding its aggregate, not storing it.\n", guildId)
+	}
+	return guildAggregate, nil
+}
+
+// AddGuildReport counts a report in the aggregate of its guild as part of a transaction. Reports must only be added
+// once, and removed with the same version of the report that was added.
+func AddGuildReport(tx *google_datastore.Transaction, guildId int32, code string, report datastore.Report) error {
+	return updateGuildReportShard(tx, guildId, code, func(shard *datastore.GuildAggregateShard) bool {
+		addGuildRaid(shard, code, report)
+		return true
+	})
+}
+
+// RemoveGuildReport takes a report that was added before back out of the aggregate of a guild as part of a
+// transaction. The first raid of its raiders isn't moved, since that would need their other raids.
+func RemoveGuildReport(tx *google_datastore.Transaction, guildId int32, code string, report datastore.Report) error {
+	return updateGuildReportShard(tx, guildId, code, func(shard *datastore.GuildAggregateShard) bool {
+		removeGuildRaid(shard, code, report)
+		return true
+	})
+}
+
+// ClaimGuildReportPlayer moves the raids of a character in the shard of a report over to the account that claimed the
+// character, as part of a transaction. Claims are broadcast to every report of the character, so every shard the
+// character raided in gets its own claim.
+func ClaimGuildReportPlayer(
+	tx *google_datastore.Transaction,
+	guildId int32,
+	code string,
+	playerId int64,
+	accountName string,
+) error {
+	return updateGuildReportShard(tx, guildId, code, func(shard *datastore.GuildAggregateShard) bool {
+		for i := range shard.Raiders {
+			if shard.Raiders[i].PlayerId == playerId {
+				return setGuildRaiderAccount(shard, &shard.Raiders[i], accountName)
+			}
+		}
+		return false
+	})
+}
+
+// updateGuildReportShard applies a change to the shard of a report as part of a transaction, and writes the shard if
+// update returns that it changed. Shards of missing or outdated aggregates are left alone, since they will be rebuilt
+// anyway.
+func updateGuildReportShard(
+	tx *google_datastore.Transaction,
+	guildId int32,
+	code string,
+	update func(shard *datastore.GuildAggregateShard) bool,
+) error {
+	guildAggregateKey, current, err := touchGuildAggregate(tx, guildId)
+	if err != nil || !current {
+		return err
+	}
+
+	shardKey := datastore.GuildAggregateShardKey(guildAggregateKey, reportShard(code, guildAggregateShards))
+	var shard datastore.GuildAggregateShard
+	err = tx.Get(shardKey, &shard)
+	if err != nil && err != google_datastore.ErrNoSuchEntity {
+		return fmt.Errorf("datastore get shard of guild aggregate %v failed: %v", guildId, err)
+	}
+	if !update(&shard) {
+		return nil
+	}
+
+	_, err = tx.Put(shardKey, &shard)
+	if err != nil {
+		return fmt.Errorf("datastore write shard of guild aggregate %v failed: %v", guildId, err)
+	}
+	return nil
+}
+
+// addGuildRaid counts a report in a shard of its guild's aggregate.
+func addGuildRaid(shard *datastore.GuildAggregateShard, code string, report datastore.Report) {
+	playerAccounts := map[int64]string{}
+	for _, playerAccount := range report.PlayerAccounts {
+		playerAccounts[playerAccount.PlayerId] = playerAccount.Name
+	}
+
+	raid := datastore.GuildAggregateRaid{
+		Code:       code,
+		StartTime:  report.StartTime,
+		EndTime:    report.EndTime,
+		Title:      report.Title,
+		Zone:       report.Zone,
+		GuildName:  report.GuildName,
+		NumPlayers: int64(len(report.Players)),
+		RaiderIds:  []int64{},
+	}
+	raiders := guildRaiderIndices(shard)
+	for _, player := range uniqueReportPlayers(report) {
+		switch player.Role {
+		case "tank":
+			raid.NumTanks++
+		case "healer":
+			raid.NumHealers++
+		case "dps":
+			raid.NumDps++
+		}
+		raid.RaiderIds = append(raid.RaiderIds, player.Id)
+
+		i, ok := raiders[player.Id]
+		if !ok {
+			i = len(shard.Raiders)
+			raiders[player.Id] = i
+			shard.Raiders = append(shard.Raiders, datastore.GuildAggregateRaider{
+				PlayerId:  player.Id,
+				FirstRaid: report.StartTime,
+			})
+		}
+		raider := &shard.Raiders[i]
+		raider.Name = player.Name
+		raider.Class = player.Class
+		raider.Server = player.Server
+		if report.StartTime.Before(raider.FirstRaid) {
+			raider.FirstRaid = report.StartTime
+		}
+		if accountName, ok := playerAccounts[player.Id]; ok {
+			setGuildRaiderAccount(shard, raider, accountName)
+		}
+		raider.Count++
+		addGuildAccount(shard, raider.Account, 1)
+	}
+
+	shard.NumRaids++
+	shard.Raids = append(shard.Raids, raid)
+	sortGuildRaids(shard.Raids)
+	if len(shard.Raids) > maxGuildAggregateRaids {
+		shard.Raids = shard.Raids[:maxGuildAggregateRaids]
+	}
+}
+
+// removeGuildRaid takes a report back out of a shard of its guild's aggregate.
+func removeGuildRaid(shard *datastore.GuildAggregateShard, code string, report datastore.Report) {
+	if shard.NumRaids > 0 {
+		shard.NumRaids--
+	}
+	raids := []datastore.GuildAggregateRaid{}
+	for _, raid := range shard.Raids {
+		if raid.Code != code {
+			raids = append(raids, raid)
+		}
+	}
+	shard.Raids = raids
+
+	raiders := guildRaiderIndices(shard)
+	for _, player := range uniqueReportPlayers(report) {
+		if i, ok := raiders[player.Id]; ok {
+			shard.Raiders[i].Count--
+			addGuildAccount(shard, shard.Raiders[i].Account, -1)
+		}
+	}
+	remaining := []datastore.GuildAggregateRaider{}
+	for _, raider := range shard.Raiders {
+		if raider.Count > 0 {
+			remaining = append(remaining, raider)
+		}
+	}
+	shard.Raiders = remaining
+}
+
+// setGuildRaiderAccount moves the raids of a raider in a shard to the account claiming it, and returns whether the
+// account changed.
+func setGuildRaiderAccount(
+	shard *datastore.GuildAggregateShard,
+	raider *datastore.GuildAggregateRaider,
+	accountName string,
+) bool {
+	if raider.Account == accountName {
+		return false
+	}
+	addGuildAccount(shard, raider.Account, -raider.Count)
+	raider.Account = accountName
+	addGuildAccount(shard, raider.Account, raider.Count)
+	return true
+}
+
+// addGuildAccount adds delta raids to an account in a shard, dropping accounts that no raids are left for.
+func addGuildAccount(shard *datastore.GuildAggregateShard, accountName string, delta int64) {
+	if accountName == "" || delta == 0 {
+		return
+	}
+	for i := range shard.Accounts {
+		if shard.Accounts[i].Name != accountName {
+			continue
+		}
+		shard.Accounts[i].Count += delta
+		if shard.Accounts[i].Count <= 0 {
+			shard.Accounts = append(shard.Accounts[:i], shard.Accounts[i+1:]...)
+		}
+		return
+	}
+	if delta > 0 {
+		shard.Accounts = append(shard.Accounts, datastore.GuildAggregateAccount{
+			Name:  accountName,
+			Count: delta,
+		})
+	}
+}
+
+// mergeGuildShards fills in the counts, the most recent raids and the guild name of a guild aggregate from its shards.
+// Characters claimed differently in different shards, while a claim is still being broadcast, keep the first claim.
+func mergeGuildShards(guildAggregate *datastore.GuildAggregate, shards []datastore.GuildAggregateShard) {
+	guildAggregate.NumRaids = 0
+	guildAggregate.Raids = []datastore.GuildAggregateRaid{}
+	guildAggregate.Raiders = []datastore.GuildAggregateRaider{}
+	guildAggregate.Accounts = []datastore.GuildAggregateAccount{}
+	raiders := map[int64]int{}
+	accounts := map[string]int{}
+	for _, shard := range shards {
+		guildAggregate.NumRaids += shard.NumRaids
+		guildAggregate.Raids = append(guildAggregate.Raids, shard.Raids...)
+
+		for _, raider := range shard.Raiders {
+			i, ok := raiders[raider.PlayerId]
+			if !ok {
+				raiders[raider.PlayerId] = len(guildAggregate.Raiders)
+				guildAggregate.Raiders = append(guildAggregate.Raiders, raider)
+				continue
+			}
+
+			merged := &guildAggregate.Raiders[i]
+			merged.Count += raider.Count
+			if raider.FirstRaid.Before(merged.FirstRaid) {
+				merged.FirstRaid = raider.FirstRaid
+			}
+			if merged.Account == "" {
+				merged.Account = raider.Account
+			}
+		}
+
+		for _, account := range shard.Accounts {
+			if i, ok := accounts[account.Name]; ok {
+				guildAggregate.Accounts[i].Count += account.Count
+				continue
+			}
+			accounts[account.Name] = len(guildAggregate.Accounts)
+			guildAggregate.Accounts = append(guildAggregate.Accounts, account)
+		}
+	}
+
+	sortGuildRaids(guildAggregate.Raids)
+	if len(guildAggregate.Raids) > maxGuildAggregateRaids {
+		guildAggregate.Raids = guildAggregate.Raids[:maxGuildAggregateRaids]
+	}
+	guildAggregate.GuildName = ""
+	for _, raid := range guildAggregate.Raids {
+		if raid.GuildName != "" {
+			guildAggregate.GuildName = raid.GuildName
+			break
+		}
+	}
+}
+
+// guildRaiderIndices maps the player IDs of the raiders in a shard to their index.
+func guildRaiderIndices(shard *datastore.GuildAggregateShard) map[int64]int {
+	raiders := map[int64]int{}
+	for i, raider := range shard.Raiders {
+		raiders[raider.PlayerId] = i
+	}
+	return raiders
+}
+
+// sortGuildRaids orders raids from newest to oldest.
+func sortGuildRaids(raids []datastore.GuildAggregateRaid) {
+	sort.SliceStable(raids, func(i int, j int) bool {
+		return raids[i].StartTime.After(raids[j].StartTime)
+	})
+}
+
+// touchGuildAggregate checks the aggregate of a guild as part of a transaction that changes its raids, and returns
+// whether it is up to date. Aggregates that are up to date are only read, so that concurrent reports only contend on
+// their shards. Missing or outdated aggregates get their update time bumped instead, so that rebuilds running
+// concurrently notice the change.
+func touchGuildAggregate(tx *google_datastore.Transaction, guildId int32) (*google_datastore.Key, bool, error) {
+	guildAggregateKey := datastore.GuildAggregateKey(guildId)
+	guildAggregate, current, err := getGuildAggregate(tx.Get, guildAggregateKey)
+	if err != nil {
+		return nil, false, err
+	}
+	if current {
+		return guildAggregateKey, true, nil
+	}
+
+	guildAggregate.UpdateTime = time.Now()
+	_, err = tx.Put(guildAggregateKey, &guildAggregate)
+	if err != nil {
+		return nil, false, fmt.Errorf("datastore write guild aggregate %v failed: %v", guildId, err)
+	}
+	return guildAggregateKey, false, nil
+}
+
+// getGuildAggregate reads the aggregate of a guild and returns whether it is up to date. Aggregates stored by older
+// versions may have properties that don't exist anymore, which only makes them outdated.
+func getGuildAggregate(
+	get func(key *google_datastore.Key, dst interface{}) error,
+	guildAggregateKey *google_datastore.Key,
+) (datastore.GuildAggregate, bool, error) {
+	var guildAggregate datastore.GuildAggregate
+	err := get(guildAggregateKey, &guildAggregate)
+	if err == google_datastore.ErrNoSuchEntity {
+		return guildAggregate, false, nil
+	}
+	if _, ok := err.(*google_datastore.ErrFieldMismatch); err != nil && !ok {
+		return guildAggregate, false, fmt.Errorf("datastore get guild aggregate %v failed: %v", guildAggregateKey.ID, err)
+	}
+	return guildAggregate, err == nil && guildAggregate.Version == GuildAggregateVersion, nil
+}
+
+// uniqueReportPlayers returns the players of a report, counting players that appear multiple times only once.
+func uniqueReportPlayers(report datastore.Report) []datastore.ReportPlayer {
+	players := []datastore.ReportPlayer{}
+	seen := map[int64]struct{}{}
+	for _, player := range report.Players {
+		if _, ok := seen[player.Id]; ok {
+			continue
+		}
+		seen[player.Id] = struct{}{}
+		players = append(players, player)
+	}
+	return players
+}
@@ -0,0 +1,163 @@
+package aggregate
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	google_datastore "cloud.google.com/go/datastore"
+)
+
+const (
+	maxRebuildAttempts = 3
+	maxChildBatchSize  = 500
+)
+
+// aggregateStamp loads just the update time of a stored aggregate of any kind.
+type aggregateStamp struct {
+	UpdateTime time.Time
+}
+
+// getStamp reads the update time of the aggregate stored under key, which is zero if there is none, and whether it
+// exists.
+func getStamp(
+	get func(key *google_datastore.Key, dst interface{}) error,
+	key *google_datastore.Key,
+) (time.Time, bool, error) {
+	var stamp aggregateStamp
+	err := get(key, &stamp)
+	if err == google_datastore.ErrNoSuchEntity {
+		return stamp.UpdateTime, false, nil
+	}
+	if _, ok := err.(*google_datastore.ErrFieldMismatch); err != nil && !ok {
+		return stamp.UpdateTime, false, fmt.Errorf("datastore get %v failed: %v", key, err)
+	}
+	return stamp.UpdateTime, true, nil
+}
+
+// rebuild computes an aggregate with build and stores it under key, or deletes the stored aggregate if build reports
+// that there is nothing to aggregate. Incremental updates that commit while build runs change the update time of the
+// stored aggregate, in which case the rebuild starts over. If the aggregate keeps changing, it isn't stored and false
+// is returned. Aggregates with child entities write them in writeChildren, which runs outside of the transaction since
+// there may be too many children for one. That is safe because incremental updates leave the children of missing or
+// outdated aggregates alone, and only bump the update time which makes the rebuild start over.
+func rebuild(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	key *google_datastore.Key,
+	build func() (interface{}, bool, error),
+	writeChildren func(store bool) error,
+) (bool, error) {
+	for attempt := 0; attempt < maxRebuildAttempts; attempt++ {
+		previous, _, err := getStamp(func(key *google_datastore.Key, dst interface{}) error {
+			return datastoreClient.Get(ctx, key, dst)
+		}, key)
+		if err != nil {
+			return false, err
+		}
+
+		entity, store, err := build()
+		if err != nil {
+			return false, err
+		}
+
+		if writeChildren != nil {
+			err = writeChildren(store)
+			if err != nil {
+				return false, err
+			}
+		}
+
+		tx, err := datastoreClient.NewTransaction(ctx)
+		if err != nil {
+			return false, fmt.Errorf("failed to create transaction: %v", err)
+		}
+
+		current, exists, err := getStamp(tx.Get, key)
+		if err != nil {
+			tx.Rollback()
+			return false, err
+		}
+		if !current.Equal(previous) {
+			tx.Rollback()
+			continue
+		}
+
+		if store {
+			_, err = tx.Put(key, entity)
+		} else if exists {
+			err = tx.Delete(key)
+		}
+		if err != nil {
+			tx.Rollback()
+			return false, fmt.Errorf("datastore write %v failed: %v", key, err)
+		}
+
+		_, err = tx.Commit()
+		if err == google_datastore.ErrConcurrentTransaction {
+			continue
+		} else if err != nil {
+			return false, fmt.Errorf("datastore write %v failed: %v", key, err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// replaceChildren replaces the child entities of the given kind below parentKey with the given ones, deleting children
+// that aren't part of them anymore.
+func replaceChildren(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	parentKey *google_datastore.Key,
+	kind string,
+	keys []*google_datastore.Key,
+	children []interface{},
+) error {
+	existingKeys, err := datastoreClient.GetAll(ctx, google_datastore.NewQuery(kind).Ancestor(parentKey).KeysOnly(), nil)
+	if err != nil {
+		return fmt.Errorf("datastore query %v children of %v failed: %v", kind, parentKey, err)
+	}
+
+	newKeys := map[string]struct{}{}
+	for _, key := range keys {
+		newKeys[key.String()] = struct{}{}
+	}
+	staleKeys := []*google_datastore.Key{}
+	for _, key := range existingKeys {
+		if _, ok := newKeys[key.String()]; !ok {
+			staleKeys = append(staleKeys, key)
+		}
+	}
+
+	for start := 0; start < len(staleKeys); start += maxChildBatchSize {
+		end := start + maxChildBatchSize
+		if end > len(staleKeys) {
+			end = len(staleKeys)
+		}
+		err = datastoreClient.DeleteMulti(ctx, staleKeys[start:end])
+		if err != nil {
+			return fmt.Errorf("datastore delete %v children of %v failed: %v", kind, parentKey, err)
+		}
+	}
+
+	for start := 0; start < len(keys); start += maxChildBatchSize {
+		end := start + maxChildBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		_, err = datastoreClient.PutMulti(ctx, keys[start:end], children[start:end])
+		if err != nil {
+			return fmt.Errorf("datastore write %v children of %v failed: %v", kind, parentKey, err)
+		}
+	}
+	return nil
+}
+
+// reportShard picks the shard of an aggregate that a report is counted in.
+func reportShard(code string, numShards int) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(code))
+	return int(hash.Sum32() % uint32(numShards))
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Entry is a rendered page as stored by a cache backend.
+type Entry struct {
+	CreationTime time.Time
+	HtmlGzip     []byte
+}
+
+// Backend stores rendered pages. Get reports whether the page was found, and a missing page is not an error.
+type Backend interface {
+	Name() string
+	Get(ctx context.Context, page Page) (Entry, bool, error)
+	Put(ctx context.Context, page Page, entry Entry) error
+	Delete(ctx context.Context, page Page) error
+	Stats() []Stats
+}
+
+type Stats struct {
+	Backend string
+	Hits    int64
+	Misses  int64
+	Puts    int64
+	Deletes int64
+}
+
+func (s Stats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// counters keeps the statistics of a backend. Backends are shared between concurrent requests, so all updates are
+// atomic.
+type counters struct {
+	hits    int64
+	misses  int64
+	puts    int64
+	deletes int64
+}
+
+func (c *counters) recordGet(found bool) {
+	if found {
+		atomic.AddInt64(&c.hits, 1)
+	} else {
+		atomic.AddInt64(&c.misses, 1)
+	}
+}
+
+func (c *counters) recordPut() {
+	atomic.AddInt64(&c.puts, 1)
+}
+
+func (c *counters) recordDelete() {
+	atomic.AddInt64(&c.deletes, 1)
+}
+
+func (c *counters) stats(name string) Stats {
+	return Stats{
+		Backend: name,
+		Hits:    atomic.LoadInt64(&c.hits),
+		Misses:  atomic.LoadInt64(&c.misses),
+		Puts:    atomic.LoadInt64(&c.puts),
+		Deletes: atomic.LoadInt64(&c.deletes),
+	}
+}
@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	google_datastore "cloud.google.com/go/datastore"
+	"github.com/FabianHahn/raidlogscan/datastore"
+)
+
+const (
+	// Datastore entities are limited to 1 MiB, which leaves some room for the other properties and the key.
+	maxDatastoreEntrySize = 1000 * 1000
+)
+
+type DatastoreBackend struct {
+	datastoreClient *google_datastore.Client
+	counters        counters
+}
+
+// NewDatastoreBackend stores pages in the account_stats, guild_stats and player_stats entities. Pages too large for
+// a datastore entity are skipped, so they need to be cached by another layer.
+func NewDatastoreBackend(datastoreClient *google_datastore.Client) *DatastoreBackend {
+	return &DatastoreBackend{
+		datastoreClient: datastoreClient,
+	}
+}
+
+func (b *DatastoreBackend) Name() string {
+	return "datastore"
+}
+
+func (b *DatastoreBackend) Get(ctx context.Context, page Page) (Entry, bool, error) {
+	var cachedPage datastore.CachedPage
+	err := b.datastoreClient.Get(ctx, page.datastoreKey(), &cachedPage)
+	if _, ok := err.(*google_datastore.ErrFieldMismatch); ok {
+		// Older cache entities carry additional properties that are no longer used.
+		err = nil
+	}
+	if err == google_datastore.ErrNoSuchEntity {
+		b.counters.recordGet(false)
+		return Entry{}, false, nil
+	} else if err != nil {
+		return Entry{}, false, fmt.Errorf("datastore get of %v failed: %v", page, err)
+	}
+
+	b.counters.recordGet(true)
+	return Entry{
+		CreationTime: cachedPage.CreationTime,
+		HtmlGzip:     cachedPage.HtmlGzip,
+	}, true, nil
+}
+
+func (b *DatastoreBackend) Put(ctx context.Context, page Page, entry Entry) error {
+	if len(entry.HtmlGzip) > maxDatastoreEntrySize {
+		log.Printf("Not caching %v in datastore since it has %v bytes.\n", page, len(entry.HtmlGzip))
+		return nil
+	}
+
+	cachedPage := datastore.CachedPage{
+		CreationTime: entry.CreationTime,
+		HtmlGzip:     entry.HtmlGzip,
+	}
+	_, err := b.datastoreClient.Put(ctx, page.datastoreKey(), &cachedPage)
+	if err != nil {
+		return fmt.Errorf("datastore put of %v failed: %v", page, err)
+	}
+	b.counters.recordPut()
+	return nil
+}
+
+func (b *DatastoreBackend) Delete(ctx context.Context, page Page) error {
+	err := b.datastoreClient.Delete(ctx, page.datastoreKey())
+	if err != nil && err != google_datastore.ErrNoSuchEntity {
+		return fmt.Errorf("datastore delete of %v failed: %v", page, err.Error())
+	}
+	b.counters.recordDelete()
+	return nil
+}
+
+func (b *DatastoreBackend) Stats() []Stats {
+	return []Stats{b.counters.stats(b.Name())}
+}
@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// creationTimeHeaderSize is the size of the header in front of the gzip data of a cached file, holding the creation
+	// time of the page in nanoseconds since the Unix epoch.
+	creationTimeHeaderSize = 8
+)
+
+// FilesystemBackend stores pages as gzip files below a directory, each with a header holding the creation time of its
+// page. Like the memory backend, entries expire a fixed time after they were stored, which is the modification time of
+// the file.
+type FilesystemBackend struct {
+	directory string
+	ttl       time.Duration
+	counters  counters
+}
+
+func NewFilesystemBackend(directory string, ttl time.Duration) *FilesystemBackend {
+	return &FilesystemBackend{
+		directory: directory,
+		ttl:       ttl,
+	}
+}
+
+func (b *FilesystemBackend) Name() string {
+	return "filesystem"
+}
+
+func (b *FilesystemBackend) Get(ctx context.Context, page Page) (Entry, bool, error) {
+	path := b.path(page)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) || (err == nil && time.Since(info.ModTime()) > b.ttl) {
+		b.counters.recordGet(false)
+		return Entry{}, false, nil
+	} else if err != nil {
+		return Entry{}, false, fmt.Errorf("failed to stat cached %v: %v", page, err)
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) || (err == nil && len(contents) < creationTimeHeaderSize) {
+		b.counters.recordGet(false)
+		return Entry{}, false, nil
+	} else if err != nil {
+		return Entry{}, false, fmt.Errorf("failed to read cached %v: %v", page, err)
+	}
+
+	b.counters.recordGet(true)
+	creationTime := int64(binary.BigEndian.Uint64(contents[:creationTimeHeaderSize]))
+	return Entry{
+		CreationTime: time.Unix(0, creationTime),
+		HtmlGzip:     contents[creationTimeHeaderSize:],
+	}, true, nil
+}
+
+// Put writes the page to a temporary file first and then renames it, so that concurrent readers never see a partially
+// written page.
+func (b *FilesystemBackend) Put(ctx context.Context, page Page, entry Entry) error {
+	path := b.path(page)
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create cache directory for %v: %v", page, err)
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to create cache file for %v: %v", page, err)
+	}
+	header := make([]byte, creationTimeHeaderSize)
+	binary.BigEndian.PutUint64(header, uint64(entry.CreationTime.UnixNano()))
+	_, err = file.Write(header)
+	if err == nil {
+		_, err = file.Write(entry.HtmlGzip)
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return fmt.Errorf("failed to write cache file for %v: %v", page, err)
+	}
+
+	b.counters.recordPut()
+	return nil
+}
+
+func (b *FilesystemBackend) Delete(ctx context.Context, page Page) error {
+	err := os.Remove(b.path(page))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete cache file for %v: %v", page, err)
+	}
+	b.counters.recordDelete()
+	return nil
+}
+
+func (b *FilesystemBackend) Stats() []Stats {
+	return []Stats{b.counters.stats(b.Name())}
+}
+
+func (b *FilesystemBackend) path(page Page) string {
+	return filepath.Join(b.directory, filepath.FromSlash(page.cacheKey())+".html.gz")
+}
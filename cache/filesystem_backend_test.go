@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFilesystemBackendOldPage(t *testing.T) {
+	directory, err := ioutil.TempDir("", "raidlogscan-cache-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	// Pages rendered long ago are still served until they were stored for longer than the TTL.
+	ctx := context.Background()
+	backend := NewFilesystemBackend(directory, time.Minute)
+	page := GuildStatsPage(687460)
+	entry := Entry{
+		CreationTime: time.Now().Add(-time.Hour).Round(0),
+		HtmlGzip:     []byte("page"),
+	}
+	err = backend.Put(ctx, page, entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cached, found, err := backend.Get(ctx, page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		t.Fatalf("expected %v to be cached", page)
+	}
+	if !cached.CreationTime.Equal(entry.CreationTime) {
+		t.Fatalf("expected creation time %v, got %v", entry.CreationTime, cached.CreationTime)
+	}
+	if !bytes.Equal(cached.HtmlGzip, entry.HtmlGzip) {
+		t.Fatalf("expected page %q, got %q", entry.HtmlGzip, cached.HtmlGzip)
+	}
+}
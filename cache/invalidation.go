@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	google_datastore "cloud.google.com/go/datastore"
+	"github.com/FabianHahn/raidlogscan/datastore"
+)
+
+const (
+	// invalidationDebounce is how long an invalidation mark covers further invalidations of the same page, which
+	// are then skipped without writing to datastore.
+	invalidationDebounce = 10 * time.Second
+	// invalidationQuietPeriod is how long a page needs to go without invalidations before it is rendered again.
+	// Until then, the previous version of the page keeps being served.
+	invalidationQuietPeriod = 2 * time.Minute
+)
+
+var pendingInvalidations = struct {
+	sync.Mutex
+	until map[string]time.Time
+}{
+	until: map[string]time.Time{},
+}
+
+// MarkDirty marks a page as outdated without deleting it. Marks are written a debounce period into the future, so
+// that further invalidations within that period are already covered and can be skipped. This coalesces the many
+// invalidations of a single scan into a few datastore writes. Marks written by other instances in the meantime are
+// merged rather than overwritten, so that they never move backwards.
+func (p Page) MarkDirty(ctx context.Context, datastoreClient *google_datastore.Client) error {
+	now := time.Now()
+	key := p.cacheKey()
+
+	pendingInvalidations.Lock()
+	if now.Before(pendingInvalidations.until[key]) {
+		pendingInvalidations.Unlock()
+		return nil
+	}
+	for pendingKey, until := range pendingInvalidations.until {
+		if now.After(until) {
+			delete(pendingInvalidations.until, pendingKey)
+		}
+	}
+	until := now.Add(invalidationDebounce)
+	pendingInvalidations.until[key] = until
+	pendingInvalidations.Unlock()
+
+	_, err := updateInvalidation(ctx, datastoreClient, p, func(invalidation *datastore.CacheInvalidation) {
+		if invalidation.Until.Before(until) {
+			invalidation.Until = until
+		}
+	})
+	if err != nil {
+		pendingInvalidations.Lock()
+		delete(pendingInvalidations.until, key)
+		pendingInvalidations.Unlock()
+		return err
+	}
+	return nil
+}
+
+// updateInvalidation applies a change to the invalidation mark of a page in a transaction, and returns the updated
+// mark.
+func updateInvalidation(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	page Page,
+	update func(invalidation *datastore.CacheInvalidation),
+) (datastore.CacheInvalidation, error) {
+	key := page.invalidationKey()
+	var invalidation datastore.CacheInvalidation
+	err := datastore.RunTransaction(ctx, datastoreClient, func(tx *google_datastore.Transaction) error {
+		invalidation = datastore.CacheInvalidation{}
+		err := tx.Get(key, &invalidation)
+		if err != nil && err != google_datastore.ErrNoSuchEntity {
+			return err
+		}
+
+		update(&invalidation)
+		_, err = tx.Put(key, &invalidation)
+		return err
+	})
+	if err != nil {
+		return datastore.CacheInvalidation{}, fmt.Errorf("datastore put of invalidation of %v failed: %v", page, err)
+	}
+	return invalidation, nil
+}
+
+func (p Page) invalidationKey() *google_datastore.Key {
+	return google_datastore.NameKey("cache_invalidation", p.cacheKey(), nil)
+}
+
+type memoizedInvalidation struct {
+	invalidation datastore.CacheInvalidation
+	fetchedAt    time.Time
+}
+
+// invalidations looks up when pages were last invalidated. Lookups are remembered for as long as the local cache
+// layers keep their entries, so that serving a page from memory doesn't cost a datastore read.
+type invalidations struct {
+	datastoreClient *google_datastore.Client
+	mutex           sync.Mutex
+	memo            map[string]memoizedInvalidation
+}
+
+func (i *invalidations) get(ctx context.Context, page Page) (datastore.CacheInvalidation, error) {
+	key := page.cacheKey()
+	i.mutex.Lock()
+	memoized, ok := i.memo[key]
+	i.mutex.Unlock()
+	if ok && time.Since(memoized.fetchedAt) < localCacheTtl {
+		return memoized.invalidation, nil
+	}
+
+	var invalidation datastore.CacheInvalidation
+	err := i.datastoreClient.Get(ctx, page.invalidationKey(), &invalidation)
+	if err != nil && err != google_datastore.ErrNoSuchEntity {
+		return datastore.CacheInvalidation{}, fmt.Errorf("datastore get of invalidation of %v failed: %v", page, err)
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	for memoKey, entry := range i.memo {
+		if time.Since(entry.fetchedAt) >= localCacheTtl {
+			delete(i.memo, memoKey)
+		}
+	}
+	i.memo[key] = memoizedInvalidation{
+		invalidation: invalidation,
+		fetchedAt:    time.Now(),
+	}
+	return invalidation, nil
+}
+
+// markImmediate marks a page as outdated without waiting for the quiet period. Only versions of the page created before
+// now skip the quiet period, so that later invalidations by MarkDirty settle as usual, and marks that reach further
+// into the future are kept.
+func (i *invalidations) markImmediate(ctx context.Context, page Page) error {
+	now := time.Now()
+	invalidation, err := updateInvalidation(ctx, i.datastoreClient, page, func(invalidation *datastore.CacheInvalidation) {
+		if invalidation.Until.Before(now) {
+			invalidation.Until = now
+		}
+		if invalidation.ImmediateUntil.Before(now) {
+			invalidation.ImmediateUntil = now
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.memo[page.cacheKey()] = memoizedInvalidation{
+		invalidation: invalidation,
+		fetchedAt:    time.Now(),
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	statsLogInterval = 100
+)
+
+// LayeredBackend combines backends ordered from fastest to slowest. Reads go through the layers in order and fill
+// in the faster layers on a hit, while writes and deletes go to all layers.
+type LayeredBackend struct {
+	layers   []Backend
+	counters counters
+	lookups  int64
+}
+
+func NewLayeredBackend(layers ...Backend) *LayeredBackend {
+	return &LayeredBackend{
+		layers: layers,
+	}
+}
+
+func (b *LayeredBackend) Name() string {
+	names := []string{}
+	for _, layer := range b.layers {
+		names = append(names, layer.Name())
+	}
+	return strings.Join(names, "+")
+}
+
+func (b *LayeredBackend) Get(ctx context.Context, page Page) (Entry, bool, error) {
+	if atomic.AddInt64(&b.lookups, 1)%statsLogInterval == 0 {
+		b.logStats()
+	}
+
+	for i, layer := range b.layers {
+		entry, found, err := layer.Get(ctx, page)
+		if err != nil {
+			return Entry{}, false, err
+		}
+		if !found {
+			continue
+		}
+
+		for _, fasterLayer := range b.layers[:i] {
+			err = fasterLayer.Put(ctx, page, entry)
+			if err != nil {
+				log.Printf("Failed to fill %v cache with %v: %v\n", fasterLayer.Name(), page, err)
+			}
+		}
+		b.counters.recordGet(true)
+		return entry, true, nil
+	}
+
+	b.counters.recordGet(false)
+	return Entry{}, false, nil
+}
+
+func (b *LayeredBackend) Put(ctx context.Context, page Page, entry Entry) error {
+	errs := []string{}
+	for _, layer := range b.layers {
+		err := layer.Put(ctx, page, entry)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to cache %v: %v", page, strings.Join(errs, "; "))
+	}
+	b.counters.recordPut()
+	return nil
+}
+
+func (b *LayeredBackend) Delete(ctx context.Context, page Page) error {
+	errs := []string{}
+	for _, layer := range b.layers {
+		err := layer.Delete(ctx, page)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to invalidate %v: %v", page, strings.Join(errs, "; "))
+	}
+	b.counters.recordDelete()
+	return nil
+}
+
+// Stats returns the statistics of the combined cache first, followed by those of the individual layers.
+func (b *LayeredBackend) Stats() []Stats {
+	stats := []Stats{b.counters.stats(b.Name())}
+	for _, layer := range b.layers {
+		stats = append(stats, layer.Stats()...)
+	}
+	return stats
+}
+
+func (b *LayeredBackend) logStats() {
+	for _, stats := range b.Stats() {
+		log.Printf("Page cache %v: %v hits, %v misses (%.1f%% hit rate), %v puts, %v deletes.\n",
+			stats.Backend, stats.Hits, stats.Misses, stats.HitRate()*100, stats.Puts, stats.Deletes)
+	}
+}
@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	key      string
+	entry    Entry
+	storedAt time.Time
+}
+
+// MemoryBackend is an in-process LRU cache bounded by the total size of the stored pages. Entries also expire after
+// a fixed time, since invalidations from other instances never reach this process.
+type MemoryBackend struct {
+	maxBytes int
+	ttl      time.Duration
+	mutex    sync.Mutex
+	bytes    int
+	order    *list.List
+	entries  map[string]*list.Element
+	counters counters
+}
+
+func NewMemoryBackend(maxBytes int, ttl time.Duration) *MemoryBackend {
+	return &MemoryBackend{
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		order:    list.New(),
+		entries:  map[string]*list.Element{},
+	}
+}
+
+func (b *MemoryBackend) Name() string {
+	return "memory"
+}
+
+func (b *MemoryBackend) Get(ctx context.Context, page Page) (Entry, bool, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	element, ok := b.entries[page.cacheKey()]
+	if ok && time.Since(element.Value.(*memoryEntry).storedAt) > b.ttl {
+		b.remove(element)
+		ok = false
+	}
+	b.counters.recordGet(ok)
+	if !ok {
+		return Entry{}, false, nil
+	}
+
+	b.order.MoveToFront(element)
+	return element.Value.(*memoryEntry).entry, true, nil
+}
+
+func (b *MemoryBackend) Put(ctx context.Context, page Page, entry Entry) error {
+	if len(entry.HtmlGzip) > b.maxBytes {
+		return nil
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	key := page.cacheKey()
+	if element, ok := b.entries[key]; ok {
+		b.remove(element)
+	}
+	b.entries[key] = b.order.PushFront(&memoryEntry{
+		key:      key,
+		entry:    entry,
+		storedAt: time.Now(),
+	})
+	b.bytes += len(entry.HtmlGzip)
+	for b.bytes > b.maxBytes {
+		b.remove(b.order.Back())
+	}
+	b.counters.recordPut()
+	return nil
+}
+
+func (b *MemoryBackend) Delete(ctx context.Context, page Page) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if element, ok := b.entries[page.cacheKey()]; ok {
+		b.remove(element)
+	}
+	b.counters.recordDelete()
+	return nil
+}
+
+func (b *MemoryBackend) Stats() []Stats {
+	return []Stats{b.counters.stats(b.Name())}
+}
+
+// remove drops an element from the LRU list. The mutex must be held by the caller.
+func (b *MemoryBackend) remove(element *list.Element) {
+	entry := b.order.Remove(element).(*memoryEntry)
+	delete(b.entries, entry.key)
+	b.bytes -= len(entry.entry.HtmlGzip)
+}
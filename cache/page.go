@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	google_datastore "cloud.google.com/go/datastore"
+)
+
+// Page identifies a cached stats page. Pages are keyed like the entity they are about, under their own kind.
+// Pages with a max age are rendered again once their cached version is older than that, even if their data didn't
+// change, for pages that depend on the current time.
+type Page struct {
+	kind        string
+	name        string
+	id          int64
+	description string
+	maxAge      time.Duration
+}
+
+func (p Page) String() string {
+	return p.description
+}
+
+func (p Page) datastoreKey() *google_datastore.Key {
+	if p.name != "" {
+		return google_datastore.NameKey(p.kind, p.name, nil)
+	}
+	return google_datastore.IDKey(p.kind, p.id, nil)
+}
+
+// cacheKey returns a slash separated key for backends that don't use datastore keys. Names are escaped so that they
+// can't contain slashes themselves.
+func (p Page) cacheKey() string {
+	if p.name != "" {
+		return p.kind + "/" + url.PathEscape(p.name)
+	}
+	return p.kind + "/" + strconv.FormatInt(p.id, 10)
+}
+
+// InvalidateNow deletes the page from all cache layers of this instance and marks it as outdated on the others, so that
+// it is rendered again right away instead of after invalidations settled. Instances that looked up the page's
+// invalidation recently notice the mark once their lookup expires.
+func (p Page) InvalidateNow(ctx context.Context, pageCache *PageCache) error {
+	err := pageCache.backend.Delete(ctx, p)
+	if err != nil {
+		return err
+	}
+	return pageCache.invalidations.markImmediate(ctx, p)
+}
+
+// OutputCached writes the cached version of the page if there is one, and returns whether the request was answered.
+// A page that was invalidated keeps being served until its invalidations have settled, so that viewing a page while
+// its guild is being scanned doesn't render and cache it with partial data over and over.
+func (p Page) OutputCached(
+	w http.ResponseWriter,
+	r *http.Request,
+	pageCache *PageCache,
+	ctx context.Context,
+) bool {
+	entry, found, err := pageCache.backend.Get(ctx, p)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Cache lookup failed: %v", err)
+		return true
+	}
+	if !found {
+		w.Header().Set("X-Cache", "miss")
+		return false
+	}
+	if p.maxAge > 0 && time.Since(entry.CreationTime) > p.maxAge {
+		w.Header().Set("X-Cache", "expired")
+		return false
+	}
+
+	invalidation, err := pageCache.invalidations.get(ctx, p)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Cache lookup failed: %v", err)
+		return true
+	}
+	if entry.CreationTime.Before(invalidation.Until) {
+		if entry.CreationTime.Before(invalidation.ImmediateUntil) ||
+			time.Now().After(invalidation.Until.Add(invalidationQuietPeriod)) {
+			w.Header().Set("X-Cache", "revalidate")
+			return false
+		}
+		w.Header().Set("X-Cache", "stale")
+	} else {
+		w.Header().Set("X-Cache", "hit")
+	}
+
+	WriteCachedResponse(w, r, entry.HtmlGzip, entry.CreationTime, CacheControlStats)
+	return true
+}
+
+// CacheAndOutput renders the page, stores it compressed in the cache and writes it. The creation time has to be taken
+// before the page's data is loaded, so that invalidations while loading still mark the cached page as stale.
+func (p Page) CacheAndOutput(
+	w http.ResponseWriter,
+	r *http.Request,
+	pageCache *PageCache,
+	ctx context.Context,
+	creationTime time.Time,
+	render func(wr io.Writer) error,
+) {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	err := render(writer)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to render page: %v", err)
+		return
+	}
+
+	err = writer.Close()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to gzip compress output: %v", err)
+		return
+	}
+
+	entry := Entry{
+		CreationTime: creationTime,
+		HtmlGzip:     buffer.Bytes(),
+	}
+	err = pageCache.backend.Put(ctx, p, entry)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to cache %v: %v", p, err)
+		return
+	}
+
+	WriteCachedResponse(w, r, entry.HtmlGzip, entry.CreationTime, CacheControlStats)
+}
@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"time"
+
+	google_datastore "cloud.google.com/go/datastore"
+)
+
+const (
+	memoryCacheBytes = 64 * 1024 * 1024
+	localCacheTtl    = time.Minute
+
+	// timeWindowPageMaxAge bounds how stale the time windows of role distributions on account and player pages can get
+	// for characters that stopped raiding.
+	timeWindowPageMaxAge = 24 * time.Hour
+	// reportPageMaxAge bounds how stale the guild history on report pages can get when earlier raids of the guild are
+	// scanned or claimed later on.
+	reportPageMaxAge = time.Hour
+)
+
+type PageCache struct {
+	backend       Backend
+	invalidations *invalidations
+}
+
+// CreatePageCache builds the cache serving the stats pages: hot pages come from memory, then from cacheDirectory if
+// one is given, and finally from datastore. Invalidations are triggered by events running on other instances, so they
+// are kept as marks in datastore that are looked up at most once a minute per page. The local layers expire their
+// entries after a minute as well, since deleted datastore entries never reach them.
+func CreatePageCache(datastoreClient *google_datastore.Client, cacheDirectory string) *PageCache {
+	layers := []Backend{NewMemoryBackend(memoryCacheBytes, localCacheTtl)}
+	if cacheDirectory != "" {
+		layers = append(layers, NewFilesystemBackend(cacheDirectory, localCacheTtl))
+	}
+	layers = append(layers, NewDatastoreBackend(datastoreClient))
+	return &PageCache{
+		backend: NewLayeredBackend(layers...),
+		invalidations: &invalidations{
+			datastoreClient: datastoreClient,
+			memo:            map[string]memoizedInvalidation{},
+		},
+	}
+}
@@ -0,0 +1,22 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+
+	google_datastore "cloud.google.com/go/datastore"
+)
+
+func PlayerStatsPage(playerId int64) Page {
+	return Page{
+		kind:        "player_stats",
+		id:          playerId,
+		description: fmt.Sprintf("player stats of %v", playerId),
+		maxAge:      timeWindowPageMaxAge,
+	}
+}
+
+// InvalidatePlayerStatsCache marks the cached page as outdated, see Page.MarkDirty.
+func InvalidatePlayerStatsCache(ctx context.Context, datastoreClient *google_datastore.Client, playerId int64) error {
+	return PlayerStatsPage(playerId).MarkDirty(ctx, datastoreClient)
+}
@@ -0,0 +1,22 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+
+	google_datastore "cloud.google.com/go/datastore"
+)
+
+func ReportStatsPage(code string) Page {
+	return Page{
+		kind:        "report_stats",
+		name:        code,
+		description: fmt.Sprintf("report stats of %v", code),
+		maxAge:      reportPageMaxAge,
+	}
+}
+
+// InvalidateReportStatsCache marks the cached page as outdated, see Page.MarkDirty.
+func InvalidateReportStatsCache(ctx context.Context, datastoreClient *google_datastore.Client, code string) error {
+	return ReportStatsPage(code).MarkDirty(ctx, datastoreClient)
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// CacheControlStats is used for cached stats pages. They are invalidated whenever new raids come in, so clients
+	// keep them only briefly and revalidate afterwards, which is cheap thanks to the validators.
+	CacheControlStats = "public, max-age=60, must-revalidate"
+	// CacheControlFeed is used for calendar and Atom feeds, which feed readers poll on their own schedule.
+	CacheControlFeed = "public, max-age=900"
+	// CacheControlPrivate is used for pages that contain session tokens or secrets and must never be stored.
+	CacheControlPrivate = "private, no-store"
+)
+
+// ETag returns a strong entity tag for a cached gzip payload. The decompressed representation gets a different tag
+// than the gzipped one, since strong tags need to differ between content encodings.
+func ETag(compressedOutput []byte, gzipped bool) string {
+	hash := sha256.Sum256(compressedOutput)
+	tag := hex.EncodeToString(hash[:16])
+	if gzipped {
+		return fmt.Sprintf("\"%v-gzip\"", tag)
+	}
+	return fmt.Sprintf("\"%v\"", tag)
+}
+
+// WriteCachedResponse writes a cached gzip payload together with its validators and cache policy, and answers
+// conditional requests that already have the current version with 304 Not Modified.
+func WriteCachedResponse(
+	w http.ResponseWriter,
+	r *http.Request,
+	compressedOutput []byte,
+	creationTime time.Time,
+	cacheControl string,
+) {
+	gzipped := strings.Contains(r.Header.Get("Accept-Encoding"), "gzip")
+	etag := ETag(compressedOutput, gzipped)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", creationTime.UTC().Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("Vary", "Accept-Encoding")
+
+	if isNotModified(r, etag, creationTime) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	WriteCompressedResponseOrDecompress(w, r, compressedOutput)
+}
+
+// isNotModified evaluates the conditional request headers as described in RFC 7232. If-Modified-Since is only
+// considered if the request has no If-None-Match header.
+func isNotModified(r *http.Request, etag string, creationTime time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ifModifiedSince := r.Header.Get("If-Modified-Since"); ifModifiedSince != "" {
+		since, err := http.ParseTime(ifModifiedSince)
+		if err != nil {
+			return false
+		}
+		return !creationTime.Truncate(time.Second).After(since)
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package datastore
+
+import (
+	"time"
+
+	google_datastore "cloud.google.com/go/datastore"
+)
+
+// AccountCharacter is a character claimed by an account together with its number of non-duplicate raids. The raids
+// are counted in the shards of the account and only filled in by aggregate.LoadAccount.
+type AccountCharacter struct {
+	PlayerId int64
+	Name     string
+	Class    string
+	Server   string
+	NumRaids int64 `datastore:"-"`
+}
+
+// AccountCharacterRaids counts the non-duplicate raids of one of an account's characters in a shard.
+type AccountCharacterRaids struct {
+	PlayerId int64
+	NumRaids int64
+}
+
+// AccountGuild counts the raids of an account's characters in a guild, including duplicates.
+type AccountGuild struct {
+	GuildId   int32
+	GuildName string
+	Count     int64
+}
+
+// AccountRaid is a non-duplicate raid of one of an account's characters. Spec falls back to class and role for tanks,
+// which don't have a spec in the report player details.
+type AccountRaid struct {
+	Code      string
+	PlayerId  int64
+	StartTime time.Time
+	Role      string
+	Spec      string
+}
+
+// AccountRoleCount counts the non-duplicate raids of an account that were played with a role and spec.
+type AccountRoleCount struct {
+	Role  string
+	Spec  string
+	Count int64
+}
+
+// AccountCoraider counts the raids of an account's characters with a coraider. Account is the account the coraider is
+// claimed by, if any, which is kept on the account itself rather than in its shards.
+type AccountCoraider struct {
+	Id      int64
+	Name    string
+	Class   string
+	Server  string
+	Count   int64
+	Account string `datastore:"-"`
+}
+
+// AccountShard is stored as an account_shard entity below an account, keyed by shard number. Every report of an
+// account's characters is counted in the shard picked by its code, so that reports of the same account rarely write the
+// same entity. Counts in a shard may be negative when a report moved guilds after a rebuild, only their sums matter.
+type AccountShard struct {
+	Characters []AccountCharacterRaids `datastore:",noindex"`
+	Guilds     []AccountGuild          `datastore:",noindex"`
+	RoleCounts []AccountRoleCount      `datastore:",noindex"`
+	Coraiders  []AccountCoraider       `datastore:",noindex"`
+}
+
+// Account is the precomputed aggregate over all characters claimed by an account, keyed by account name. It is
+// maintained incrementally by the event pipeline and rebuilt from the player entities whenever Version is outdated.
+// The entity itself only stores the characters and the accounts their coraiders are claimed by, and is only written
+// when those change. The counts are kept in a fixed number of shards and only filled in by aggregate.LoadAccount,
+// which merges them, while the raids are queried from the reports of the account's characters.
+type Account struct {
+	Characters       []AccountCharacter      `datastore:",noindex"`
+	CoraiderAccounts []PlayerCoraiderAccount `datastore:",noindex"`
+	Guilds           []AccountGuild          `datastore:"-"`
+	RoleCounts       []AccountRoleCount      `datastore:"-"`
+	Coraiders        []AccountCoraider       `datastore:"-"`
+	UpdateTime       time.Time               `datastore:",noindex"`
+	Version          int64                   `datastore:",noindex"`
+}
+
+// AccountKey identifies the aggregate of the account with the given name.
+func AccountKey(accountName string) *google_datastore.Key {
+	return google_datastore.NameKey("account", accountName, nil)
+}
+
+// AccountShardKey identifies a shard of an account aggregate. Shards are numbered from zero, but stored with IDs
+// starting at one since datastore doesn't allow zero IDs.
+func AccountShardKey(accountKey *google_datastore.Key, shard int) *google_datastore.Key {
+	return google_datastore.IDKey("account_shard", int64(shard)+1, accountKey)
+}
@@ -0,0 +1,18 @@
+package datastore
+
+import "time"
+
+// CachedPage is a rendered and gzip compressed stats page. It is stored under the account_stats, guild_stats and
+// player_stats kinds, keyed like the entity the page is about.
+type CachedPage struct {
+	CreationTime time.Time
+	HtmlGzip     []byte `datastore:",noindex"`
+}
+
+// CacheInvalidation marks a cached page as outdated. It is stored under the cache_invalidation kind, keyed by the kind
+// and key of the page. Pages created before Until are stale, and those created before ImmediateUntil are rendered
+// again right away instead of after invalidations settled.
+type CacheInvalidation struct {
+	Until          time.Time `datastore:",noindex"`
+	ImmediateUntil time.Time `datastore:",noindex"`
+}
@@ -0,0 +1,53 @@
+package datastore
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	GuildAbsenceBenched = "benched"
+	GuildAbsenceExcused = "excused"
+)
+
+// GuildRosterMember is a raider on a guild roster, identified either by account name or, for characters that aren't
+// claimed by an account, by player ID.
+type GuildRosterMember struct {
+	Account  string
+	PlayerId int64
+	Name     string
+	Class    string
+	Server   string
+	Rank     string
+	Role     string
+}
+
+// GuildRaidAbsence records that a roster member didn't attend a raid of the guild, either because they were benched or
+// because they excused their absence in advance.
+type GuildRaidAbsence struct {
+	Code     string
+	Account  string
+	PlayerId int64
+	Kind     string
+	Note     string
+}
+
+type Guild struct {
+	Name         string
+	SearchName   string
+	Server       string
+	Faction      string
+	Flavour      string
+	LastScanTime time.Time
+	Roster       []GuildRosterMember `datastore:",noindex"`
+	Absences     []GuildRaidAbsence  `datastore:",noindex"`
+}
+
+// GuildMemberKey identifies a raider in the same way roster members are identified, by account name if they have one
+// and by player ID otherwise.
+func GuildMemberKey(account string, playerId int64) string {
+	if account != "" {
+		return "#" + account
+	}
+	return strconv.FormatInt(playerId, 10)
+}
@@ -0,0 +1,75 @@
+package datastore
+
+import (
+	"time"
+
+	google_datastore "cloud.google.com/go/datastore"
+)
+
+// GuildAggregateRaider counts the raids of a character in a guild. Account is the account claiming the character, if
+// any, and FirstRaid is the start time of the character's first raid with the guild.
+type GuildAggregateRaider struct {
+	PlayerId  int64
+	Name      string
+	Class     string
+	Server    string
+	Account   string
+	Count     int64
+	FirstRaid time.Time
+}
+
+// GuildAggregateAccount counts the raids of all characters claimed by an account in a guild.
+type GuildAggregateAccount struct {
+	Name  string
+	Count int64
+}
+
+// GuildAggregateRaid is one of the most recent raids of a guild, with its role composition and the IDs of its raiders
+// counted once each.
+type GuildAggregateRaid struct {
+	Code       string
+	StartTime  time.Time
+	EndTime    time.Time
+	Title      string
+	Zone       string
+	GuildName  string
+	NumPlayers int64
+	NumTanks   int64
+	NumHealers int64
+	NumDps     int64
+	RaiderIds  []int64
+}
+
+// GuildAggregateShard is stored as a guild_aggregate_shard entity below a guild aggregate, keyed by shard number. Every
+// report of a guild is counted in the shard picked by its code, so that reports of the same guild rarely write the same
+// entity. Shards count all raids of all raiders and accounts, but only keep the most recent raids themselves.
+type GuildAggregateShard struct {
+	NumRaids int64                   `datastore:",noindex"`
+	Raids    []GuildAggregateRaid    `datastore:",noindex"`
+	Raiders  []GuildAggregateRaider  `datastore:",noindex"`
+	Accounts []GuildAggregateAccount `datastore:",noindex"`
+}
+
+// GuildAggregate is the precomputed aggregate over all reports of a guild, keyed by guild ID. The counts and raids are
+// kept in a fixed number of shards and only filled in by aggregate.LoadGuildAggregate, which merges them. It is
+// maintained incrementally by the event pipeline and rebuilt from the report entities whenever Version is outdated.
+type GuildAggregate struct {
+	GuildName  string                  `datastore:"-"`
+	NumRaids   int64                   `datastore:"-"`
+	Raids      []GuildAggregateRaid    `datastore:"-"`
+	Raiders    []GuildAggregateRaider  `datastore:"-"`
+	Accounts   []GuildAggregateAccount `datastore:"-"`
+	UpdateTime time.Time               `datastore:",noindex"`
+	Version    int64                   `datastore:",noindex"`
+}
+
+// GuildAggregateKey identifies the aggregate of the guild with the given ID.
+func GuildAggregateKey(guildId int32) *google_datastore.Key {
+	return google_datastore.IDKey("guild_aggregate", int64(guildId), nil)
+}
+
+// GuildAggregateShardKey identifies a shard of a guild aggregate. Shards are numbered from zero, but stored with IDs
+// starting at one since datastore doesn't allow zero IDs.
+func GuildAggregateShardKey(guildAggregateKey *google_datastore.Key, shard int) *google_datastore.Key {
+	return google_datastore.IDKey("guild_aggregate_shard", int64(shard)+1, guildAggregateKey)
+}
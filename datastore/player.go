@@ -4,40 +4,76 @@ import (
 	"time"
 )
 
+// PlayerReport is stored as a player_report entity for each report of a player, keyed by report code with the player
+// as parent.
 type PlayerReport struct {
-	Code      string
-	Title     string
+	Code      string `datastore:",noindex"`
+	Title     string `datastore:",noindex"`
 	StartTime time.Time
-	EndTime   time.Time
-	Zone      string
+	EndTime   time.Time `datastore:",noindex"`
+	Zone      string    `datastore:",noindex"`
 	GuildId   int32
-	GuildName string
-	Spec      string
-	Role      string
-	Duplicate bool
-	Version   int32
+	GuildName string `datastore:",noindex"`
+	Spec      string `datastore:",noindex"`
+	Role      string `datastore:",noindex"`
+	Duplicate bool   `datastore:",noindex"`
+	Version   int32  `datastore:",noindex"`
 }
 
+// PlayerReportSideEffects is stored as a player_report_side_effects entity next to a player_report entity, keyed by
+// report code with the player as parent. It is written in the same transaction as the report and records the work that
+// has to happen outside of datastore afterwards, so that a retried update can finish it without counting the report
+// again. Revision is bumped whenever side effects of another update to the same report are merged in.
+type PlayerReportSideEffects struct {
+	CoraiderClaimIds []int64                 `datastore:",noindex"`
+	ReportClaim      bool                    `datastore:",noindex"`
+	FirstGuildRaid   bool                    `datastore:",noindex"`
+	Milestones       []PlayerReportMilestone `datastore:",noindex"`
+	Revision         int64                   `datastore:",noindex"`
+}
+
+// PlayerReportMilestone is a number of raids that the account of a player reached together with a coraider. The
+// coraider is either another account, named by CoraiderAccount, or an unclaimed character.
+type PlayerReportMilestone struct {
+	CoraiderAccount string `datastore:",noindex"`
+	CoraiderId      int64  `datastore:",noindex"`
+	CoraiderName    string `datastore:",noindex"`
+	CoraiderServer  string `datastore:",noindex"`
+	Count           int64  `datastore:",noindex"`
+}
+
+// PlayerCoraider is stored as a player_coraider entity for each coraider of a player, keyed by the coraider's player
+// ID with the player as parent.
 type PlayerCoraider struct {
-	Id     int64
-	Name   string
-	Class  string
-	Server string
-	Count  int64
+	Id     int64  `datastore:",noindex"`
+	Name   string `datastore:",noindex"`
+	Class  string `datastore:",noindex"`
+	Server string `datastore:",noindex"`
+	Count  int64  `datastore:",noindex"`
 }
 
+// PlayerCoraiderAccount is stored as a player_coraider_account entity for each coraider of a player that is claimed by
+// an account, keyed by the coraider's player ID with the player as parent.
 type PlayerCoraiderAccount struct {
-	Name     string
-	PlayerId int64
+	Name     string `datastore:",noindex"`
+	PlayerId int64  `datastore:",noindex"`
 }
 
+// Player stores the details of a character. Its reports, coraiders and coraider accounts are kept in child entities so
+// that the player entity stays small no matter how many raids it has. They are only filled in by LoadPlayerHistory.
+// Players before version 3 still store them in the legacy arrays, until they get migrated by MigratePlayer.
 type Player struct {
-	Name             string
-	Class            string
-	Server           string
-	Account          string
-	Reports          []PlayerReport          `datastore:",noindex"`
-	Coraiders        []PlayerCoraider        `datastore:",noindex"`
-	CoraiderAccounts []PlayerCoraiderAccount `datastore:",noindex"`
-	Version          int64
+	Name                   string
+	Class                  string
+	Server                 string
+	Account                string
+	SearchName             string
+	SearchAccount          string
+	Reports                []PlayerReport          `datastore:"-"`
+	Coraiders              []PlayerCoraider        `datastore:"-"`
+	CoraiderAccounts       []PlayerCoraiderAccount `datastore:"-"`
+	LegacyReports          []PlayerReport          `datastore:"Reports,noindex,omitempty"`
+	LegacyCoraiders        []PlayerCoraider        `datastore:"Coraiders,noindex,omitempty"`
+	LegacyCoraiderAccounts []PlayerCoraiderAccount `datastore:"CoraiderAccounts,noindex,omitempty"`
+	Version                int64
 }
@@ -0,0 +1,273 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	google_datastore "cloud.google.com/go/datastore"
+)
+
+const (
+	// PlayerVersion is the version of players that store their history in child entities.
+	PlayerVersion = 3
+
+	maxMigrationBatchSize       = 400
+	maxConcurrentHistoryLoaders = 16
+)
+
+// PlayerReportKey identifies the report of a player with the given code.
+func PlayerReportKey(playerKey *google_datastore.Key, code string) *google_datastore.Key {
+	return google_datastore.NameKey("player_report", code, playerKey)
+}
+
+// PlayerReportSideEffectsKey identifies the pending side effects of the report of a player with the given code.
+func PlayerReportSideEffectsKey(playerKey *google_datastore.Key, code string) *google_datastore.Key {
+	return google_datastore.NameKey("player_report_side_effects", code, playerKey)
+}
+
+// PlayerCoraiderKey identifies the coraider of a player with the given player ID.
+func PlayerCoraiderKey(playerKey *google_datastore.Key, coraiderId int64) *google_datastore.Key {
+	return google_datastore.IDKey("player_coraider", coraiderId, playerKey)
+}
+
+// PlayerCoraiderAccountKey identifies the account mapping of a coraider of a player with the given player ID.
+func PlayerCoraiderAccountKey(playerKey *google_datastore.Key, coraiderId int64) *google_datastore.Key {
+	return google_datastore.IDKey("player_coraider_account", coraiderId, playerKey)
+}
+
+// LoadPlayerHistory fills in the reports, coraiders and coraider accounts of a player from its child entities, or from
+// the legacy arrays if the player hasn't been migrated yet. Reports are ordered by descending start time.
+func LoadPlayerHistory(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	playerKey *google_datastore.Key,
+	player *Player,
+) error {
+	if player.Version < PlayerVersion {
+		player.Reports = append([]PlayerReport{}, player.LegacyReports...)
+		player.Coraiders = append([]PlayerCoraider{}, player.LegacyCoraiders...)
+		player.CoraiderAccounts = append([]PlayerCoraiderAccount{}, player.LegacyCoraiderAccounts...)
+	} else {
+		player.Reports = []PlayerReport{}
+		query := google_datastore.NewQuery("player_report").Ancestor(playerKey)
+		_, err := datastoreClient.GetAll(ctx, query, &player.Reports)
+		if err != nil {
+			return fmt.Errorf("datastore get reports of player %v failed: %v", playerKey.ID, err)
+		}
+
+		player.Coraiders = []PlayerCoraider{}
+		query = google_datastore.NewQuery("player_coraider").Ancestor(playerKey)
+		_, err = datastoreClient.GetAll(ctx, query, &player.Coraiders)
+		if err != nil {
+			return fmt.Errorf("datastore get coraiders of player %v failed: %v", playerKey.ID, err)
+		}
+
+		player.CoraiderAccounts = []PlayerCoraiderAccount{}
+		query = google_datastore.NewQuery("player_coraider_account").Ancestor(playerKey)
+		_, err = datastoreClient.GetAll(ctx, query, &player.CoraiderAccounts)
+		if err != nil {
+			return fmt.Errorf("datastore get coraider accounts of player %v failed: %v", playerKey.ID, err)
+		}
+	}
+
+	sort.SliceStable(player.Reports, func(i int, j int) bool {
+		return player.Reports[i].StartTime.After(player.Reports[j].StartTime)
+	})
+	return nil
+}
+
+// LoadPlayerReportsSince reads the reports of a player that started at or after a point in time, ordered by descending
+// start time. Unlike LoadPlayerHistory, it only reads the reports in the window from the player's child entities.
+func LoadPlayerReportsSince(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	playerKey *google_datastore.Key,
+	player Player,
+	since time.Time,
+) ([]PlayerReport, error) {
+	reports := []PlayerReport{}
+	if player.Version < PlayerVersion {
+		for _, report := range player.LegacyReports {
+			if !report.StartTime.Before(since) {
+				reports = append(reports, report)
+			}
+		}
+		sort.SliceStable(reports, func(i int, j int) bool {
+			return reports[i].StartTime.After(reports[j].StartTime)
+		})
+		return reports, nil
+	}
+
+	query := google_datastore.NewQuery("player_report").
+		Ancestor(playerKey).
+		FilterField("StartTime", ">=", since).
+		Order("-StartTime")
+	_, err := datastoreClient.GetAll(ctx, query, &reports)
+	if err != nil {
+		return nil, fmt.Errorf("datastore get reports of player %v failed: %v", playerKey.ID, err)
+	}
+	return reports, nil
+}
+
+// LoadPlayersHistory runs LoadPlayerHistory for a number of players concurrently.
+func LoadPlayersHistory(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	players map[int64]Player,
+) error {
+	playerIds := make([]int64, 0, len(players))
+	loaded := make([]Player, 0, len(players))
+	for playerId, player := range players {
+		playerIds = append(playerIds, playerId)
+		loaded = append(loaded, player)
+	}
+
+	errs := make([]error, len(playerIds))
+	semaphore := make(chan struct{}, maxConcurrentHistoryLoaders)
+	var wg sync.WaitGroup
+	for i := range playerIds {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			playerKey := google_datastore.IDKey("player", playerIds[i], nil)
+			errs[i] = LoadPlayerHistory(ctx, datastoreClient, playerKey, &loaded[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for i, playerId := range playerIds {
+		if errs[i] != nil {
+			return errs[i]
+		}
+		players[playerId] = loaded[i]
+	}
+	return nil
+}
+
+// MigratePlayer moves the legacy arrays of a player into child entities. The children are written in batches, each in
+// a transaction that makes sure the player hasn't been migrated by someone else in the meantime, since updates after
+// the migration must not be overwritten. Migrating a player that was already migrated does nothing.
+func MigratePlayer(ctx context.Context, datastoreClient *google_datastore.Client, playerId int64) error {
+	playerKey := google_datastore.IDKey("player", playerId, nil)
+	var player Player
+	err := datastoreClient.Get(ctx, playerKey, &player)
+	if err == google_datastore.ErrNoSuchEntity {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("datastore get player %v failed: %v", playerId, err)
+	}
+	if player.Version >= PlayerVersion {
+		return nil
+	}
+
+	keys := []*google_datastore.Key{}
+	children := []interface{}{}
+	// Players before version 2 are outdated and start over with an empty history.
+	if player.Version >= 2 {
+		for i := range player.LegacyReports {
+			keys = append(keys, PlayerReportKey(playerKey, player.LegacyReports[i].Code))
+			children = append(children, &player.LegacyReports[i])
+		}
+		for i := range player.LegacyCoraiders {
+			keys = append(keys, PlayerCoraiderKey(playerKey, player.LegacyCoraiders[i].Id))
+			children = append(children, &player.LegacyCoraiders[i])
+		}
+		for i := range player.LegacyCoraiderAccounts {
+			keys = append(keys, PlayerCoraiderAccountKey(playerKey, player.LegacyCoraiderAccounts[i].PlayerId))
+			children = append(children, &player.LegacyCoraiderAccounts[i])
+		}
+	}
+
+	for start := 0; start < len(keys); start += maxMigrationBatchSize {
+		end := start + maxMigrationBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		migrated, err := migratePlayerBatch(ctx, datastoreClient, playerKey, keys[start:end], children[start:end])
+		if err != nil {
+			return err
+		}
+		if migrated {
+			return nil
+		}
+	}
+
+	tx, err := datastoreClient.NewTransaction(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create transaction: %v", err)
+	}
+
+	player = Player{}
+	err = tx.Get(playerKey, &player)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("datastore get player %v failed: %v", playerId, err)
+	}
+	if player.Version >= PlayerVersion {
+		tx.Rollback()
+		return nil
+	}
+
+	player.LegacyReports = nil
+	player.LegacyCoraiders = nil
+	player.LegacyCoraiderAccounts = nil
+	player.Version = PlayerVersion
+	player.SearchName = PlayerSearchName(player.Name, player.Server)
+	player.SearchAccount = NormalizeSearch(player.Account)
+	_, err = tx.Put(playerKey, &player)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("datastore write player %v failed: %v", playerId, err)
+	}
+
+	_, err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("migrate player %v datastore transaction failed: %v", playerId, err)
+	}
+	return nil
+}
+
+// migratePlayerBatch writes a batch of child entities of a player, unless the player was migrated in the meantime, in
+// which case it returns true.
+func migratePlayerBatch(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	playerKey *google_datastore.Key,
+	keys []*google_datastore.Key,
+	children []interface{},
+) (bool, error) {
+	tx, err := datastoreClient.NewTransaction(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to create transaction: %v", err)
+	}
+
+	var player Player
+	err = tx.Get(playerKey, &player)
+	if err != nil {
+		tx.Rollback()
+		return false, fmt.Errorf("datastore get player %v failed: %v", playerKey.ID, err)
+	}
+	if player.Version >= PlayerVersion {
+		tx.Rollback()
+		return true, nil
+	}
+
+	_, err = tx.PutMulti(keys, children)
+	if err != nil {
+		tx.Rollback()
+		return false, fmt.Errorf("datastore write history of player %v failed: %v", playerKey.ID, err)
+	}
+
+	_, err = tx.Commit()
+	if err != nil {
+		return false, fmt.Errorf("migrate player %v datastore transaction failed: %v", playerKey.ID, err)
+	}
+	return false, nil
+}
@@ -0,0 +1,63 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	google_datastore "cloud.google.com/go/datastore"
+)
+
+const (
+	// ProcessedEventTtl is how long processed events are remembered, which covers the retention of unacknowledged
+	// pubsub messages.
+	ProcessedEventTtl = 7 * 24 * time.Hour
+)
+
+// ProcessedEvent records that an event was processed successfully by a handler, keyed by handler name and event ID.
+// ExpireTime is meant to be configured as the TTL field of the processed_event kind, so that old records get deleted.
+type ProcessedEvent struct {
+	ProcessTime time.Time `datastore:",noindex"`
+	ExpireTime  time.Time
+}
+
+// ProcessedEventKey identifies the record of an event processed by a handler.
+func ProcessedEventKey(handler string, eventId string) *google_datastore.Key {
+	return google_datastore.NameKey("processed_event", handler+"/"+eventId, nil)
+}
+
+// IsEventProcessed checks whether a handler already processed an event. Records past their expiry time are ignored,
+// since TTL deletion can lag behind.
+func IsEventProcessed(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	handler string,
+	eventId string,
+) (bool, error) {
+	var processedEvent ProcessedEvent
+	err := datastoreClient.Get(ctx, ProcessedEventKey(handler, eventId), &processedEvent)
+	if err == google_datastore.ErrNoSuchEntity {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("datastore get processed event %v/%v failed: %v", handler, eventId, err)
+	}
+	return processedEvent.ExpireTime.After(time.Now()), nil
+}
+
+// MarkEventProcessed records that a handler processed an event.
+func MarkEventProcessed(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	handler string,
+	eventId string,
+) error {
+	now := time.Now()
+	_, err := datastoreClient.Put(ctx, ProcessedEventKey(handler, eventId), &ProcessedEvent{
+		ProcessTime: now,
+		ExpireTime:  now.Add(ProcessedEventTtl),
+	})
+	if err != nil {
+		return fmt.Errorf("datastore write processed event %v/%v failed: %v", handler, eventId, err)
+	}
+	return nil
+}
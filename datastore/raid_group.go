@@ -0,0 +1,30 @@
+package datastore
+
+import (
+	"time"
+)
+
+type RaidGroupMember struct {
+	Account  string
+	PlayerId int64
+	Name     string
+	Class    string
+	Server   string
+	Count    int64
+}
+
+type RaidGroupGuild struct {
+	GuildId   int32
+	GuildName string
+	Count     int64
+}
+
+type RaidGroup struct {
+	CreationTime   time.Time
+	NumRaids       int64
+	FirstRaid      time.Time
+	LastRaid       time.Time
+	MemberAccounts []string
+	Members        []RaidGroupMember `datastore:",noindex"`
+	Guilds         []RaidGroupGuild  `datastore:",noindex"`
+}
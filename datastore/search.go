@@ -0,0 +1,19 @@
+package datastore
+
+import (
+	"strings"
+)
+
+// SearchPrefixEnd is appended to a normalized search prefix to form the exclusive upper bound of a prefix range query.
+const SearchPrefixEnd = "\ufffd"
+
+// NormalizeSearch normalizes a name for case insensitive prefix matching.
+func NormalizeSearch(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// PlayerSearchName normalizes a character name together with its server, so that prefix matching on the name also
+// allows narrowing down the server.
+func PlayerSearchName(name string, server string) string {
+	return NormalizeSearch(name + "-" + server)
+}
@@ -0,0 +1,59 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	google_datastore "cloud.google.com/go/datastore"
+)
+
+const (
+	maxTransactionAttempts    = 5
+	transactionRetryBaseDelay = 50 * time.Millisecond
+)
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+// RunTransaction runs f in a new transaction and commits it. If the commit fails because of a concurrent transaction
+// on the same entities, the whole transaction is retried a bounded number of times with jittered exponential backoff,
+// so that contending event handlers don't all retry at the same moment. Since f is called again from scratch on every
+// attempt, it must reset any state it captures and must not have side effects outside of the transaction. Errors
+// returned by f roll back the transaction and are returned unchanged.
+func RunTransaction(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	f func(tx *google_datastore.Transaction) error,
+) error {
+	delay := transactionRetryBaseDelay
+	for attempt := 1; ; attempt++ {
+		tx, err := datastoreClient.NewTransaction(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to create transaction: %v", err)
+		}
+
+		err = f(tx)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		_, err = tx.Commit()
+		if err != google_datastore.ErrConcurrentTransaction {
+			return err
+		}
+		if attempt >= maxTransactionAttempts {
+			return fmt.Errorf("transaction still conflicting after %v attempts: %v", attempt, err)
+		}
+
+		select {
+		case <-time.After(delay/2 + time.Duration(rand.Int63n(int64(delay)))):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay *= 2
+	}
+}
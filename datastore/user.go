@@ -0,0 +1,27 @@
+package datastore
+
+import (
+	"strings"
+	"time"
+)
+
+type UserCharacter struct {
+	Id     int32
+	Name   string
+	Server string
+}
+
+type User struct {
+	Name          string
+	UpdatedAt     time.Time
+	CharacterKeys []string
+	Characters    []UserCharacter `datastore:",noindex"`
+	// Guilds in which the user was an officer or guild master when they last logged in.
+	OfficerGuildIds []int32 `datastore:",noindex"`
+}
+
+// UserCharacterKey normalizes a character name and server so that Warcraft Logs characters can be matched against
+// players from reports, which don't always agree on the spelling of server names.
+func UserCharacterKey(name string, server string) string {
+	return strings.ToLower(strings.ReplaceAll(name+"-"+server, " ", ""))
+}
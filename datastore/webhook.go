@@ -0,0 +1,39 @@
+package datastore
+
+import (
+	"fmt"
+	"time"
+
+	google_datastore "cloud.google.com/go/datastore"
+)
+
+// WebhookSubscription is an external URL that gets notified about events of the given types. Events are only delivered
+// if they match all of the filters that are set. UserId is the Warcraft Logs user that created the subscription.
+type WebhookSubscription struct {
+	UserId      int32
+	Url         string
+	Format      string
+	Secret      string `datastore:",noindex"`
+	EventTypes  []string
+	GuildId     int32
+	AccountName string
+	PlayerId    int64
+	Milestones  []int64 `datastore:",noindex"`
+	CreatedAt   time.Time
+}
+
+// WebhookMilestone is stored as a webhook_milestone entity for every coraider milestone that was fired, keyed by the
+// pair of accounts or characters and the number of raids. Both sides of a pair count their raids together, so this
+// makes sure that only one of them fires the milestone.
+type WebhookMilestone struct {
+	CreatedAt time.Time `datastore:",noindex"`
+}
+
+// WebhookMilestoneKey identifies the milestone of two accounts or characters reaching the given number of raids
+// together. The order of the pair doesn't matter.
+func WebhookMilestoneKey(first string, second string, count int64) *google_datastore.Key {
+	if second < first {
+		first, second = second, first
+	}
+	return google_datastore.NameKey("webhook_milestone", fmt.Sprintf("%q %q %v", first, second, count), nil)
+}
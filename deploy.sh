@@ -3,11 +3,24 @@ gcloud storage cp source.zip gs://raidlogscan_sources/source.zip
 
 gcloud functions deploy accountstats --gen2 --runtime=go116 --region=europe-west2 --source=gs://raidlogscan_sources/source.zip --entry-point=AccountStats --trigger-http --allow-unauthenticated
 gcloud functions deploy claimaccount --gen2 --runtime=go116 --region=europe-west2 --source=gs://raidlogscan_sources/source.zip --entry-point=ClaimAccount --trigger-http --allow-unauthenticated
+gcloud functions deploy claimusercharacters --gen2 --runtime=go116 --region=europe-west2 --source=gs://raidlogscan_sources/source.zip --entry-point=ClaimUserCharacters --trigger-http --allow-unauthenticated
 gcloud functions deploy playerstats --gen2 --runtime=go116 --region=europe-west2 --source=gs://raidlogscan_sources/source.zip --entry-point=PlayerStats --trigger-http --allow-unauthenticated
 gcloud functions deploy guildstats --gen2 --runtime=go116 --region=europe-west2 --source=gs://raidlogscan_sources/source.zip --entry-point=GuildStats --trigger-http --allow-unauthenticated
+gcloud functions deploy reportstats --gen2 --runtime=go116 --region=europe-west2 --source=gs://raidlogscan_sources/source.zip --entry-point=ReportStats --trigger-http --allow-unauthenticated
+gcloud functions deploy guildroster --gen2 --runtime=go116 --region=europe-west2 --source=gs://raidlogscan_sources/source.zip --entry-point=GuildRoster --trigger-http --allow-unauthenticated
+gcloud functions deploy raidnetwork --gen2 --runtime=go116 --region=europe-west2 --source=gs://raidlogscan_sources/source.zip --entry-point=RaidNetwork --trigger-http --allow-unauthenticated
+gcloud functions deploy raidgroups --gen2 --runtime=go116 --region=europe-west2 --source=gs://raidlogscan_sources/source.zip --entry-point=RaidGroups --trigger-http --allow-unauthenticated
+gcloud functions deploy raidcalendar --gen2 --runtime=go116 --region=europe-west2 --source=gs://raidlogscan_sources/source.zip --entry-point=RaidCalendar --trigger-http --allow-unauthenticated
+gcloud functions deploy reportfeed --gen2 --runtime=go116 --region=europe-west2 --source=gs://raidlogscan_sources/source.zip --entry-point=ReportFeed --trigger-http --allow-unauthenticated
+gcloud functions deploy migrateplayers --gen2 --runtime=go116 --region=europe-west2 --source=gs://raidlogscan_sources/source.zip --entry-point=MigratePlayers --trigger-http --no-allow-unauthenticated
+gcloud functions deploy backfillsearch --gen2 --runtime=go116 --region=europe-west2 --source=gs://raidlogscan_sources/source.zip --entry-point=BackfillSearch --trigger-http --no-allow-unauthenticated
+gcloud functions deploy search --gen2 --runtime=go116 --region=europe-west2 --source=gs://raidlogscan_sources/source.zip --entry-point=Search --trigger-http --allow-unauthenticated
+gcloud functions deploy webhooks --gen2 --runtime=go116 --region=europe-west2 --source=gs://raidlogscan_sources/source.zip --entry-point=Webhooks --trigger-http --allow-unauthenticated
+gcloud functions deploy discordinteractions --gen2 --runtime=go116 --region=europe-west2 --source=gs://raidlogscan_sources/source.zip --entry-point=DiscordInteractions --trigger-http --allow-unauthenticated
 gcloud functions deploy oauth2login --gen2 --runtime=go116 --region=europe-west2 --source=gs://raidlogscan_sources/source.zip --entry-point=Oauth2Login --trigger-http --allow-unauthenticated
 gcloud functions deploy oauth2callback --gen2 --runtime=go116 --region=europe-west2 --source=gs://raidlogscan_sources/source.zip --entry-point=Oauth2Callback --trigger-http --allow-unauthenticated
 gcloud functions deploy scanuserreports --gen2 --runtime=go116 --region=europe-west2 --source=gs://raidlogscan_sources/source.zip --entry-point=ScanUserReports --trigger-http --allow-unauthenticated
+gcloud functions deploy scanreports --gen2 --runtime=go116 --region=europe-west2 --source=gs://raidlogscan_sources/source.zip --entry-point=ScanReports --trigger-http --allow-unauthenticated
 gcloud functions deploy scanguildreports --gen2 --runtime=go116 --region=europe-west2 --source=gs://raidlogscan_sources/source.zip --entry-point=ScanGuildReports --trigger-http --allow-unauthenticated
 gcloud functions deploy scanrecentcharacterreports --gen2 --runtime=go116 --region=europe-west2 --source=gs://raidlogscan_sources/source.zip --entry-point=ScanRecentCharacterReports --trigger-http --allow-unauthenticated
 
@@ -18,3 +31,5 @@ gcloud functions deploy fetchreport2 --gen2 --runtime=go116 --region=europe-west
 gcloud functions deploy updateplayerreport --gen2 --runtime=go116 --region=europe-west2 --source=gs://raidlogscan_sources/source.zip --entry-point=UpdatePlayerReport --retry --trigger-topic=playerreport
 gcloud functions deploy fetchuserreports --gen2 --runtime=go116 --region=europe-west2 --source=gs://raidlogscan_sources/source.zip --entry-point=FetchUserReports --retry --trigger-topic=userreports
 gcloud functions deploy fetchrecentcharacterreports --gen2 --runtime=go116 --region=europe-west2 --source=gs://raidlogscan_sources/source.zip --entry-point=FetchRecentCharacterReports --retry --trigger-topic=recentcharacterreports
+gcloud functions deploy detectraidgroups --gen2 --runtime=go116 --region=europe-west2 --source=gs://raidlogscan_sources/source.zip --entry-point=DetectRaidGroups --trigger-topic=raidgroups
+gcloud functions deploy deliverwebhook --gen2 --runtime=go116 --region=europe-west2 --source=gs://raidlogscan_sources/source.zip --entry-point=DeliverWebhook --retry --trigger-topic=webhookdelivery
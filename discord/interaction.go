@@ -0,0 +1,102 @@
+package discord
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	InteractionTypePing               = 1
+	InteractionTypeApplicationCommand = 2
+
+	ResponseTypePong                     = 1
+	ResponseTypeChannelMessageWithSource = 4
+
+	MessageFlagEphemeral = 64
+
+	EmbedColor = 0xc69b6d
+)
+
+type Interaction struct {
+	Type int             `json:"type"`
+	Data InteractionData `json:"data"`
+}
+
+type InteractionData struct {
+	Name    string              `json:"name"`
+	Options []InteractionOption `json:"options"`
+}
+
+// InteractionOption is either a subcommand with nested options, or an option carrying a value of any JSON type.
+type InteractionOption struct {
+	Name    string              `json:"name"`
+	Type    int                 `json:"type"`
+	Value   json.RawMessage     `json:"value,omitempty"`
+	Options []InteractionOption `json:"options,omitempty"`
+}
+
+type InteractionResponse struct {
+	Type int                      `json:"type"`
+	Data *InteractionResponseData `json:"data,omitempty"`
+}
+
+type InteractionResponseData struct {
+	Content string  `json:"content,omitempty"`
+	Embeds  []Embed `json:"embeds,omitempty"`
+	Flags   int     `json:"flags,omitempty"`
+}
+
+type Embed struct {
+	Title       string       `json:"title"`
+	Description string       `json:"description,omitempty"`
+	Url         string       `json:"url,omitempty"`
+	Timestamp   string       `json:"timestamp,omitempty"`
+	Color       int          `json:"color,omitempty"`
+	Fields      []EmbedField `json:"fields,omitempty"`
+}
+
+type EmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+// StringValue returns the value of an option as a string. Integer options are returned in their decimal form.
+func (option InteractionOption) StringValue() string {
+	var value string
+	if err := json.Unmarshal(option.Value, &value); err == nil {
+		return value
+	}
+	return string(option.Value)
+}
+
+// FindOption returns the option with the given name, if present.
+func FindOption(options []InteractionOption, name string) (InteractionOption, bool) {
+	for _, option := range options {
+		if option.Name == name {
+			return option, true
+		}
+	}
+	return InteractionOption{}, false
+}
+
+// VerifySignature checks the Ed25519 signature Discord puts on every interaction request, which is computed over the
+// request timestamp followed by the raw body.
+func VerifySignature(publicKeyHex string, signatureHex string, timestamp string, body []byte) error {
+	publicKey, err := hex.DecodeString(publicKeyHex)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid public key")
+	}
+	signature, err := hex.DecodeString(signatureHex)
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return fmt.Errorf("invalid signature encoding")
+	}
+
+	message := append([]byte(timestamp), body...)
+	if !ed25519.Verify(ed25519.PublicKey(publicKey), message, signature) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 
 	google_datastore "cloud.google.com/go/datastore"
+	"github.com/FabianHahn/raidlogscan/aggregate"
 	"github.com/FabianHahn/raidlogscan/cache"
 	"github.com/FabianHahn/raidlogscan/datastore"
 	"github.com/FabianHahn/raidlogscan/pubsub"
@@ -18,50 +19,80 @@ func CoraiderAccountClaim(ctx context.Context, e google_event.Event, datastoreCl
 		return err
 	}
 
-	playerKey := google_datastore.IDKey("player", coraiderAccountClaimEvent.PlayerId, nil)
-	tx, err := datastoreClient.NewTransaction(ctx)
+	err = datastore.MigratePlayer(ctx, datastoreClient, coraiderAccountClaimEvent.PlayerId)
 	if err != nil {
-		return fmt.Errorf("failed to create transaction: %v", err.Error())
-	}
-
-	var player datastore.Player
-	err = tx.Get(playerKey, &player)
-	if err != nil {
-		tx.Rollback()
 		return fmt.Errorf(
-			"for coraider account claim %v/%v datastore get player %v failed: %v",
+			"for coraider account claim %v/%v failed to migrate player %v: %v",
 			coraiderAccountClaimEvent.ClaimedAccountName,
 			coraiderAccountClaimEvent.ClaimedPlayerId,
 			coraiderAccountClaimEvent.PlayerId,
 			err.Error())
 	}
 
-	found := false
-	for i := range player.CoraiderAccounts {
-		if player.CoraiderAccounts[i].PlayerId == coraiderAccountClaimEvent.ClaimedPlayerId {
-			player.CoraiderAccounts[i].Name = coraiderAccountClaimEvent.ClaimedAccountName
-			found = true
-			break
+	playerKey := google_datastore.IDKey("player", coraiderAccountClaimEvent.PlayerId, nil)
+	var player datastore.Player
+	err = datastore.RunTransaction(ctx, datastoreClient, func(tx *google_datastore.Transaction) error {
+		player = datastore.Player{}
+		err := tx.Get(playerKey, &player)
+		if err != nil {
+			return fmt.Errorf(
+				"for coraider account claim %v/%v datastore get player %v failed: %v",
+				coraiderAccountClaimEvent.ClaimedAccountName,
+				coraiderAccountClaimEvent.ClaimedPlayerId,
+				coraiderAccountClaimEvent.PlayerId,
+				err.Error())
+		}
+
+		// Claims are broadcast again whenever a report is retried, so skip the writes if nothing changed.
+		coraiderAccountKey := datastore.PlayerCoraiderAccountKey(playerKey, coraiderAccountClaimEvent.ClaimedPlayerId)
+		var coraiderAccount datastore.PlayerCoraiderAccount
+		err = tx.Get(coraiderAccountKey, &coraiderAccount)
+		if err == nil && coraiderAccount.Name == coraiderAccountClaimEvent.ClaimedAccountName {
+			return nil
+		} else if err != nil && err != google_datastore.ErrNoSuchEntity {
+			return fmt.Errorf(
+				"for coraider account claim %v/%v datastore get coraider account of player %v failed: %v",
+				coraiderAccountClaimEvent.ClaimedAccountName,
+				coraiderAccountClaimEvent.ClaimedPlayerId,
+				coraiderAccountClaimEvent.PlayerId,
+				err.Error())
 		}
-	}
-	if !found {
-		player.CoraiderAccounts = append(player.CoraiderAccounts, datastore.PlayerCoraiderAccount{
+
+		_, err = tx.Put(coraiderAccountKey, &datastore.PlayerCoraiderAccount{
 			PlayerId: coraiderAccountClaimEvent.ClaimedPlayerId,
 			Name:     coraiderAccountClaimEvent.ClaimedAccountName,
 		})
-	}
-
-	_, err = tx.Put(playerKey, &player)
-	if err != nil {
-		return fmt.Errorf(
-			"for coraider account claim %v/%v datastore write player %v failed: %v",
-			coraiderAccountClaimEvent.ClaimedAccountName,
-			coraiderAccountClaimEvent.ClaimedPlayerId,
-			coraiderAccountClaimEvent.PlayerId,
-			err.Error())
-	}
+		if err != nil {
+			return fmt.Errorf(
+				"for coraider account claim %v/%v datastore write coraider account of player %v failed: %v",
+				coraiderAccountClaimEvent.ClaimedAccountName,
+				coraiderAccountClaimEvent.ClaimedPlayerId,
+				coraiderAccountClaimEvent.PlayerId,
+				err.Error())
+		}
 
-	_, err = tx.Commit()
+		if player.Account != "" {
+			err = aggregate.UpdateAccount(tx, player.Account, func(
+				tx *google_datastore.Transaction,
+				accountKey *google_datastore.Key,
+				account *datastore.Account,
+			) (bool, error) {
+				return aggregate.SetAccountCoraiderAccount(
+					account,
+					coraiderAccountClaimEvent.ClaimedPlayerId,
+					coraiderAccountClaimEvent.ClaimedAccountName), nil
+			})
+			if err != nil {
+				return fmt.Errorf(
+					"for coraider account claim %v/%v update account of player %v failed: %v",
+					coraiderAccountClaimEvent.ClaimedAccountName,
+					coraiderAccountClaimEvent.ClaimedPlayerId,
+					coraiderAccountClaimEvent.PlayerId,
+					err.Error())
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		return fmt.Errorf(
 			"coraider account claim %v/%v player %v datastore transaction failed: %v",
@@ -78,6 +109,11 @@ func CoraiderAccountClaim(ctx context.Context, e google_event.Event, datastoreCl
 		}
 	}
 
+	err = cache.InvalidatePlayerStatsCache(ctx, datastoreClient, coraiderAccountClaimEvent.PlayerId)
+	if err != nil {
+		return fmt.Errorf("failed to invalidate player stats cache for %v: %v", coraiderAccountClaimEvent.PlayerId, err)
+	}
+
 	log.Printf(
 		"Updated coraider account claim %v/%v for player %v.\n",
 		coraiderAccountClaimEvent.ClaimedAccountName,
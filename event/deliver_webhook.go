@@ -0,0 +1,66 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	google_datastore "cloud.google.com/go/datastore"
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"github.com/FabianHahn/raidlogscan/pubsub"
+	"github.com/FabianHahn/raidlogscan/webhook"
+	google_event "github.com/cloudevents/sdk-go/v2/event"
+)
+
+const (
+	// Deliveries that keep failing are given up on after this long, rather than retried until pubsub drops them.
+	maxWebhookDeliveryAge = 6 * time.Hour
+)
+
+// DeliverWebhook delivers a webhook event to a single subscription. Failures worth retrying are returned so that
+// pubsub retries them with backoff, everything else is only logged.
+func DeliverWebhook(ctx context.Context, e google_event.Event, datastoreClient *google_datastore.Client) error {
+	webhookDeliveryEvent, err := pubsub.ParseWebhookDeliveryEvent(e)
+	if err != nil {
+		return err
+	}
+
+	var webhookEvent webhook.Event
+	err = json.Unmarshal(webhookDeliveryEvent.Payload, &webhookEvent)
+	if err != nil {
+		log.Printf("Dropping malformed webhook event for subscription %v: %v\n", webhookDeliveryEvent.SubscriptionId, err)
+		return nil // no error
+	}
+
+	subscriptionKey := google_datastore.IDKey("webhook_subscription", webhookDeliveryEvent.SubscriptionId, nil)
+	var subscription datastore.WebhookSubscription
+	err = datastoreClient.Get(ctx, subscriptionKey, &subscription)
+	if err == google_datastore.ErrNoSuchEntity {
+		log.Printf("Webhook subscription %v was deleted, dropping %v event.\n",
+			webhookDeliveryEvent.SubscriptionId,
+			webhookEvent.Type)
+		return nil // no error
+	} else if err != nil {
+		return fmt.Errorf("datastore get webhook subscription %v failed: %v", webhookDeliveryEvent.SubscriptionId, err)
+	}
+
+	retry, err := webhook.Deliver(ctx, subscription, webhookEvent)
+	if err != nil {
+		if retry && (e.Time().IsZero() || time.Since(e.Time()) < maxWebhookDeliveryAge) {
+			return fmt.Errorf("failed to deliver %v event to webhook subscription %v: %v",
+				webhookEvent.Type,
+				webhookDeliveryEvent.SubscriptionId,
+				err)
+		}
+		log.Printf("Giving up delivering %v event to webhook subscription %v: %v\n",
+			webhookEvent.Type,
+			webhookDeliveryEvent.SubscriptionId,
+			err)
+		return nil // no error
+	}
+
+	log.Printf("Delivered %v event to webhook subscription %v.\n", webhookEvent.Type, webhookDeliveryEvent.SubscriptionId)
+	return nil
+}
@@ -0,0 +1,32 @@
+package event
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+const (
+	testDeliverWebhookSubscriptionId = "1"
+)
+
+func TestDeliverWebhookMalformedEvent(t *testing.T) {
+	message := MessagePublishedData{
+		Message: PubSubMessage{
+			Attributes: map[string]interface{}{
+				"subscription_id": testDeliverWebhookSubscriptionId,
+			},
+		},
+	}
+
+	e := event.New()
+	e.SetDataContentType("application/json")
+	e.SetData(e.DataContentType(), message)
+
+	// Events without a payload are dropped before the subscription is even loaded.
+	err := DeliverWebhook(context.Background(), e, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
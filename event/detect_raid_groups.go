@@ -0,0 +1,203 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	google_datastore "cloud.google.com/go/datastore"
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"github.com/FabianHahn/raidlogscan/network"
+	google_event "github.com/cloudevents/sdk-go/v2/event"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	minRaidGroupEdgeWeight    = 5
+	minRaidGroupSize          = 5
+	raidGroupPresenceFraction = 0.5
+	maxDatastoreMutationKeys  = 500
+)
+
+type raidGroupReport struct {
+	StartTime    time.Time
+	GuildId      int32
+	GuildName    string
+	Participants map[string]struct{}
+}
+
+// DetectRaidGroups clusters everyone who was ever seen in a report by how often they raided together, and replaces
+// all raid_group entities with the stable groups found. It is meant to be triggered periodically.
+func DetectRaidGroups(ctx context.Context, e google_event.Event, datastoreClient *google_datastore.Client) error {
+	builder := network.CreateBuilder()
+	members := map[string]datastore.RaidGroupMember{}
+	reports := []raidGroupReport{}
+	query := google_datastore.NewQuery("report")
+	responseIter := datastoreClient.Run(ctx, query)
+	for {
+		var report datastore.Report
+		_, err := responseIter.Next(&report)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("datastore report query failed: %v", err)
+		}
+
+		if !report.EndTime.After(report.StartTime) {
+			continue
+		}
+
+		playerAccounts := map[int64]string{}
+		for _, playerAccount := range report.PlayerAccounts {
+			playerAccounts[playerAccount.PlayerId] = playerAccount.Name
+		}
+
+		participants := map[string]struct{}{}
+		for _, player := range report.Players {
+			var id string
+			if account, ok := playerAccounts[player.Id]; ok {
+				id = builder.AddAccountNode(account, false)
+				members[id] = datastore.RaidGroupMember{
+					Account: account,
+				}
+			} else {
+				id = builder.AddPlayerNode(player.Id, player.Name, player.Class, player.Server, false)
+				members[id] = datastore.RaidGroupMember{
+					PlayerId: player.Id,
+					Name:     player.Name,
+					Class:    player.Class,
+					Server:   player.Server,
+				}
+			}
+			participants[id] = struct{}{}
+		}
+
+		participantIds := []string{}
+		for id := range participants {
+			participantIds = append(participantIds, id)
+		}
+		for i := range participantIds {
+			for j := i + 1; j < len(participantIds); j++ {
+				builder.AddEdgeWeight(participantIds[i], participantIds[j], 1)
+			}
+		}
+
+		reports = append(reports, raidGroupReport{
+			StartTime:    report.StartTime,
+			GuildId:      report.GuildId,
+			GuildName:    report.GuildName,
+			Participants: participants,
+		})
+	}
+
+	communities := network.DetectCommunities(builder.Build(minRaidGroupEdgeWeight), minRaidGroupSize)
+
+	creationTime := time.Now()
+	raidGroups := []datastore.RaidGroup{}
+	for _, community := range communities {
+		raidGroup := datastore.RaidGroup{
+			CreationTime: creationTime,
+		}
+		memberCounts := map[string]int64{}
+		guilds := map[int32]datastore.RaidGroupGuild{}
+		for _, report := range reports {
+			present := []string{}
+			for _, id := range community {
+				if _, ok := report.Participants[id]; ok {
+					present = append(present, id)
+				}
+			}
+			if float64(len(present)) < raidGroupPresenceFraction*float64(len(community)) {
+				continue
+			}
+
+			raidGroup.NumRaids++
+			if raidGroup.FirstRaid.IsZero() || report.StartTime.Before(raidGroup.FirstRaid) {
+				raidGroup.FirstRaid = report.StartTime
+			}
+			if report.StartTime.After(raidGroup.LastRaid) {
+				raidGroup.LastRaid = report.StartTime
+			}
+			for _, id := range present {
+				memberCounts[id]++
+			}
+			if report.GuildId != 0 {
+				guild := guilds[report.GuildId]
+				guild.GuildId = report.GuildId
+				guild.GuildName = report.GuildName
+				guild.Count++
+				guilds[report.GuildId] = guild
+			}
+		}
+		if raidGroup.NumRaids == 0 {
+			continue
+		}
+
+		for _, id := range community {
+			member := members[id]
+			member.Count = memberCounts[id]
+			raidGroup.Members = append(raidGroup.Members, member)
+			if member.Account != "" {
+				raidGroup.MemberAccounts = append(raidGroup.MemberAccounts, member.Account)
+			}
+		}
+		sort.SliceStable(raidGroup.Members, func(i int, j int) bool {
+			return raidGroup.Members[i].Count > raidGroup.Members[j].Count
+		})
+
+		for _, guild := range guilds {
+			raidGroup.Guilds = append(raidGroup.Guilds, guild)
+		}
+		sort.SliceStable(raidGroup.Guilds, func(i int, j int) bool {
+			return raidGroup.Guilds[i].Count > raidGroup.Guilds[j].Count
+		})
+
+		raidGroups = append(raidGroups, raidGroup)
+	}
+
+	// New groups overwrite the old ones with the same IDs before the remaining stale groups are deleted, so that readers
+	// never see an empty list and a failure in between leaves a complete set of groups behind.
+	newKeys := map[int64]struct{}{}
+	for start := 0; start < len(raidGroups); start += maxDatastoreMutationKeys {
+		end := start + maxDatastoreMutationKeys
+		if end > len(raidGroups) {
+			end = len(raidGroups)
+		}
+		keys := []*google_datastore.Key{}
+		for i := start; i < end; i++ {
+			keys = append(keys, google_datastore.IDKey("raid_group", int64(i+1), nil))
+			newKeys[int64(i+1)] = struct{}{}
+		}
+		_, err := datastoreClient.PutMulti(ctx, keys, raidGroups[start:end])
+		if err != nil {
+			return fmt.Errorf("datastore raid group write failed: %v", err)
+		}
+	}
+
+	oldKeys, err := datastoreClient.GetAll(ctx, google_datastore.NewQuery("raid_group").KeysOnly(), nil)
+	if err != nil {
+		return fmt.Errorf("datastore raid group query failed: %v", err)
+	}
+	staleKeys := []*google_datastore.Key{}
+	for _, key := range oldKeys {
+		if _, ok := newKeys[key.ID]; !ok {
+			staleKeys = append(staleKeys, key)
+		}
+	}
+	for start := 0; start < len(staleKeys); start += maxDatastoreMutationKeys {
+		end := start + maxDatastoreMutationKeys
+		if end > len(staleKeys) {
+			end = len(staleKeys)
+		}
+		err = datastoreClient.DeleteMulti(ctx, staleKeys[start:end])
+		if err != nil {
+			return fmt.Errorf("datastore raid group delete failed: %v", err)
+		}
+	}
+
+	log.Printf("Detected %v raid groups in %v reports.\n", len(raidGroups), len(reports))
+	return nil
+}
@@ -2,10 +2,14 @@ package event
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"time"
 
+	google_datastore "cloud.google.com/go/datastore"
 	google_pubsub "cloud.google.com/go/pubsub"
 	graphql_lib "github.com/FabianHahn/graphql"
+	"github.com/FabianHahn/raidlogscan/datastore"
 	"github.com/FabianHahn/raidlogscan/graphql"
 	"github.com/FabianHahn/raidlogscan/pubsub"
 	google_event "github.com/cloudevents/sdk-go/v2/event"
@@ -14,6 +18,7 @@ import (
 func FetchGuildReports(
 	ctx context.Context,
 	e google_event.Event,
+	datastoreClient *google_datastore.Client,
 	pubsubClient *google_pubsub.Client,
 	graphqlClient *graphql_lib.Client,
 ) error {
@@ -22,16 +27,51 @@ func FetchGuildReports(
 		return err
 	}
 
+	guildData, err := graphql.QueryGuildData(graphqlClient, ctx, guildId)
+	if err != nil {
+		return err
+	}
+
 	reports, pages, err := graphql.QueryGuildReports(graphqlClient, ctx, guildId)
 	if err != nil {
 		return err
 	}
 
-	err = pubsub.PublishReportEvents(pubsubClient, ctx, reports)
+	err = pubsub.PublishReportEvents(pubsubClient, ctx, pubsub.ParseEventId(e), reports)
 	if err != nil {
 		return err
 	}
 
-	log.Printf("Fetched %v reports in %v pages.\n", len(reports), pages)
+	guildKey := google_datastore.IDKey("guild", guildId, nil)
+	tx, err := datastoreClient.NewTransaction(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create transaction: %v", err.Error())
+	}
+
+	var guild datastore.Guild
+	err = tx.Get(guildKey, &guild)
+	if err != nil && err != google_datastore.ErrNoSuchEntity {
+		tx.Rollback()
+		return fmt.Errorf("datastore get guild %v failed: %v", guildId, err.Error())
+	}
+
+	guild.Name = guildData.Name
+	guild.SearchName = datastore.NormalizeSearch(guildData.Name)
+	guild.Server = guildData.Server
+	guild.Faction = guildData.Faction
+	guild.Flavour = graphql.Flavour
+	guild.LastScanTime = time.Now()
+	_, err = tx.Put(guildKey, &guild)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("datastore write guild %v failed: %v", guildId, err.Error())
+	}
+
+	_, err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("guild %v datastore transaction failed: %v", guildId, err.Error())
+	}
+
+	log.Printf("Fetched %v reports in %v pages for guild %v.\n", len(reports), pages, guildData.Name)
 	return nil
 }
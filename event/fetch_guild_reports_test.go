@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	google_pubsub "cloud.google.com/go/pubsub"
+	"github.com/FabianHahn/raidlogscan/datastore"
 	"github.com/FabianHahn/raidlogscan/graphql"
 	"github.com/FabianHahn/raidlogscan/pubsub"
 	"github.com/cloudevents/sdk-go/v2/event"
@@ -35,9 +36,10 @@ func TestFetchGuildReports(t *testing.T) {
 	e.SetDataContentType("application/json")
 	e.SetData(e.DataContentType(), message)
 
+	datastoreClient := datastore.CreateDatastoreClientOrDie()
 	pubsubClient := pubsub.CreatePubsubClientOrDie()
 	graphqlClient := graphql.CreateGraphqlClient()
-	err := FetchGuildReports(context.Background(), e, pubsubClient, graphqlClient)
+	err := FetchGuildReports(context.Background(), e, datastoreClient, pubsubClient, graphqlClient)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -9,10 +9,12 @@ import (
 	google_datastore "cloud.google.com/go/datastore"
 	google_pubsub "cloud.google.com/go/pubsub"
 	graphql_lib "github.com/FabianHahn/graphql"
+	"github.com/FabianHahn/raidlogscan/aggregate"
 	"github.com/FabianHahn/raidlogscan/cache"
 	"github.com/FabianHahn/raidlogscan/datastore"
 	"github.com/FabianHahn/raidlogscan/graphql"
 	"github.com/FabianHahn/raidlogscan/pubsub"
+	"github.com/FabianHahn/raidlogscan/webhook"
 	google_event "github.com/cloudevents/sdk-go/v2/event"
 )
 
@@ -22,6 +24,7 @@ func FetchReport(
 	datastoreClient *google_datastore.Client,
 	pubsubClient *google_pubsub.Client,
 	graphqlClient *graphql_lib.Client,
+	reportStatsUrl string,
 ) error {
 	code, err := pubsub.ParseReportEvent(e)
 	if err != nil {
@@ -32,6 +35,7 @@ func FetchReport(
 	var report datastore.Report
 	oldVersionPlayerAccounts := []datastore.ReportPlayerAccount{}
 	err = datastoreClient.Get(ctx, key, &report)
+	isNewReport := err == google_datastore.ErrNoSuchEntity
 	if err != nil && err != google_datastore.ErrNoSuchEntity {
 		return fmt.Errorf("datastore query for %v failed: %v", code, err.Error())
 	} else if err == nil {
@@ -93,12 +97,56 @@ func FetchReport(
 		})
 	}
 
-	_, err = datastoreClient.Put(ctx, key, &report)
+	processed := false
+	err = datastore.RunTransaction(ctx, datastoreClient, func(tx *google_datastore.Transaction) error {
+		// Read the report again, since guild aggregates count every report exactly once and a concurrent retry or claim
+		// may have written it since it was read above.
+		processed = false
+		var storedReport datastore.Report
+		err := tx.Get(key, &storedReport)
+		if err != nil && err != google_datastore.ErrNoSuchEntity {
+			return fmt.Errorf("datastore get for %s failed: %v", code, err.Error())
+		}
+		var storedOldVersionReport *datastore.Report
+		if err == nil {
+			if storedReport.Version >= 5 {
+				processed = true
+				return nil
+			}
+			storedOldVersionReport = &storedReport
+			report.PlayerAccounts = storedReport.PlayerAccounts
+		}
+
+		_, err = tx.Put(key, &report)
+		if err != nil {
+			return fmt.Errorf("datastore write for %s failed: %v", code, err.Error())
+		}
+
+		err = updateReportGuildAggregates(tx, code, storedOldVersionReport, report)
+		if err != nil {
+			return fmt.Errorf("failed to update guild aggregates for %v: %v", code, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("datastore transaction for %s failed: %v", code, err.Error())
+	}
+	if processed {
+		log.Printf("Report %v was processed concurrently.\n", code)
+		return nil
+	}
+
+	err = cache.InvalidateReportStatsCache(ctx, datastoreClient, code)
 	if err != nil {
-		return fmt.Errorf("datastore write for %s failed: %v", code, err.Error())
+		return fmt.Errorf("failed to invalidate report stats cache for %v: %v", code, err)
 	}
 
 	if report.GuildId != 0 {
+		err = updateReportGuild(ctx, datastoreClient, report.GuildId, report.GuildName)
+		if err != nil {
+			return err
+		}
+
 		err = cache.InvalidateGuildStatsCache(ctx, datastoreClient, report.GuildId)
 		if err != nil {
 			return fmt.Errorf("failed to invalidate guild stats cache for %v: %v", report.GuildId, err)
@@ -110,11 +158,88 @@ func FetchReport(
 		playerIds = append(playerIds, player.Id)
 	}
 
-	err = pubsub.PublishPlayerReportEvents(pubsubClient, ctx, code, playerIds)
+	err = pubsub.PublishPlayerReportEvents(pubsubClient, ctx, pubsub.ParseEventId(e), code, playerIds)
 	if err != nil {
 		return err
 	}
 
+	if isNewReport && report.GuildId != 0 && webhook.IsRecent(report.StartTime) {
+		err = webhook.Notify(ctx, datastoreClient, pubsubClient, pubsub.ParseEventId(e), webhook.Event{
+			Type:        webhook.EventNewReport,
+			Title:       fmt.Sprintf("New raid for %v", report.GuildName),
+			Description: fmt.Sprintf("%v in %v with %v raiders", report.Title, report.Zone, len(report.Players)),
+			Url:         fmt.Sprintf("%v?code=%v", reportStatsUrl, code),
+			Time:        report.StartTime,
+			ReportCode:  code,
+			GuildId:     report.GuildId,
+			GuildName:   report.GuildName,
+		})
+		if err != nil {
+			log.Printf("Failed to notify webhooks about report %v: %v\n", code, err)
+		}
+	}
+
 	log.Printf("Processed report %v.\n", code)
 	return nil
 }
+
+// updateReportGuildAggregates counts a report in the aggregate of its guild, taking an outdated version of it back out
+// of the aggregate of the guild it was counted in first.
+func updateReportGuildAggregates(
+	tx *google_datastore.Transaction,
+	code string,
+	oldVersionReport *datastore.Report,
+	report datastore.Report,
+) error {
+	if oldVersionReport != nil && oldVersionReport.GuildId != 0 {
+		err := aggregate.RemoveGuildReport(tx, oldVersionReport.GuildId, code, *oldVersionReport)
+		if err != nil {
+			return err
+		}
+	}
+
+	if report.GuildId == 0 {
+		return nil
+	}
+	return aggregate.AddGuildReport(tx, report.GuildId, code, report)
+}
+
+// updateReportGuild makes sure a guild entity exists for the guild of a report, and keeps its name up to date. Server
+// and faction are only filled in once the guild itself is scanned.
+func updateReportGuild(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	guildId int32,
+	guildName string,
+) error {
+	guildKey := google_datastore.IDKey("guild", int64(guildId), nil)
+	tx, err := datastoreClient.NewTransaction(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create transaction: %v", err.Error())
+	}
+
+	var guild datastore.Guild
+	err = tx.Get(guildKey, &guild)
+	if err == nil && guild.Name == guildName {
+		tx.Rollback()
+		return nil
+	} else if err != nil && err != google_datastore.ErrNoSuchEntity {
+		tx.Rollback()
+		return fmt.Errorf("datastore get guild %v failed: %v", guildId, err.Error())
+	}
+
+	guild.Name = guildName
+	guild.SearchName = datastore.NormalizeSearch(guildName)
+	guild.Flavour = graphql.Flavour
+	_, err = tx.Put(guildKey, &guild)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("datastore write guild %v failed: %v", guildId, err.Error())
+	}
+
+	_, err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("guild %v datastore transaction failed: %v", guildId, err.Error())
+	}
+	return nil
+}
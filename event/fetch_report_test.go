@@ -39,7 +39,8 @@ func TestFetchReport(t *testing.T) {
 	datastoreClient := datastore.CreateDatastoreClientOrDie()
 	pubsubClient := pubsub.CreatePubsubClientOrDie()
 	graphqlClient := graphql.CreateGraphqlClient()
-	err := FetchReport(context.Background(), e, datastoreClient, pubsubClient, graphqlClient)
+	reportStatsUrl := "http://example.com/reportstats"
+	err := FetchReport(context.Background(), e, datastoreClient, pubsubClient, graphqlClient, reportStatsUrl)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -27,7 +27,7 @@ func FetchUserReports(
 		return err
 	}
 
-	err = pubsub.PublishReportEvents(pubsubClient, ctx, reports)
+	err = pubsub.PublishReportEvents(pubsubClient, ctx, pubsub.ParseEventId(e), reports)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,42 @@
+package event
+
+import (
+	"context"
+	"log"
+
+	google_datastore "cloud.google.com/go/datastore"
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"github.com/FabianHahn/raidlogscan/pubsub"
+	google_event "github.com/cloudevents/sdk-go/v2/event"
+)
+
+// ProcessOnce wraps an event handler so that events it already processed successfully are skipped, which turns pubsub
+// redeliveries and retried publishes into no-ops. Events are only recorded once the handler succeeds, so failed events
+// are still retried. Events without an ID are always processed.
+func ProcessOnce(
+	datastoreClient *google_datastore.Client,
+	handler string,
+	process func(ctx context.Context, e google_event.Event) error,
+) func(ctx context.Context, e google_event.Event) error {
+	return func(ctx context.Context, e google_event.Event) error {
+		eventId := pubsub.ParseEventId(e)
+		if eventId == "" {
+			return process(ctx, e)
+		}
+
+		processed, err := datastore.IsEventProcessed(ctx, datastoreClient, handler, eventId)
+		if err != nil {
+			return err
+		}
+		if processed {
+			log.Printf("Event %v was already processed by %v.\n", eventId, handler)
+			return nil
+		}
+
+		err = process(ctx, e)
+		if err != nil {
+			return err
+		}
+		return datastore.MarkEventProcessed(ctx, datastoreClient, handler, eventId)
+	}
+}
@@ -0,0 +1,43 @@
+package event
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	google_pubsub "cloud.google.com/go/pubsub"
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"github.com/FabianHahn/raidlogscan/pubsub"
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+func TestProcessOnce(t *testing.T) {
+	message := pubsub.MessagePublishedData{
+		Message: google_pubsub.Message{
+			Attributes: map[string]string{
+				"event_id": "test-" + strconv.FormatInt(time.Now().UnixNano(), 10),
+			},
+		},
+	}
+
+	e := event.New()
+	e.SetDataContentType("application/json")
+	e.SetData(e.DataContentType(), message)
+
+	datastoreClient := datastore.CreateDatastoreClientOrDie()
+	calls := 0
+	handler := ProcessOnce(datastoreClient, "TestProcessOnce", func(ctx context.Context, e event.Event) error {
+		calls++
+		return nil
+	})
+	for i := 0; i < 2; i++ {
+		err := handler(context.Background(), e)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected event to be processed once, got %v calls", calls)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 
 	google_datastore "cloud.google.com/go/datastore"
+	"github.com/FabianHahn/raidlogscan/aggregate"
 	"github.com/FabianHahn/raidlogscan/cache"
 	"github.com/FabianHahn/raidlogscan/datastore"
 	"github.com/FabianHahn/raidlogscan/pubsub"
@@ -19,56 +20,82 @@ func ReportAccountClaim(ctx context.Context, e google_event.Event, datastoreClie
 	}
 
 	reportKey := google_datastore.NameKey("report", reportAccountClaimEvent.ReportCode, nil)
-	tx, err := datastoreClient.NewTransaction(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to create transaction: %v", err.Error())
-	}
-
 	var report datastore.Report
-	err = tx.Get(reportKey, &report)
-	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf(
-			"for report account claim %v/%v datastore get report %v failed: %v",
-			reportAccountClaimEvent.ClaimedAccountName,
-			reportAccountClaimEvent.ClaimedPlayerId,
-			reportAccountClaimEvent.ReportCode,
-			err.Error())
-	}
+	err = datastore.RunTransaction(ctx, datastoreClient, func(tx *google_datastore.Transaction) error {
+		report = datastore.Report{}
+		err := tx.Get(reportKey, &report)
+		if err != nil {
+			return fmt.Errorf(
+				"for report account claim %v/%v datastore get report %v failed: %v",
+				reportAccountClaimEvent.ClaimedAccountName,
+				reportAccountClaimEvent.ClaimedPlayerId,
+				reportAccountClaimEvent.ReportCode,
+				err.Error())
+		}
 
-	found := false
-	for i := range report.PlayerAccounts {
-		if report.PlayerAccounts[i].PlayerId == reportAccountClaimEvent.ClaimedPlayerId {
-			report.PlayerAccounts[i].Name = reportAccountClaimEvent.ClaimedAccountName
-			found = true
-			break
+		changed := false
+		found := false
+		for i := range report.PlayerAccounts {
+			if report.PlayerAccounts[i].PlayerId == reportAccountClaimEvent.ClaimedPlayerId {
+				changed = report.PlayerAccounts[i].Name != reportAccountClaimEvent.ClaimedAccountName
+				report.PlayerAccounts[i].Name = reportAccountClaimEvent.ClaimedAccountName
+				found = true
+				break
+			}
+		}
+		if !found {
+			changed = true
+			report.PlayerAccounts = append(report.PlayerAccounts, datastore.ReportPlayerAccount{
+				PlayerId: reportAccountClaimEvent.ClaimedPlayerId,
+				Name:     reportAccountClaimEvent.ClaimedAccountName,
+			})
+		}
+
+		if !changed {
+			// Claims are broadcast again whenever a report is retried, so skip the writes if nothing changed.
+			return nil
 		}
-	}
-	if !found {
-		report.PlayerAccounts = append(report.PlayerAccounts, datastore.ReportPlayerAccount{
-			PlayerId: reportAccountClaimEvent.ClaimedPlayerId,
-			Name:     reportAccountClaimEvent.ClaimedAccountName,
-		})
-	}
 
-	_, err = tx.Put(reportKey, &report)
+		_, err = tx.Put(reportKey, &report)
+		if err != nil {
+			return fmt.Errorf(
+				"for report account claim %v/%v datastore write report %v failed: %v",
+				reportAccountClaimEvent.ClaimedAccountName,
+				reportAccountClaimEvent.ClaimedPlayerId,
+				reportAccountClaimEvent.ReportCode,
+				err.Error())
+		}
+
+		if report.GuildId != 0 {
+			err = aggregate.ClaimGuildReportPlayer(
+				tx,
+				report.GuildId,
+				reportAccountClaimEvent.ReportCode,
+				reportAccountClaimEvent.ClaimedPlayerId,
+				reportAccountClaimEvent.ClaimedAccountName)
+			if err != nil {
+				return fmt.Errorf(
+					"for report account claim %v/%v update guild aggregate of report %v failed: %v",
+					reportAccountClaimEvent.ClaimedAccountName,
+					reportAccountClaimEvent.ClaimedPlayerId,
+					reportAccountClaimEvent.ReportCode,
+					err.Error())
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		return fmt.Errorf(
-			"for report account claim %v/%v datastore write report %v failed: %v",
+			"report account claim %v/%v report %v datastore transaction failed: %v",
 			reportAccountClaimEvent.ClaimedAccountName,
 			reportAccountClaimEvent.ClaimedPlayerId,
 			reportAccountClaimEvent.ReportCode,
 			err.Error())
 	}
 
-	_, err = tx.Commit()
+	err = cache.InvalidateReportStatsCache(ctx, datastoreClient, reportAccountClaimEvent.ReportCode)
 	if err != nil {
-		return fmt.Errorf(
-			"report account claim %v/%v report %v datastore transaction failed: %v",
-			reportAccountClaimEvent.ClaimedAccountName,
-			reportAccountClaimEvent.ClaimedPlayerId,
-			reportAccountClaimEvent.ReportCode,
-			err.Error())
+		return fmt.Errorf("failed to invalidate report stats cache for %v: %v", reportAccountClaimEvent.ReportCode, err)
 	}
 
 	if report.GuildId != 0 {
@@ -4,13 +4,17 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"sort"
+	"strconv"
+	"sync"
+	"time"
 
 	google_datastore "cloud.google.com/go/datastore"
 	google_pubsub "cloud.google.com/go/pubsub"
+	"github.com/FabianHahn/raidlogscan/aggregate"
 	"github.com/FabianHahn/raidlogscan/cache"
 	"github.com/FabianHahn/raidlogscan/datastore"
 	"github.com/FabianHahn/raidlogscan/pubsub"
+	"github.com/FabianHahn/raidlogscan/webhook"
 	google_event "github.com/cloudevents/sdk-go/v2/event"
 )
 
@@ -31,12 +35,16 @@ func UpdatePlayerReport(
 	e google_event.Event,
 	datastoreClient *google_datastore.Client,
 	pubsubClient *google_pubsub.Client,
+	reportStatsUrl string,
 ) error {
+	// Retrying malformed events can't fix them, so they are dropped instead.
 	playerReportEvent, err := pubsub.ParsePlayerReportEvent(e)
 	if err != nil {
-		return err
+		log.Printf("Dropping malformed player report event: %v\n", err)
+		return nil
 	}
 
+	// The report is read once for the whole batch of players.
 	reportKey := google_datastore.NameKey("report", playerReportEvent.Code, nil)
 	var report datastore.Report
 	err = datastoreClient.Get(ctx, reportKey, &report)
@@ -46,85 +54,331 @@ func UpdatePlayerReport(
 
 	if !report.EndTime.After(report.StartTime) {
 		log.Printf(
-			"Got empty report %v, not updating player %v.\n",
+			"Got empty report %v, not updating players %v.\n",
 			playerReportEvent.Code,
-			playerReportEvent.PlayerId)
+			playerReportEvent.PlayerIds)
 		return nil
 	}
 
+	// Every player is updated in its own transaction, so a failing player doesn't hold back the others. Retrying the
+	// batch only redoes the failed players, since players that already have the report are skipped.
+	causeId := pubsub.ParseEventId(e)
+	errs := make([]error, len(playerReportEvent.PlayerIds))
+	var wg sync.WaitGroup
+	for i, playerId := range playerReportEvent.PlayerIds {
+		wg.Add(1)
+		go func(i int, playerId int64) {
+			defer wg.Done()
+			errs[i] = updatePlayerReport(
+				ctx,
+				datastoreClient,
+				pubsubClient,
+				causeId,
+				playerReportEvent.Code,
+				report,
+				playerId,
+				reportStatsUrl)
+		}(i, playerId)
+	}
+	wg.Wait()
+
+	var firstErr error
+	numErrors := 0
+	for _, err := range errs {
+		if err != nil {
+			log.Printf("Failed to update player of report %v: %v\n", playerReportEvent.Code, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			numErrors++
+		}
+	}
+	if firstErr != nil {
+		return fmt.Errorf(
+			"failed to update %v of %v players of report %v: %v",
+			numErrors,
+			len(playerReportEvent.PlayerIds),
+			playerReportEvent.Code,
+			firstErr)
+	}
+	return nil
+}
+
+// updatePlayerReport adds a report to one of its players, and then finishes the side effects of doing so.
+func updatePlayerReport(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	pubsubClient *google_pubsub.Client,
+	causeId string,
+	code string,
+	report datastore.Report,
+	playerId int64,
+	reportStatsUrl string,
+) error {
 	var thisReportPlayer *datastore.ReportPlayer
 	for _, player := range report.Players {
-		if player.Id == playerReportEvent.PlayerId {
+		if player.Id == playerId {
 			thisReportPlayer = &player
 			break
 		}
 	}
 	if thisReportPlayer == nil {
-		return fmt.Errorf("player %v not found in report: %+v", playerReportEvent.PlayerId, report)
+		return fmt.Errorf("player %v not found in report: %+v", playerId, report)
+	}
+
+	err := datastore.MigratePlayer(ctx, datastoreClient, playerId)
+	if err != nil {
+		return fmt.Errorf(
+			"for update report %v failed to migrate player %v: %v",
+			code,
+			playerId,
+			err.Error())
+	}
+
+	playerKey := google_datastore.IDKey("player", playerId, nil)
+	var update playerReportUpdate
+	err = datastore.RunTransaction(ctx, datastoreClient, func(tx *google_datastore.Transaction) error {
+		var err error
+		update, err = updatePlayerReportTransaction(
+			ctx,
+			datastoreClient,
+			tx,
+			playerKey,
+			code,
+			report,
+			*thisReportPlayer)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf(
+			"failed to commit transaction updating report %v for player %v: %v",
+			code,
+			playerId,
+			err.Error())
+	}
+
+	sideEffects := update.sideEffects
+	if sideEffects == nil {
+		log.Printf("Report %v already reported for player %v.\n", code, playerId)
+		return nil // no error
+	}
+
+	// Everything up to clearing the side effects is repeated if the update gets retried, which is fine since claims and
+	// cache invalidations are idempotent.
+	player := update.player
+	if player.Account != "" && len(sideEffects.CoraiderClaimIds) > 0 {
+		err = pubsub.PublishCoraiderAccountClaimEvents(
+			pubsubClient,
+			ctx,
+			causeId,
+			playerId,
+			player.Account,
+			sideEffects.CoraiderClaimIds)
+		if err != nil {
+			return fmt.Errorf(
+				"failed to update report %v for player %v: %v",
+				code,
+				playerId,
+				err.Error())
+		}
+	}
+
+	if player.Account != "" && sideEffects.ReportClaim {
+		err = pubsub.PublishReportAccountClaimEvents(
+			pubsubClient,
+			ctx,
+			causeId,
+			playerId,
+			player.Account,
+			[]string{code},
+		)
+		if err != nil {
+			return fmt.Errorf(
+				"failed to update report %v for player %v: %v",
+				code,
+				playerId,
+				err.Error())
+		}
+	}
+
+	if player.Account != "" {
+		err = cache.InvalidateAccountStatsCache(ctx, datastoreClient, player.Account)
+		if err != nil {
+			return fmt.Errorf("failed to invalidate account stats cache for %v: %v", player.Account, err)
+		}
 	}
 
-	playerKey := google_datastore.IDKey("player", playerReportEvent.PlayerId, nil)
-	tx, err := datastoreClient.NewTransaction(ctx)
+	err = cache.InvalidatePlayerStatsCache(ctx, datastoreClient, playerId)
 	if err != nil {
-		return fmt.Errorf("failed to create transaction: %v", err.Error())
+		return fmt.Errorf("failed to invalidate player stats cache for %v: %v", playerId, err)
 	}
 
-	var player datastore.Player
-	err = tx.Get(playerKey, &player)
-	if err == google_datastore.ErrNoSuchEntity {
+	cleared, err := clearPlayerReportSideEffects(
+		ctx,
+		datastoreClient,
+		datastore.PlayerReportSideEffectsKey(playerKey, code),
+		sideEffects.Revision)
+	if err != nil {
+		return fmt.Errorf(
+			"failed to clear side effects of report %v for player %v: %v",
+			code,
+			playerId,
+			err.Error())
+	}
+
+	// Webhooks are only sent by whoever clears the side effects, so that they go out at most once.
+	if cleared && webhook.IsRecent(report.StartTime) {
+		notifyPlayerReportWebhooks(
+			ctx,
+			datastoreClient,
+			pubsubClient,
+			causeId,
+			code,
+			report,
+			playerId,
+			player,
+			sideEffects.FirstGuildRaid,
+			sideEffects.Milestones,
+			reportStatsUrl)
+	}
+
+	numClaimedCoraiders := 0
+	if player.Account != "" {
+		numClaimedCoraiders = len(sideEffects.CoraiderClaimIds)
+	}
+	if update.alreadyReported {
+		log.Printf("Finished pending report %v for player %v and broadcast account to %v new coraiders.\n",
+			code,
+			playerId,
+			numClaimedCoraiders)
+	} else if update.onlyUpdateReports {
+		log.Printf("Updated report %v for player %v and broadcast account to %v new coraiders.\n",
+			code,
+			playerId,
+			numClaimedCoraiders)
+	} else {
+		log.Printf("Processed report %v for player %v and broadcast account to %v new coraiders.\n",
+			code,
+			playerId,
+			numClaimedCoraiders)
+	}
+	return nil
+}
+
+// playerReportUpdate is the outcome of the transaction adding a report to a player. Side effects are nil if there is
+// nothing left to do for the report.
+type playerReportUpdate struct {
+	player            datastore.Player
+	onlyUpdateReports bool
+	alreadyReported   bool
+	sideEffects       *datastore.PlayerReportSideEffects
+}
+
+// updatePlayerReportTransaction adds a report to a player, or fills in its guild if it was added before, as part of a
+// transaction. The work that has to happen after the commit is recorded in the report's side effects entity, merged
+// with any side effects of earlier updates that haven't been finished yet. If the report is already up to date, only
+// the pending side effects are returned.
+func updatePlayerReportTransaction(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	tx *google_datastore.Transaction,
+	playerKey *google_datastore.Key,
+	code string,
+	report datastore.Report,
+	thisReportPlayer datastore.ReportPlayer,
+) (playerReportUpdate, error) {
+	update := playerReportUpdate{}
+	player := &update.player
+	playerId := playerKey.ID
+	err := tx.Get(playerKey, player)
+	newPlayer := err == google_datastore.ErrNoSuchEntity
+	if newPlayer {
 		player.Name = thisReportPlayer.Name
 		player.Class = thisReportPlayer.Class
 		player.Server = thisReportPlayer.Server
+		player.Version = datastore.PlayerVersion
 	} else if err != nil {
-		tx.Rollback()
-		return fmt.Errorf(
-			"for update report %v datastore get player %v failed: %v",
-			playerReportEvent.Code,
-			playerReportEvent.PlayerId,
+		return update, fmt.Errorf("for update report %v datastore get player %v failed: %v", code, playerId, err.Error())
+	} else if player.Version < datastore.PlayerVersion {
+		return update, fmt.Errorf("for update report %v player %v is still at version %v", code, playerId, player.Version)
+	}
+
+	playerReportKey := datastore.PlayerReportKey(playerKey, code)
+	var playerReport datastore.PlayerReport
+	err = tx.Get(playerReportKey, &playerReport)
+	update.onlyUpdateReports = err == nil
+	if err != nil && err != google_datastore.ErrNoSuchEntity {
+		return update, fmt.Errorf(
+			"for update report %v datastore get report of player %v failed: %v",
+			code,
+			playerId,
 			err.Error())
 	}
 
-	if player.Version < 2 {
-		log.Printf("Outdated entry for player %v, replacing entry.\n", playerReportEvent.PlayerId)
-		player.Reports = []datastore.PlayerReport{}
-		player.Coraiders = []datastore.PlayerCoraider{}
-		player.Version = 2
+	sideEffectsKey := datastore.PlayerReportSideEffectsKey(playerKey, code)
+	var pendingSideEffects datastore.PlayerReportSideEffects
+	err = tx.Get(sideEffectsKey, &pendingSideEffects)
+	hasPendingSideEffects := err == nil
+	if err != nil && err != google_datastore.ErrNoSuchEntity {
+		return update, fmt.Errorf(
+			"for update report %v datastore get side effects of player %v failed: %v",
+			code,
+			playerId,
+			err.Error())
 	}
 
-	onlyUpdateReports := false
-	for playerIndex, playerReport := range player.Reports {
-		if playerReport.Code == playerReportEvent.Code {
-			if playerReport.Version == report.Version &&
-				playerReport.GuildId == report.GuildId &&
-				playerReport.GuildName == report.GuildName {
-				tx.Rollback()
-				log.Printf("Report %v already reported for player %v.\n", playerReportEvent.Code, playerReportEvent.PlayerId)
-				return nil // no error
+	oldGuildId := playerReport.GuildId
+	if update.onlyUpdateReports {
+		if playerReport.Version == report.Version &&
+			playerReport.GuildId == report.GuildId &&
+			playerReport.GuildName == report.GuildName {
+			update.alreadyReported = true
+			if hasPendingSideEffects {
+				update.sideEffects = &pendingSideEffects
 			}
-
-			// This report's version got updated and we need to fill in the guild ID and name.
-			player.Reports[playerIndex].GuildId = report.GuildId
-			player.Reports[playerIndex].GuildName = report.GuildName
-			player.Reports[playerIndex].Version = report.Version
-			onlyUpdateReports = true
+			return update, nil
 		}
+
+		// This report's version got updated and we need to fill in the guild ID and name.
+		playerReport.GuildId = report.GuildId
+		playerReport.GuildName = report.GuildName
+		playerReport.Version = report.Version
 	}
 
-	newCoraiderIds := []int64{}
-	if !onlyUpdateReports {
-		duplicate := false
-		firstEarlierStarting := sort.Search(len(player.Reports), func(i int) bool {
-			return player.Reports[i].StartTime.Before(report.StartTime)
-		})
-		if firstEarlierStarting < len(player.Reports) && report.StartTime.Before(player.Reports[firstEarlierStarting].EndTime) {
-			duplicate = true
+	sideEffects := datastore.PlayerReportSideEffects{
+		CoraiderClaimIds: []int64{},
+		ReportClaim:      report.GuildId != 0,
+		Milestones:       []datastore.PlayerReportMilestone{},
+	}
+	if !update.onlyUpdateReports {
+		if report.GuildId != 0 {
+			guildReportKeys, err := datastoreClient.GetAll(ctx, google_datastore.NewQuery("player_report").
+				Ancestor(playerKey).
+				FilterField("GuildId", "=", report.GuildId).
+				KeysOnly().
+				Limit(1).
+				Transaction(tx), nil)
+			if err != nil {
+				return update, fmt.Errorf(
+					"for update report %v datastore query guild reports of player %v failed: %v",
+					code,
+					playerId,
+					err.Error())
+			}
+			sideEffects.FirstGuildRaid = len(guildReportKeys) == 0
 		}
-		if firstEarlierStarting > 0 && report.EndTime.After(player.Reports[firstEarlierStarting-1].StartTime) {
-			duplicate = true
+
+		duplicate, err := isDuplicatePlayerReport(ctx, datastoreClient, tx, playerKey, report)
+		if err != nil {
+			return update, fmt.Errorf(
+				"for update report %v duplicate check of player %v failed: %v",
+				code,
+				playerId,
+				err.Error())
 		}
 
-		player.Reports = append(player.Reports, datastore.PlayerReport{
-			Code:      playerReportEvent.Code,
+		playerReport = datastore.PlayerReport{
+			Code:      code,
 			Title:     report.Title,
 			StartTime: report.StartTime,
 			EndTime:   report.EndTime,
@@ -135,120 +389,359 @@ func UpdatePlayerReport(
 			Role:      thisReportPlayer.Role,
 			Duplicate: duplicate,
 			Version:   report.Version,
-		})
-		sort.SliceStable(player.Reports, func(i int, j int) bool {
-			return player.Reports[i].StartTime.After(player.Reports[j].StartTime)
-		})
+		}
 
 		if !duplicate {
-			coraiders := map[int64]*datastore.PlayerCoraider{}
-			for id := range player.Coraiders {
-				coraider := &player.Coraiders[id]
-				coraiders[coraider.Id] = coraider
-			}
-
-			currentCoraiders := map[int64]struct{}{}
-			for _, reportPlayer := range report.Players {
-				if _, alreadyCounted := currentCoraiders[reportPlayer.Id]; alreadyCounted {
-					continue
-				}
-
-				if coraider, ok := coraiders[reportPlayer.Id]; ok {
-					coraider.Count++
-
-					if coraider.Count <= numCoraiderClaimBroadcasts {
-						newCoraiderIds = append(newCoraiderIds, reportPlayer.Id)
-					}
-				} else {
-					coraiders[reportPlayer.Id] = &datastore.PlayerCoraider{
-						Id:     reportPlayer.Id,
-						Name:   reportPlayer.Name,
-						Class:  reportPlayer.Class,
-						Server: reportPlayer.Server,
-						Count:  1,
-					}
-					newCoraiderIds = append(newCoraiderIds, reportPlayer.Id)
-				}
-
-				currentCoraiders[reportPlayer.Id] = struct{}{}
-			}
-
-			player.Coraiders = []datastore.PlayerCoraider{}
-			for _, coraider := range coraiders {
-				player.Coraiders = append(player.Coraiders, *coraider)
+			sideEffects.CoraiderClaimIds, err = countPlayerCoraiders(tx, playerKey, playerId, report)
+			if err != nil {
+				return update, fmt.Errorf(
+					"for update report %v counting coraiders of player %v failed: %v",
+					code,
+					playerId,
+					err.Error())
 			}
 		}
 	}
 
-	_, err = tx.Put(playerKey, &player)
+	_, err = tx.Put(playerReportKey, &playerReport)
 	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf(
-			"failed to update player when updating report %v for player %v: %v",
-			playerReportEvent.Code,
-			playerReportEvent.PlayerId,
+		return update, fmt.Errorf(
+			"failed to update player report when updating report %v for player %v: %v",
+			code,
+			playerId,
 			err.Error())
 	}
 
-	_, err = tx.Commit()
+	if player.Account != "" {
+		err = aggregate.UpdateAccount(tx, player.Account, func(
+			tx *google_datastore.Transaction,
+			accountKey *google_datastore.Key,
+			account *datastore.Account,
+		) (bool, error) {
+			if update.onlyUpdateReports {
+				return false, aggregate.UpdateAccountReportGuild(tx, accountKey, oldGuildId, playerReport)
+			}
+			coraiders, changed, err := aggregate.AddAccountPlayerReport(
+				ctx,
+				datastoreClient,
+				tx,
+				accountKey,
+				account,
+				playerId,
+				*player,
+				playerReport,
+				report)
+			if err != nil {
+				return false, err
+			}
+			sideEffects.Milestones, err = countAccountMilestones(tx, accountKey, *account, coraiders)
+			return changed, err
+		})
+		if err != nil {
+			return update, fmt.Errorf(
+				"failed to update account when updating report %v for player %v: %v",
+				code,
+				playerId,
+				err.Error())
+		}
+	}
+
+	if hasPendingSideEffects {
+		mergePlayerReportSideEffects(&sideEffects, pendingSideEffects)
+	}
+	_, err = tx.Put(sideEffectsKey, &sideEffects)
 	if err != nil {
-		return fmt.Errorf(
-			"failed to commit transaction updating report %v for player %v: %v",
-			playerReportEvent.Code,
-			playerReportEvent.PlayerId,
+		return update, fmt.Errorf(
+			"failed to write side effects when updating report %v for player %v: %v",
+			code,
+			playerId,
 			err.Error())
 	}
+	update.sideEffects = &sideEffects
 
-	if player.Account != "" && len(newCoraiderIds) > 0 {
-		err = pubsub.PublishCoraiderAccountClaimEvents(
-			pubsubClient,
-			ctx,
-			playerReportEvent.PlayerId,
-			player.Account,
-			newCoraiderIds)
+	if newPlayer {
+		player.SearchName = datastore.PlayerSearchName(player.Name, player.Server)
+		player.SearchAccount = datastore.NormalizeSearch(player.Account)
+		_, err = tx.Put(playerKey, player)
 		if err != nil {
-			return fmt.Errorf(
-				"failed to update report %v for player %v: %v",
-				playerReportEvent.Code,
-				playerReportEvent.PlayerId,
+			return update, fmt.Errorf(
+				"failed to create player when updating report %v for player %v: %v",
+				code,
+				playerId,
 				err.Error())
 		}
 	}
+	return update, nil
+}
 
-	if player.Account != "" && report.GuildId != 0 {
-		err = pubsub.PublishReportAccountClaimEvents(
-			pubsubClient,
-			ctx,
-			playerReportEvent.PlayerId,
-			player.Account,
-			[]string{playerReportEvent.Code},
-		)
+// mergePlayerReportSideEffects adds the side effects of an earlier update to the same report that haven't been
+// finished yet, so that finishing the merged side effects covers both.
+func mergePlayerReportSideEffects(
+	sideEffects *datastore.PlayerReportSideEffects,
+	pending datastore.PlayerReportSideEffects,
+) {
+	claimIds := map[int64]struct{}{}
+	for _, coraiderId := range sideEffects.CoraiderClaimIds {
+		claimIds[coraiderId] = struct{}{}
+	}
+	for _, coraiderId := range pending.CoraiderClaimIds {
+		if _, ok := claimIds[coraiderId]; !ok {
+			sideEffects.CoraiderClaimIds = append(sideEffects.CoraiderClaimIds, coraiderId)
+		}
+	}
+
+	sideEffects.ReportClaim = sideEffects.ReportClaim || pending.ReportClaim
+	sideEffects.FirstGuildRaid = sideEffects.FirstGuildRaid || pending.FirstGuildRaid
+	sideEffects.Milestones = append(sideEffects.Milestones, pending.Milestones...)
+	sideEffects.Revision = pending.Revision + 1
+}
+
+// clearPlayerReportSideEffects deletes the side effects of a player report once they are finished, unless they were
+// cleared by someone else or got merged with the side effects of another update in the meantime. It returns whether
+// the side effects were deleted.
+func clearPlayerReportSideEffects(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	sideEffectsKey *google_datastore.Key,
+	revision int64,
+) (bool, error) {
+	cleared := false
+	err := datastore.RunTransaction(ctx, datastoreClient, func(tx *google_datastore.Transaction) error {
+		cleared = false
+		var sideEffects datastore.PlayerReportSideEffects
+		err := tx.Get(sideEffectsKey, &sideEffects)
+		if err == google_datastore.ErrNoSuchEntity {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if sideEffects.Revision != revision {
+			return nil
+		}
+
+		cleared = true
+		return tx.Delete(sideEffectsKey)
+	})
+	return cleared, err
+}
+
+// isDuplicatePlayerReport checks whether a report overlaps with the reports of a player starting right before or right
+// after it, which happens when multiple raiders logged the same raid.
+func isDuplicatePlayerReport(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	tx *google_datastore.Transaction,
+	playerKey *google_datastore.Key,
+	report datastore.Report,
+) (bool, error) {
+	earlier := []datastore.PlayerReport{}
+	_, err := datastoreClient.GetAll(ctx, google_datastore.NewQuery("player_report").
+		Ancestor(playerKey).
+		FilterField("StartTime", "<", report.StartTime).
+		Order("-StartTime").
+		Limit(1).
+		Transaction(tx), &earlier)
+	if err != nil {
+		return false, err
+	}
+	if len(earlier) > 0 && report.StartTime.Before(earlier[0].EndTime) {
+		return true, nil
+	}
+
+	later := []datastore.PlayerReport{}
+	_, err = datastoreClient.GetAll(ctx, google_datastore.NewQuery("player_report").
+		Ancestor(playerKey).
+		FilterField("StartTime", ">=", report.StartTime).
+		Order("StartTime").
+		Limit(1).
+		Transaction(tx), &later)
+	if err != nil {
+		return false, err
+	}
+	return len(later) > 0 && report.EndTime.After(later[0].StartTime), nil
+}
+
+// countPlayerCoraiders increments the coraider counts of a player for everyone in a report, including the player
+// itself. It returns the coraiders that should be told about the player's account.
+func countPlayerCoraiders(
+	tx *google_datastore.Transaction,
+	playerKey *google_datastore.Key,
+	playerId int64,
+	report datastore.Report,
+) ([]int64, error) {
+	keys := []*google_datastore.Key{}
+	reportPlayers := []datastore.ReportPlayer{}
+	currentCoraiders := map[int64]struct{}{}
+	for _, reportPlayer := range report.Players {
+		if _, alreadyCounted := currentCoraiders[reportPlayer.Id]; alreadyCounted {
+			continue
+		}
+		currentCoraiders[reportPlayer.Id] = struct{}{}
+
+		keys = append(keys, datastore.PlayerCoraiderKey(playerKey, reportPlayer.Id))
+		reportPlayers = append(reportPlayers, reportPlayer)
+	}
+
+	coraiders := make([]datastore.PlayerCoraider, len(keys))
+	err := tx.GetMulti(keys, coraiders)
+	exists := make([]bool, len(keys))
+	if multiErr, ok := err.(google_datastore.MultiError); ok {
+		for i, keyErr := range multiErr {
+			if keyErr != nil && keyErr != google_datastore.ErrNoSuchEntity {
+				return nil, keyErr
+			}
+			exists[i] = keyErr == nil
+		}
+	} else if err != nil {
+		return nil, err
+	} else {
+		for i := range exists {
+			exists[i] = true
+		}
+	}
+
+	newCoraiderIds := []int64{}
+	for i, reportPlayer := range reportPlayers {
+		coraider := &coraiders[i]
+		if exists[i] {
+			coraider.Count++
+			if coraider.Count <= numCoraiderClaimBroadcasts {
+				newCoraiderIds = append(newCoraiderIds, reportPlayer.Id)
+			}
+		} else {
+			*coraider = datastore.PlayerCoraider{
+				Id:     reportPlayer.Id,
+				Name:   reportPlayer.Name,
+				Class:  reportPlayer.Class,
+				Server: reportPlayer.Server,
+				Count:  1,
+			}
+			newCoraiderIds = append(newCoraiderIds, reportPlayer.Id)
+		}
+	}
+
+	_, err = tx.PutMulti(keys, coraiders)
+	if err != nil {
+		return nil, err
+	}
+	return newCoraiderIds, nil
+}
+
+// countAccountMilestones checks which of the coraiders just counted by an account reached a milestone with it, as part
+// of the same transaction. Coraiders claimed by an account are summed up over all of that account's characters, and
+// every milestone is recorded so that the other side of the pair doesn't fire it again. The counts come from the
+// account's shards, of which only the one of the report is read in the transaction, so concurrent reports of the same
+// account pair may skip a milestone.
+func countAccountMilestones(
+	tx *google_datastore.Transaction,
+	accountKey *google_datastore.Key,
+	account datastore.Account,
+	coraiders []datastore.AccountCoraider,
+) ([]datastore.PlayerReportMilestone, error) {
+	milestones := []datastore.PlayerReportMilestone{}
+	summedAccounts := map[string]struct{}{}
+	for _, coraider := range coraiders {
+		count := coraider.Count
+		coraiderIdentity := strconv.FormatInt(coraider.Id, 10)
+		if coraider.Account != "" {
+			if _, ok := summedAccounts[coraider.Account]; ok || coraider.Account == accountKey.Name {
+				continue
+			}
+			summedAccounts[coraider.Account] = struct{}{}
+
+			count = aggregate.SumAccountCoraiderAccount(account, coraider.Account)
+			coraiderIdentity = "#" + coraider.Account
+		}
+		if !webhook.IsMilestone(count) {
+			continue
+		}
+
+		milestoneKey := datastore.WebhookMilestoneKey("#"+accountKey.Name, coraiderIdentity, count)
+		var milestone datastore.WebhookMilestone
+		err := tx.Get(milestoneKey, &milestone)
+		if err == nil {
+			continue
+		} else if err != google_datastore.ErrNoSuchEntity {
+			return nil, fmt.Errorf("datastore get milestone %v failed: %v", milestoneKey.Name, err)
+		}
+		milestone.CreatedAt = time.Now()
+		_, err = tx.Put(milestoneKey, &milestone)
 		if err != nil {
-			return fmt.Errorf(
-				"failed to update report %v for player %v: %v",
-				playerReportEvent.Code,
-				playerReportEvent.PlayerId,
-				err.Error())
+			return nil, fmt.Errorf("datastore write milestone %v failed: %v", milestoneKey.Name, err)
 		}
+
+		milestones = append(milestones, datastore.PlayerReportMilestone{
+			CoraiderAccount: coraider.Account,
+			CoraiderId:      coraider.Id,
+			CoraiderName:    coraider.Name,
+			CoraiderServer:  coraider.Server,
+			Count:           count,
+		})
 	}
+	return milestones, nil
+}
 
+// notifyPlayerReportWebhooks fires the webhook events caused by adding a report to a player. Milestones are counted
+// by the player's account, so they are only fired for claimed players.
+func notifyPlayerReportWebhooks(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	pubsubClient *google_pubsub.Client,
+	causeId string,
+	code string,
+	report datastore.Report,
+	playerId int64,
+	player datastore.Player,
+	firstGuildRaid bool,
+	milestones []datastore.PlayerReportMilestone,
+	reportStatsUrl string,
+) {
+	playerName := fmt.Sprintf("%v-%v", player.Name, player.Server)
 	if player.Account != "" {
-		err = cache.InvalidateAccountStatsCache(ctx, datastoreClient, player.Account)
-		if err != nil {
-			return fmt.Errorf("failed to invalidate account stats cache for %v: %v", player.Account, err)
+		playerName = fmt.Sprintf("#%v (%v)", player.Account, playerName)
+	}
+	reportUrl := fmt.Sprintf("%v?code=%v", reportStatsUrl, code)
+
+	events := []webhook.Event{}
+	if firstGuildRaid {
+		events = append(events, webhook.Event{
+			Type:        webhook.EventNewGuildRaider,
+			Title:       fmt.Sprintf("New raider in %v", report.GuildName),
+			Description: fmt.Sprintf("%v raided with %v for the first time in %v", playerName, report.GuildName, report.Title),
+			Url:         reportUrl,
+			Time:        report.StartTime,
+			ReportCode:  code,
+			GuildId:     report.GuildId,
+			GuildName:   report.GuildName,
+			AccountName: player.Account,
+			PlayerId:    playerId,
+		})
+	}
+
+	for _, milestone := range milestones {
+		coraiderName := fmt.Sprintf("%v-%v", milestone.CoraiderName, milestone.CoraiderServer)
+		if milestone.CoraiderAccount != "" {
+			coraiderName = fmt.Sprintf("#%v", milestone.CoraiderAccount)
 		}
+		events = append(events, webhook.Event{
+			Type:        webhook.EventCoraiderMilestone,
+			Title:       fmt.Sprintf("%v raids together", milestone.Count),
+			Description: fmt.Sprintf("#%v reached %v raids with %v", player.Account, milestone.Count, coraiderName),
+			Url:         reportUrl,
+			Time:        report.StartTime,
+			ReportCode:  code,
+			GuildId:     report.GuildId,
+			GuildName:   report.GuildName,
+			AccountName: player.Account,
+			PlayerId:    playerId,
+			Count:       milestone.Count,
+		})
 	}
 
-	if onlyUpdateReports {
-		log.Printf("Updated report %v for player %v and broadcast account to %v new coraiders.\n",
-			playerReportEvent.Code,
-			playerReportEvent.PlayerId,
-			len(newCoraiderIds))
-	} else {
-		log.Printf("Processed report %v for player %v and broadcast account to %v new coraiders.\n",
-			playerReportEvent.Code,
-			playerReportEvent.PlayerId,
-			len(newCoraiderIds))
+	for _, event := range events {
+		err := webhook.Notify(ctx, datastoreClient, pubsubClient, causeId, event)
+		if err != nil {
+			log.Printf("Failed to notify webhooks about %v for player %v: %v\n", event.Type, playerId, err)
+		}
 	}
-	return nil
 }
@@ -38,7 +38,8 @@ func TestUpdatePlayerReport(t *testing.T) {
 
 	datastoreClient := datastore.CreateDatastoreClientOrDie()
 	pubsubClient := pubsub.CreatePubsubClientOrDie()
-	err := UpdatePlayerReport(context.Background(), e, datastoreClient, pubsubClient)
+	reportStatsUrl := "http://example.com/reportstats"
+	err := UpdatePlayerReport(context.Background(), e, datastoreClient, pubsubClient, reportStatsUrl)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -53,3 +54,23 @@ func TestUpdatePlayerReport(t *testing.T) {
 	}
 	t.Log(string(out))
 }
+
+func TestUpdatePlayerReportMalformedEvent(t *testing.T) {
+	message := MessagePublishedData{
+		Message: PubSubMessage{
+			Attributes: map[string]interface{}{
+				"code": testUpdateReportCode,
+			},
+		},
+	}
+
+	e := event.New()
+	e.SetDataContentType("application/json")
+	e.SetData(e.DataContentType(), message)
+
+	// Events without player IDs are dropped before the report is even loaded.
+	err := UpdatePlayerReport(context.Background(), e, nil, nil, "http://example.com/reportstats")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
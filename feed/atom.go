@@ -0,0 +1,91 @@
+package feed
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+type AtomEntry struct {
+	Id      string
+	Title   string
+	Summary string
+	Url     string
+	Updated time.Time
+}
+
+type AtomFeed struct {
+	Id      string
+	Title   string
+	Url     string
+	SelfUrl string
+	Author  string
+	Entries []AtomEntry
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Id      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+	Summary string   `xml:"summary,omitempty"`
+}
+
+type atomDocument struct {
+	XMLName xml.Name    `xml:"feed"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	Id      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// WriteAtom serializes an RFC 4287 Atom feed. The feed is considered updated whenever its newest entry was, so
+// entries are expected to be ordered newest first.
+func WriteAtom(wr io.Writer, feed AtomFeed) error {
+	updated := time.Unix(0, 0)
+	if len(feed.Entries) > 0 {
+		updated = feed.Entries[0].Updated
+	}
+
+	document := atomDocument{
+		Xmlns:   "http://www.w3.org/2005/Atom",
+		Id:      feed.Id,
+		Title:   feed.Title,
+		Updated: updated.UTC().Format(time.RFC3339),
+		Author:  atomAuthor{Name: feed.Author},
+		Links: []atomLink{
+			{Href: feed.Url, Rel: "alternate", Type: "text/html"},
+			{Href: feed.SelfUrl, Rel: "self", Type: "application/atom+xml"},
+		},
+	}
+	for _, entry := range feed.Entries {
+		document.Entries = append(document.Entries, atomEntry{
+			Id:      entry.Id,
+			Title:   entry.Title,
+			Updated: entry.Updated.UTC().Format(time.RFC3339),
+			Link:    atomLink{Href: entry.Url, Rel: "alternate", Type: "text/html"},
+			Summary: entry.Summary,
+		})
+	}
+
+	_, err := io.WriteString(wr, xml.Header)
+	if err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(wr)
+	encoder.Indent("", "  ")
+	return encoder.Encode(document)
+}
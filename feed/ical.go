@@ -0,0 +1,95 @@
+package feed
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	icalTimeFormat    = "20060102T150405Z"
+	icalMaxLineLength = 75
+)
+
+type CalendarEvent struct {
+	Uid         string
+	Summary     string
+	Description string
+	Location    string
+	Url         string
+	Start       time.Time
+	End         time.Time
+	Weekly      bool
+}
+
+type Calendar struct {
+	Name        string
+	Description string
+	Events      []CalendarEvent
+}
+
+// WriteCalendar serializes a calendar as an RFC 5545 iCalendar document. All times are written in UTC.
+func WriteCalendar(wr io.Writer, calendar Calendar) error {
+	writer := bufio.NewWriter(wr)
+	now := time.Now()
+
+	writeIcalLine(writer, "BEGIN:VCALENDAR")
+	writeIcalLine(writer, "VERSION:2.0")
+	writeIcalLine(writer, "PRODID:-//raidlogscan//WoW Raid Stats//EN")
+	writeIcalLine(writer, "CALSCALE:GREGORIAN")
+	writeIcalLine(writer, "METHOD:PUBLISH")
+	writeIcalLine(writer, "X-WR-CALNAME:"+escapeIcalText(calendar.Name))
+	if calendar.Description != "" {
+		writeIcalLine(writer, "X-WR-CALDESC:"+escapeIcalText(calendar.Description))
+	}
+	for _, event := range calendar.Events {
+		writeIcalLine(writer, "BEGIN:VEVENT")
+		writeIcalLine(writer, "UID:"+escapeIcalText(event.Uid))
+		writeIcalLine(writer, "DTSTAMP:"+now.UTC().Format(icalTimeFormat))
+		writeIcalLine(writer, "DTSTART:"+event.Start.UTC().Format(icalTimeFormat))
+		writeIcalLine(writer, "DTEND:"+event.End.UTC().Format(icalTimeFormat))
+		if event.Weekly {
+			writeIcalLine(writer, "RRULE:FREQ=WEEKLY")
+		}
+		writeIcalLine(writer, "SUMMARY:"+escapeIcalText(event.Summary))
+		if event.Description != "" {
+			writeIcalLine(writer, "DESCRIPTION:"+escapeIcalText(event.Description))
+		}
+		if event.Location != "" {
+			writeIcalLine(writer, "LOCATION:"+escapeIcalText(event.Location))
+		}
+		if event.Url != "" {
+			writeIcalLine(writer, "URL:"+event.Url)
+		}
+		writeIcalLine(writer, "END:VEVENT")
+	}
+	writeIcalLine(writer, "END:VCALENDAR")
+	return writer.Flush()
+}
+
+// writeIcalLine writes a content line terminated by CRLF, folding it into continuation lines starting with a space
+// if it exceeds 75 octets. Lines are only folded between UTF-8 characters.
+func writeIcalLine(writer *bufio.Writer, line string) {
+	lineLength := 0
+	for _, r := range line {
+		runeLength := len(string(r))
+		if lineLength+runeLength > icalMaxLineLength {
+			writer.WriteString("\r\n ")
+			lineLength = 1
+		}
+		writer.WriteRune(r)
+		lineLength += runeLength
+	}
+	writer.WriteString("\r\n")
+}
+
+func escapeIcalText(text string) string {
+	return strings.NewReplacer(
+		"\\", "\\\\",
+		";", "\\;",
+		",", "\\,",
+		"\r\n", "\\n",
+		"\n", "\\n",
+	).Replace(text)
+}
@@ -13,6 +13,9 @@ const (
 	graphqlApiUrl     = "https://classic.warcraftlogs.com/api/v2/client"
 	graphqlUserApiUrl = "https://classic.warcraftlogs.com/api/v2/user"
 	oauthApiUrl       = "https://classic.warcraftlogs.com/oauth"
+
+	// Flavour is the Warcraft Logs site all reports and guilds are fetched from.
+	Flavour = "classic"
 )
 
 func CreateGraphqlClient() *graphql_lib.Client {
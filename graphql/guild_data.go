@@ -0,0 +1,46 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+
+	graphql_lib "github.com/FabianHahn/graphql"
+)
+
+type GuildDataResult struct {
+	Name    string
+	Server  string
+	Faction string
+}
+
+type guildDataQuery struct {
+	GuildData struct {
+		Guild struct {
+			Name   graphql_lib.String
+			Server struct {
+				Name graphql_lib.String
+			}
+			Faction struct {
+				Name graphql_lib.String
+			}
+		} `graphql:"guild(id: $guildId)"`
+	}
+}
+
+func QueryGuildData(graphqlClient *graphql_lib.Client, ctx context.Context, guildId int64) (GuildDataResult, error) {
+	result := GuildDataResult{}
+
+	var query guildDataQuery
+	variables := map[string]interface{}{
+		"guildId": graphql_lib.Int(guildId),
+	}
+	err := graphqlClient.Query(ctx, &query, variables)
+	if err != nil {
+		return result, fmt.Errorf("GraphQL guild data query for %v failed: %v", guildId, err.Error())
+	}
+
+	result.Name = string(query.GuildData.Guild.Name)
+	result.Server = string(query.GuildData.Guild.Server.Name)
+	result.Faction = string(query.GuildData.Guild.Faction.Name)
+	return result, nil
+}
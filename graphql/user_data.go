@@ -13,10 +13,18 @@ type UserDataCharacter struct {
 	Server string
 }
 
+type UserDataGuild struct {
+	Id     int32
+	Name   string
+	Server string
+	Rank   string
+}
+
 type UserDataResult struct {
 	Id         int32
 	Name       string
 	Characters []UserDataCharacter
+	Guilds     []UserDataGuild
 }
 
 type userDataQuery struct {
@@ -31,6 +39,14 @@ type userDataQuery struct {
 					Name graphql_lib.String
 				}
 			}
+			Guilds []struct {
+				Id     graphql_lib.Int
+				Name   graphql_lib.String
+				Server struct {
+					Name graphql_lib.String
+				}
+				CurrentUserRank graphql_lib.String
+			}
 		}
 	}
 }
@@ -54,5 +70,13 @@ func QueryUserData(graphqlClient *graphql_lib.Client, ctx context.Context) (User
 			Server: string(character.Server.Name),
 		})
 	}
+	for _, guild := range query.UserData.CurrentUser.Guilds {
+		result.Guilds = append(result.Guilds, UserDataGuild{
+			Id:     int32(guild.Id),
+			Name:   string(guild.Name),
+			Server: string(guild.Server.Name),
+			Rank:   string(guild.CurrentUserRank),
+		})
+	}
 	return result, nil
 }
@@ -11,6 +11,10 @@ const accountStatsHtmlTemplate = `{{define "body"}}
 <h1>#{{.AccountName}}</h1>
 <b>Raids</b>: {{.NumRaids}}<br>
 <b>Characters</b>: {{.NumCharacters}}<br>
+<a href="{{.RaidNetworkUrl}}?account_name={{.AccountName}}">Raid network</a> |
+<a href="{{.RaidGroupsUrl}}?account_name={{.AccountName}}">Raid groups</a> |
+<a href="{{.RaidCalendarUrl}}?account_name={{.AccountName}}">Raid calendar (iCal)</a> |
+<a href="{{.ReportFeedUrl}}?account_name={{.AccountName}}">Newly scanned raids (Atom)</a><br>
 
 <div class="column">
   <h2>Coraiders</h2>
@@ -79,6 +83,8 @@ const accountStatsHtmlTemplate = `{{define "body"}}
 {{- end}}
   </table>
 </div>
+{{- template "role_distribution" .}}
+{{- template "alt_suggestions" .}}
 {{- end}}`
 
 func (r *Renderer) RenderAccountStats(
@@ -88,31 +94,58 @@ func (r *Renderer) RenderAccountStats(
 	characters []datastore.PlayerCoraider,
 	leaderboard []LeaderboardEntry,
 	guildLeaderboard []GuildLeaderboardEntry,
+	altSuggestions []AltSuggestion,
+	roleDistributions []RoleDistribution,
 	playerStatsUrl string,
 	guildStatsUrl string,
+	claimAccountUrl string,
+	raidNetworkUrl string,
+	raidGroupsUrl string,
+	raidCalendarUrl string,
+	reportFeedUrl string,
+	scanReportsUrl string,
+	searchUrl string,
 	oauth2LoginUrl string,
 ) error {
 	return r.templates[accountStatsTemplateName].ExecuteTemplate(wr, baseDefinitionName, struct {
-		Title            string
-		AccountName      string
-		NumRaids         int
-		NumCharacters    int
-		Characters       []datastore.PlayerCoraider
-		Leaderboard      []LeaderboardEntry
-		GuildLeaderboard []GuildLeaderboardEntry
-		PlayerStatsUrl   string
-		GuildStatsUrl    string
-		Oauth2LoginUrl   string
+		Title             string
+		AccountName       string
+		NumRaids          int
+		NumCharacters     int
+		Characters        []datastore.PlayerCoraider
+		Leaderboard       []LeaderboardEntry
+		GuildLeaderboard  []GuildLeaderboardEntry
+		AltSuggestions    []AltSuggestion
+		RoleDistributions []RoleDistribution
+		PlayerStatsUrl    string
+		GuildStatsUrl     string
+		ClaimAccountUrl   string
+		RaidNetworkUrl    string
+		RaidGroupsUrl     string
+		RaidCalendarUrl   string
+		ReportFeedUrl     string
+		ScanReportsUrl    string
+		SearchUrl         string
+		Oauth2LoginUrl    string
 	}{
-		Title:            fmt.Sprintf("#%v", accountName),
-		AccountName:      accountName,
-		NumRaids:         numRaids,
-		NumCharacters:    len(characters),
-		Characters:       characters,
-		Leaderboard:      leaderboard,
-		GuildLeaderboard: guildLeaderboard,
-		PlayerStatsUrl:   playerStatsUrl,
-		GuildStatsUrl:    guildStatsUrl,
-		Oauth2LoginUrl:   oauth2LoginUrl,
+		Title:             fmt.Sprintf("#%v", accountName),
+		AccountName:       accountName,
+		NumRaids:          numRaids,
+		NumCharacters:     len(characters),
+		Characters:        characters,
+		Leaderboard:       leaderboard,
+		GuildLeaderboard:  guildLeaderboard,
+		AltSuggestions:    altSuggestions,
+		RoleDistributions: roleDistributions,
+		PlayerStatsUrl:    playerStatsUrl,
+		GuildStatsUrl:     guildStatsUrl,
+		ClaimAccountUrl:   claimAccountUrl,
+		RaidNetworkUrl:    raidNetworkUrl,
+		RaidGroupsUrl:     raidGroupsUrl,
+		RaidCalendarUrl:   raidCalendarUrl,
+		ReportFeedUrl:     reportFeedUrl,
+		ScanReportsUrl:    scanReportsUrl,
+		SearchUrl:         searchUrl,
+		Oauth2LoginUrl:    oauth2LoginUrl,
 	})
 }
@@ -0,0 +1,41 @@
+package html
+
+import "github.com/FabianHahn/raidlogscan/datastore"
+
+const altSuggestionsHtmlTemplate = `{{define "alt_suggestions"}}
+{{- if .AltSuggestions}}
+<div class="column">
+  <h2>Possible alts</h2>
+  <table>
+    <tr>
+      <th>Name</th>
+      <th>Raids</th>
+      <th>Match</th>
+      <th>Claim</th>
+    </tr>
+{{- range .AltSuggestions}}
+    <tr>
+      <td><a href="{{$.PlayerStatsUrl}}?player_id={{.Character.Id}}">{{.Character.Name}}-{{.Character.Server}} ({{.Character.Class}})</a></td>
+      <td>{{.Character.Count}}</td>
+  {{- if .SharedUploader}}
+      <td>Same Warcraft Logs user</td>
+  {{- else}}
+      <td>{{.Score}}%</td>
+  {{- end}}
+      <td><a href="{{$.ClaimAccountUrl}}?player_id={{.Character.Id}}&account_name={{$.AccountName}}">Add to #{{$.AccountName}}</a></td>
+    </tr>
+{{- end}}
+  </table>
+  <br>
+  Characters that never raided together with<br>
+  this account, but raid with the same people<br>
+  at the same times.
+</div>
+{{- end}}
+{{- end}}`
+
+type AltSuggestion struct {
+	Character      datastore.PlayerCoraider
+	Score          int
+	SharedUploader bool
+}
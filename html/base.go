@@ -42,8 +42,13 @@ const baseHtmlTemplate = `{{define "base"}}
 </head>
 <body>
 <div class="topright">
+    <form action="{{.SearchUrl}}" method="get">
+      <input type="text" name="q" placeholder="Character, #account or guild">
+      <input type="submit" value="Search">
+    </form>
     Missing logs? Scan your own:<br>
-    <a href="{{.Oauth2LoginUrl}}" target="_blank">Log into Warcraft Logs Account</a>
+    <a href="{{.Oauth2LoginUrl}}" target="_blank">Log into Warcraft Logs Account</a><br>
+    or <a href="{{.ScanReportsUrl}}" target="_blank">paste report links</a>
 </div>
 {{- template "body" .}}
 </body>
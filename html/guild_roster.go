@@ -0,0 +1,255 @@
+package html
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/FabianHahn/raidlogscan/datastore"
+)
+
+const guildRosterHtmlTemplate = `{{define "body"}}
+<h1>{{.Title}}</h1>
+<a href="{{.GuildStatsUrl}}?guild_id={{.GuildId}}">Guild stats</a><br>
+{{- if not .CanEdit}}
+<br>
+Guild officers can edit the roster after <a href="{{.Oauth2LoginUrl}}" target="_blank">logging into their Warcraft Logs Account</a>.<br>
+{{- end}}
+
+<div class="column">
+  <h2>Members</h2>
+  <table>
+    <tr>
+      <th>Name</th>
+      <th>Rank</th>
+      <th>Role</th>
+  {{- if .CanEdit}}
+      <th>Edit</th>
+  {{- end}}
+    </tr>
+{{- range .Guild.Roster}}
+    <tr>
+  {{- if .Account}}
+      <td><a href="{{$.AccountStatsUrl}}?account_name={{.Account}}">#{{.Account}}</a></td>
+  {{- else}}
+      <td><a href="{{$.PlayerStatsUrl}}?player_id={{.PlayerId}}">{{.Name}}-{{.Server}} ({{.Class}})</a></td>
+  {{- end}}
+      <td>{{.Rank}}</td>
+      <td>{{.Role}}</td>
+  {{- if $.CanEdit}}
+      <td>
+        <form action="{{$.GuildRosterUrl}}" method="post">
+          <input type="hidden" name="guild_id" value="{{$.GuildId}}">
+          <input type="hidden" name="session" value="{{$.Session}}">
+          <input type="hidden" name="action" value="remove">
+          <input type="hidden" name="account_name" value="{{.Account}}">
+          <input type="hidden" name="player_id" value="{{.PlayerId}}">
+          <input type="submit" value="Remove">
+        </form>
+      </td>
+  {{- end}}
+    </tr>
+{{- end}}
+  </table>
+</div>
+{{- if .CanEdit}}
+
+<div class="column">
+  <h2>Add or update member</h2>
+  <form action="{{.GuildRosterUrl}}" method="post">
+    <input type="hidden" name="guild_id" value="{{.GuildId}}">
+    <input type="hidden" name="session" value="{{.Session}}">
+    <input type="hidden" name="action" value="add">
+    <label for="account_name">Account name:</label><br>
+    <input type="text" id="account_name" name="account_name"><br>
+    <label for="player_id">or player ID of an unclaimed character:</label><br>
+    <input type="text" id="player_id" name="player_id"><br>
+    <label for="rank">Rank:</label><br>
+    <input type="text" id="rank" name="rank"><br>
+    <label for="role">Role:</label><br>
+    <select id="role" name="role">
+      <option value=""></option>
+      <option value="tank">tank</option>
+      <option value="healer">healer</option>
+      <option value="dps">dps</option>
+    </select><br>
+    <br>
+    <input type="submit" value="Save">
+  </form>
+</div>
+{{- end}}
+
+<div class="column">
+  <h2>Bench and absences</h2>
+  <table>
+    <tr>
+      <th>Date</th>
+      <th>Raid</th>
+      <th>Member</th>
+      <th>Kind</th>
+      <th>Note</th>
+  {{- if .CanEdit}}
+      <th>Edit</th>
+  {{- end}}
+    </tr>
+{{- range .Absences}}
+    <tr>
+      <td>{{if not .Raid.StartTime.IsZero}}{{.Raid.StartTime.Format "Mon, 02 Jan 2006"}}{{end}}</td>
+      <td><a href="https://classic.warcraftlogs.com/reports/{{.Raid.Code}}" target="_blank">{{.Raid.Title}}</a></td>
+  {{- if .Member.Account}}
+      <td>#{{.Member.Account}}</td>
+  {{- else}}
+      <td>{{.Member.Name}}</td>
+  {{- end}}
+      <td>{{.Kind}}</td>
+      <td>{{.Note}}</td>
+  {{- if $.CanEdit}}
+      <td>
+        <form action="{{$.GuildRosterUrl}}" method="post">
+          <input type="hidden" name="guild_id" value="{{$.GuildId}}">
+          <input type="hidden" name="session" value="{{$.Session}}">
+          <input type="hidden" name="action" value="absence_remove">
+          <input type="hidden" name="code" value="{{.Raid.Code}}">
+          <input type="hidden" name="member" value="{{.MemberKey}}">
+          <input type="hidden" name="kind" value="{{.Kind}}">
+          <input type="submit" value="Remove">
+        </form>
+      </td>
+  {{- end}}
+    </tr>
+{{- end}}
+  </table>
+{{- if and .CanEdit .Guild.Roster}}
+  <br>
+  <form action="{{.GuildRosterUrl}}" method="post">
+    <input type="hidden" name="guild_id" value="{{.GuildId}}">
+    <input type="hidden" name="session" value="{{.Session}}">
+    <input type="hidden" name="action" value="absence_add">
+    <label for="code">Raid:</label><br>
+    <select id="code" name="code">
+  {{- range .Raids}}
+      <option value="{{.Code}}">{{.StartTime.Format "Mon, 02 Jan 2006"}} {{.Title}}</option>
+  {{- end}}
+    </select><br>
+    <label for="member">Member:</label><br>
+    <select id="member" name="member">
+  {{- range .Guild.Roster}}
+    {{- if .Account}}
+      <option value="#{{.Account}}">#{{.Account}}</option>
+    {{- else}}
+      <option value="{{.PlayerId}}">{{.Name}}-{{.Server}}</option>
+    {{- end}}
+  {{- end}}
+    </select><br>
+    <label for="kind">Kind:</label><br>
+    <select id="kind" name="kind">
+      <option value="benched">benched</option>
+      <option value="excused">excused absence</option>
+    </select><br>
+    <label for="note">Note:</label><br>
+    <input type="text" id="note" name="note"><br>
+    <br>
+    <input type="submit" value="Record">
+  </form>
+{{- end}}
+</div>
+{{- end}}`
+
+type GuildAbsence struct {
+	Raid      GuildRaid
+	Member    datastore.GuildRosterMember
+	MemberKey string
+	Kind      string
+	Note      string
+}
+
+func (r *Renderer) RenderGuildRoster(
+	wr io.Writer,
+	guildId int32,
+	guild datastore.Guild,
+	raids []GuildRaid,
+	canEdit bool,
+	session string,
+	accountStatsUrl string,
+	playerStatsUrl string,
+	guildStatsUrl string,
+	guildRosterUrl string,
+	scanReportsUrl string,
+	searchUrl string,
+	oauth2LoginUrl string,
+) error {
+	title := fmt.Sprintf("%v Roster", guild.Name)
+	if guild.Name == "" {
+		title = fmt.Sprintf("Guild %v Roster", guildId)
+	}
+
+	raidsByCode := map[string]GuildRaid{}
+	for _, raid := range raids {
+		raidsByCode[raid.Code] = raid
+	}
+	members := map[string]datastore.GuildRosterMember{}
+	for _, member := range guild.Roster {
+		members[datastore.GuildMemberKey(member.Account, member.PlayerId)] = member
+	}
+	absences := []GuildAbsence{}
+	for _, absence := range guild.Absences {
+		memberKey := datastore.GuildMemberKey(absence.Account, absence.PlayerId)
+		member, ok := members[memberKey]
+		if !ok {
+			member = datastore.GuildRosterMember{
+				Account:  absence.Account,
+				PlayerId: absence.PlayerId,
+				Name:     memberKey,
+			}
+		}
+		raid, ok := raidsByCode[absence.Code]
+		if !ok {
+			raid = GuildRaid{
+				Code:  absence.Code,
+				Title: absence.Code,
+			}
+		}
+		absences = append(absences, GuildAbsence{
+			Raid:      raid,
+			Member:    member,
+			MemberKey: memberKey,
+			Kind:      absence.Kind,
+			Note:      absence.Note,
+		})
+	}
+	sort.SliceStable(absences, func(i int, j int) bool {
+		return absences[i].Raid.StartTime.After(absences[j].Raid.StartTime)
+	})
+
+	return r.templates[guildRosterTemplateName].ExecuteTemplate(wr, baseDefinitionName, struct {
+		Title           string
+		GuildId         int32
+		Guild           datastore.Guild
+		Raids           []GuildRaid
+		Absences        []GuildAbsence
+		CanEdit         bool
+		Session         string
+		AccountStatsUrl string
+		PlayerStatsUrl  string
+		GuildStatsUrl   string
+		GuildRosterUrl  string
+		ScanReportsUrl  string
+		SearchUrl       string
+		Oauth2LoginUrl  string
+	}{
+		Title:           title,
+		GuildId:         guildId,
+		Guild:           guild,
+		Raids:           raids,
+		Absences:        absences,
+		CanEdit:         canEdit,
+		Session:         session,
+		AccountStatsUrl: accountStatsUrl,
+		PlayerStatsUrl:  playerStatsUrl,
+		GuildStatsUrl:   guildStatsUrl,
+		GuildRosterUrl:  guildRosterUrl,
+		ScanReportsUrl:  scanReportsUrl,
+		SearchUrl:       searchUrl,
+		Oauth2LoginUrl:  oauth2LoginUrl,
+	})
+}
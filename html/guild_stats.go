@@ -4,18 +4,73 @@ import (
 	"fmt"
 	"io"
 	"time"
+
+	"github.com/FabianHahn/raidlogscan/datastore"
 )
 
 const guildStatsHtmlTemplate = `{{define "body"}}
-<h1>{{.GuildName}}</h1>
+<h1>{{.Guild.Name}}</h1>
 <b>Wacraft Logs</b>: <a href="https://classic.warcraftlogs.com/guild/id/{{.GuildId}}" target="_blank">link</a><br>
-<b>Raiders</b>: {{len .Leaderboard}}<br>
-<b>Raids</b>: {{len .Raids}}<br>
+{{- if .Guild.Server}}
+<b>Server</b>: {{.Guild.Server}}<br>
+{{- end}}
+{{- if .Guild.Faction}}
+<b>Faction</b>: {{.Guild.Faction}}<br>
+{{- end}}
+<b>Members</b>: {{len .Members}}<br>
+<b>PUGs</b>: {{len .Leaderboard}}<br>
+<b>Raids</b>: {{.NumRaids}}<br>
+{{- if not .Guild.LastScanTime.IsZero}}
+<b>Last scanned</b>: {{.Guild.LastScanTime.Format "Mon, 02 Jan 2006 15:04:05 MST"}}<br>
+{{- end}}
+<a href="{{.GuildRosterUrl}}?guild_id={{.GuildId}}">Roster</a><br>
+<a href="{{.RaidNetworkUrl}}?guild_id={{.GuildId}}">Raid network</a><br>
+<a href="{{.RaidCalendarUrl}}?guild_id={{.GuildId}}">Raid calendar (iCal)</a><br>
+<a href="{{.ReportFeedUrl}}?guild_id={{.GuildId}}">Newly scanned raids (Atom)</a><br>
 <br>
 <a href="{{.ScanGuildReportsUrl}}?guild_id={{.GuildId}}">Scan latest logs for this guild / raid team.</a><br>
+{{- if .Members}}
 
 <div class="column">
-  <h2>Raiders</h2>
+  <h2>Members</h2>
+  Attendance counts raids in the logs (present), additionally raids on the bench (present or benched), and further leaves
+  out raids with excused absences (excused).<br>
+  <br>
+  <table>
+    <tr>
+      <th>Name</th>
+      <th>Rank</th>
+      <th>Role</th>
+      <th>Raids</th>
+      <th>Benched</th>
+      <th>Excused</th>
+      <th>Attendance<br>(present)</th>
+      <th>Attendance<br>(present or benched)</th>
+      <th>Attendance<br>(excused)</th>
+    </tr>
+{{- range .Members}}
+    <tr>
+  {{- if .Entry.IsAccount}}
+      <td><a href="{{$.AccountStatsUrl}}?account_name={{.Entry.Account}}">#{{.Entry.Account}}</a></td>
+  {{- else}}
+      <td><a href="{{$.PlayerStatsUrl}}?player_id={{.Entry.Character.Id}}">{{.Entry.Character.Name}}-{{.Entry.Character.Server}} ({{.Entry.Character.Class}})</a></td>
+  {{- end}}
+      <td>{{.Rank}}</td>
+      <td>{{.Role}}</td>
+      <td>{{.Entry.Count}}</td>
+      <td>{{.Benched}}</td>
+      <td>{{.Excused}}</td>
+      <td>{{.AttendancePresent}}%</td>
+      <td>{{.AttendancePresentOrBenched}}%</td>
+      <td>{{.AttendanceExcused}}%</td>
+    </tr>
+{{- end}}
+  </table>
+</div>
+{{- end}}
+
+<div class="column">
+  <h2>{{if .Members}}PUGs{{else}}Raiders{{end}}</h2>
   <table>
     <tr>
       <th>Name</th>
@@ -45,57 +100,110 @@ const guildStatsHtmlTemplate = `{{define "body"}}
       <th>Title</th>
       <th>Zone</th>
       <th>Raiders</th>
+      <th>Tanks</th>
+      <th>Healers</th>
+      <th>DPS</th>
+      <th>Benched</th>
+      <th>Excused</th>
     </tr>
 {{- range .Raids}}
     <tr>
       <td>{{.StartTime.Format "Mon, 02 Jan 2006 15:04:05 MST"}}</td>
-      <td><a href="https://classic.warcraftlogs.com/reports/{{.Code}}" target="_blank">{{.Title}}</a></td>
+      <td><a href="{{$.ReportStatsUrl}}?code={{.Code}}">{{.Title}}</a></td>
       <td>{{.Zone}}</td>
       <td>{{.NumPlayers}}</td>
+      <td>{{.NumTanks}}</td>
+      <td>{{.NumHealers}}</td>
+      <td>{{.NumDps}}</td>
+      <td>{{.NumBenched}}</td>
+      <td>{{.NumExcused}}</td>
     </tr>
 {{- end}}
   </table>
 </div>
 {{- end}}`
 
+type GuildMember struct {
+	Entry                      LeaderboardEntry
+	Rank                       string
+	Role                       string
+	Benched                    int64
+	Excused                    int64
+	AttendancePresent          int64
+	AttendancePresentOrBenched int64
+	AttendanceExcused          int64
+}
+
 type GuildRaid struct {
 	Code       string
 	StartTime  time.Time
 	Title      string
 	Zone       string
 	NumPlayers int
+	NumTanks   int
+	NumHealers int
+	NumDps     int
+	NumBenched int
+	NumExcused int
 }
 
 func (r *Renderer) RenderGuildStats(
 	wr io.Writer,
 	guildId int32,
-	guildName string,
+	guild datastore.Guild,
+	members []GuildMember,
 	leaderboard []LeaderboardEntry,
+	numRaids int64,
 	raids []GuildRaid,
 	scanGuildReportsUrl string,
 	accountStatsUrl string,
 	playerStatsUrl string,
+	reportStatsUrl string,
+	guildRosterUrl string,
+	raidNetworkUrl string,
+	raidCalendarUrl string,
+	reportFeedUrl string,
+	scanReportsUrl string,
+	searchUrl string,
 	oauth2LoginUrl string,
 ) error {
 	return r.templates[guildStatsTemplateName].ExecuteTemplate(wr, baseDefinitionName, struct {
 		Title               string
 		GuildId             int32
-		GuildName           string
+		Guild               datastore.Guild
+		Members             []GuildMember
 		Leaderboard         []LeaderboardEntry
+		NumRaids            int64
 		Raids               []GuildRaid
 		ScanGuildReportsUrl string
 		AccountStatsUrl     string
 		PlayerStatsUrl      string
+		ReportStatsUrl      string
+		GuildRosterUrl      string
+		RaidNetworkUrl      string
+		RaidCalendarUrl     string
+		ReportFeedUrl       string
+		ScanReportsUrl      string
+		SearchUrl           string
 		Oauth2LoginUrl      string
 	}{
-		Title:               fmt.Sprintf("%v", guildName),
+		Title:               fmt.Sprintf("%v", guild.Name),
 		GuildId:             guildId,
-		GuildName:           guildName,
+		Guild:               guild,
+		Members:             members,
 		Leaderboard:         leaderboard,
+		NumRaids:            numRaids,
 		Raids:               raids,
 		ScanGuildReportsUrl: scanGuildReportsUrl,
 		AccountStatsUrl:     accountStatsUrl,
 		PlayerStatsUrl:      playerStatsUrl,
+		ReportStatsUrl:      reportStatsUrl,
+		GuildRosterUrl:      guildRosterUrl,
+		RaidNetworkUrl:      raidNetworkUrl,
+		RaidCalendarUrl:     raidCalendarUrl,
+		ReportFeedUrl:       reportFeedUrl,
+		ScanReportsUrl:      scanReportsUrl,
+		SearchUrl:           searchUrl,
 		Oauth2LoginUrl:      oauth2LoginUrl,
 	})
 }
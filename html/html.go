@@ -10,6 +10,14 @@ const (
 	accountStatsTemplateName = "account_stats.html"
 	playerStatsTemplateName  = "player_stats.html"
 	guildStatsTemplateName   = "guild_stats.html"
+	raidNetworkTemplateName  = "raid_network.html"
+	raidGroupsTemplateName   = "raid_groups.html"
+	searchTemplateName       = "search.html"
+	guildRosterTemplateName  = "guild_roster.html"
+	reportStatsTemplateName  = "report_stats.html"
+	scanReportsTemplateName  = "scan_reports.html"
+
+	scanReportsDefinitionName = "scan_reports"
 )
 
 type Renderer struct {
@@ -20,19 +28,55 @@ func CreateRendererOrDie() *Renderer {
 	templates := map[string]*template.Template{}
 	templates[accountStatsTemplateName] = template.Must(
 		template.Must(
-			template.New(accountStatsTemplateName).
-				Parse(accountStatsHtmlTemplate)).
+			template.Must(
+				template.Must(
+					template.New(accountStatsTemplateName).
+						Parse(accountStatsHtmlTemplate)).
+					Parse(altSuggestionsHtmlTemplate)).
+				Parse(roleDistributionHtmlTemplate)).
 			Parse(baseHtmlTemplate))
 	templates[playerStatsTemplateName] = template.Must(
 		template.Must(
-			template.New(playerStatsTemplateName).
-				Parse(playerStatsHtmlTemplate)).
+			template.Must(
+				template.Must(
+					template.New(playerStatsTemplateName).
+						Parse(playerStatsHtmlTemplate)).
+					Parse(altSuggestionsHtmlTemplate)).
+				Parse(roleDistributionHtmlTemplate)).
 			Parse(baseHtmlTemplate))
 	templates[guildStatsTemplateName] = template.Must(
 		template.Must(
 			template.New(guildStatsTemplateName).
 				Parse(guildStatsHtmlTemplate)).
 			Parse(baseHtmlTemplate))
+	templates[raidNetworkTemplateName] = template.Must(
+		template.Must(
+			template.New(raidNetworkTemplateName).
+				Parse(raidNetworkHtmlTemplate)).
+			Parse(baseHtmlTemplate))
+	templates[raidGroupsTemplateName] = template.Must(
+		template.Must(
+			template.New(raidGroupsTemplateName).
+				Parse(raidGroupsHtmlTemplate)).
+			Parse(baseHtmlTemplate))
+	templates[searchTemplateName] = template.Must(
+		template.Must(
+			template.New(searchTemplateName).
+				Parse(searchHtmlTemplate)).
+			Parse(baseHtmlTemplate))
+	templates[guildRosterTemplateName] = template.Must(
+		template.Must(
+			template.New(guildRosterTemplateName).
+				Parse(guildRosterHtmlTemplate)).
+			Parse(baseHtmlTemplate))
+	templates[reportStatsTemplateName] = template.Must(
+		template.Must(
+			template.New(reportStatsTemplateName).
+				Parse(reportStatsHtmlTemplate)).
+			Parse(baseHtmlTemplate))
+	templates[scanReportsTemplateName] = template.Must(
+		template.New(scanReportsTemplateName).
+			Parse(scanReportsHtmlTemplate))
 	return &Renderer{
 		templates: templates,
 	}
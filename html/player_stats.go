@@ -15,6 +15,8 @@ const playerStatsHtmlTemplate = `{{define "body"}}
 {{- if .HasAccount}}
   <b>Account</b>: <a href="{{.AccountStatsUrl}}?account_name={{.Player.Account}}">#{{.Player.Account}}</a><br>
 {{- end}}
+  <a href="{{.RaidNetworkUrl}}?player_id={{.PlayerId}}">Raid network</a><br>
+  <a href="{{.ReportFeedUrl}}?player_id={{.PlayerId}}">Newly scanned raids (Atom)</a><br>
   <br>
 
   <form action="{{.ClaimAccountUrl}}" method="get">
@@ -73,7 +75,7 @@ const playerStatsHtmlTemplate = `{{define "body"}}
   {{- if not .Duplicate}}
     <tr>
       <td>{{.StartTime.Format "Mon, 02 Jan 2006 15:04:05 MST"}}</td>
-      <td><a href="https://classic.warcraftlogs.com/reports/{{.Code}}" target="_blank">{{.Title}}</a></td>
+      <td><a href="{{$.ReportStatsUrl}}?code={{.Code}}">{{.Title}}</a></td>
       <td>
     {{- if ne .GuildId 0}}
         <a href="{{$.GuildStatsUrl}}?guild_id={{.GuildId}}">{{.GuildName}}</a></td>
@@ -87,6 +89,8 @@ const playerStatsHtmlTemplate = `{{define "body"}}
 {{- end}}
   </table>
 </div>
+{{- template "role_distribution" .}}
+{{- template "alt_suggestions" .}}
 {{- end}}`
 
 func (r *Renderer) RenderPlayerStats(
@@ -94,30 +98,56 @@ func (r *Renderer) RenderPlayerStats(
 	playerId int64,
 	player datastore.Player,
 	leaderboard []LeaderboardEntry,
+	altSuggestions []AltSuggestion,
+	roleDistributions []RoleDistribution,
+	playerStatsUrl string,
 	accountStatsUrl string,
 	guildStatsUrl string,
+	reportStatsUrl string,
 	claimAccountUrl string,
+	raidNetworkUrl string,
+	reportFeedUrl string,
+	scanReportsUrl string,
+	searchUrl string,
 	oauth2LoginUrl string,
 ) error {
 	return r.templates[playerStatsTemplateName].ExecuteTemplate(wr, baseDefinitionName, struct {
-		Title           string
-		PlayerId        int64
-		Player          datastore.Player
-		HasAccount      bool
-		Leaderboard     []LeaderboardEntry
-		AccountStatsUrl string
-		GuildStatsUrl   string
-		ClaimAccountUrl string
-		Oauth2LoginUrl  string
+		Title             string
+		PlayerId          int64
+		Player            datastore.Player
+		HasAccount        bool
+		AccountName       string
+		Leaderboard       []LeaderboardEntry
+		AltSuggestions    []AltSuggestion
+		RoleDistributions []RoleDistribution
+		PlayerStatsUrl    string
+		AccountStatsUrl   string
+		GuildStatsUrl     string
+		ReportStatsUrl    string
+		ClaimAccountUrl   string
+		RaidNetworkUrl    string
+		ReportFeedUrl     string
+		ScanReportsUrl    string
+		SearchUrl         string
+		Oauth2LoginUrl    string
 	}{
-		Title:           fmt.Sprintf("%v-%v (%v)", player.Name, player.Server, player.Class),
-		PlayerId:        playerId,
-		Player:          player,
-		HasAccount:      player.Account != "",
-		Leaderboard:     leaderboard,
-		AccountStatsUrl: accountStatsUrl,
-		GuildStatsUrl:   guildStatsUrl,
-		ClaimAccountUrl: claimAccountUrl,
-		Oauth2LoginUrl:  oauth2LoginUrl,
+		Title:             fmt.Sprintf("%v-%v (%v)", player.Name, player.Server, player.Class),
+		PlayerId:          playerId,
+		Player:            player,
+		HasAccount:        player.Account != "",
+		AccountName:       player.Account,
+		Leaderboard:       leaderboard,
+		AltSuggestions:    altSuggestions,
+		RoleDistributions: roleDistributions,
+		PlayerStatsUrl:    playerStatsUrl,
+		AccountStatsUrl:   accountStatsUrl,
+		GuildStatsUrl:     guildStatsUrl,
+		ReportStatsUrl:    reportStatsUrl,
+		ClaimAccountUrl:   claimAccountUrl,
+		RaidNetworkUrl:    raidNetworkUrl,
+		ReportFeedUrl:     reportFeedUrl,
+		ScanReportsUrl:    scanReportsUrl,
+		SearchUrl:         searchUrl,
+		Oauth2LoginUrl:    oauth2LoginUrl,
 	})
 }
@@ -0,0 +1,95 @@
+package html
+
+import (
+	"io"
+
+	"github.com/FabianHahn/raidlogscan/datastore"
+)
+
+const raidGroupsHtmlTemplate = `{{define "body"}}
+<div>
+{{- if .AccountName}}
+  <h1>Raid groups of <a href="{{.AccountStatsUrl}}?account_name={{.AccountName}}">#{{.AccountName}}</a></h1>
+{{- else}}
+  <h1>Raid groups</h1>
+{{- end}}
+  Groups of players that keep raiding together, across guilds and PUGs.<br>
+  A raid counts for a group if at least half of its members were present.<br>
+</div>
+{{- range .RaidGroups}}
+
+<div>
+  <h2>{{len .Members}} members, {{.NumRaids}} raids</h2>
+  <b>Active</b>: {{.FirstRaid.Format "02 Jan 2006"}} - {{.LastRaid.Format "02 Jan 2006"}}<br>
+  {{- if .Guilds}}
+  <b>Guilds / Raid Teams</b>:
+    {{- range $index, $guild := .Guilds}}
+    {{- if $index}},{{end}} <a href="{{$.GuildStatsUrl}}?guild_id={{$guild.GuildId}}">{{$guild.GuildName}}</a> ({{$guild.Count}})
+    {{- end}}<br>
+  {{- end}}
+  <table>
+    <tr>
+      <th>Name</th>
+      <th>Raids with group</th>
+    </tr>
+  {{- range .Members}}
+    {{- if .Account}}
+    <tr>
+      <td><a href="{{$.AccountStatsUrl}}?account_name={{.Account}}">#{{.Account}}</a></td>
+      <td>{{.Count}}</td>
+    </tr>
+    {{- else}}
+    <tr>
+      <td><a href="{{$.PlayerStatsUrl}}?player_id={{.PlayerId}}">{{.Name}}-{{.Server}} ({{.Class}})</a></td>
+      <td>{{.Count}}</td>
+    </tr>
+    {{- end}}
+  {{- end}}
+  </table>
+</div>
+{{- else}}
+
+<div>
+  No raid groups found.
+</div>
+{{- end}}
+{{- end}}`
+
+func (r *Renderer) RenderRaidGroups(
+	wr io.Writer,
+	accountName string,
+	raidGroups []datastore.RaidGroup,
+	accountStatsUrl string,
+	playerStatsUrl string,
+	guildStatsUrl string,
+	scanReportsUrl string,
+	searchUrl string,
+	oauth2LoginUrl string,
+) error {
+	title := "Raid groups"
+	if accountName != "" {
+		title = "Raid groups of #" + accountName
+	}
+
+	return r.templates[raidGroupsTemplateName].ExecuteTemplate(wr, baseDefinitionName, struct {
+		Title           string
+		AccountName     string
+		RaidGroups      []datastore.RaidGroup
+		AccountStatsUrl string
+		PlayerStatsUrl  string
+		GuildStatsUrl   string
+		ScanReportsUrl  string
+		SearchUrl       string
+		Oauth2LoginUrl  string
+	}{
+		Title:           title,
+		AccountName:     accountName,
+		RaidGroups:      raidGroups,
+		AccountStatsUrl: accountStatsUrl,
+		PlayerStatsUrl:  playerStatsUrl,
+		GuildStatsUrl:   guildStatsUrl,
+		ScanReportsUrl:  scanReportsUrl,
+		SearchUrl:       searchUrl,
+		Oauth2LoginUrl:  oauth2LoginUrl,
+	})
+}
@@ -0,0 +1,224 @@
+package html
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/FabianHahn/raidlogscan/network"
+)
+
+const raidNetworkHtmlTemplate = `{{define "body"}}
+<div>
+  <h1>Raid network: {{.Name}}</h1>
+  <b>Nodes</b>: {{len .Graph.Nodes}}<br>
+  <b>Connections</b>: {{len .Graph.Edges}}<br>
+  <br>
+  <form method="get">
+{{- range $name, $values := .Query}}
+  {{- if and (ne $name "depth") (ne $name "min_weight")}}
+    <input type="hidden" name="{{$name}}" value="{{index $values 0}}">
+  {{- end}}
+{{- end}}
+    <label for="depth">Depth:</label>
+    <select id="depth" name="depth">
+      <option value="1"{{if eq .Depth 1}} selected{{end}}>1</option>
+      <option value="2"{{if eq .Depth 2}} selected{{end}}>2</option>
+    </select>&nbsp;
+    <label for="min_weight">Minimum shared raids:</label>
+    <input type="number" id="min_weight" name="min_weight" min="1" value="{{.MinWeight}}">&nbsp;
+    <input type="submit" value="Update">
+  </form>
+  Export:
+  <a href="{{.GraphmlUrl}}">GraphML</a> |
+  <a href="{{.GexfUrl}}">GEXF</a> |
+  <a href="{{.JsonUrl}}">JSON</a>
+</div>
+
+<div>
+  <canvas id="network" width="1200" height="800" style="border: 1px solid black;"></canvas>
+</div>
+
+<script>
+(function() {
+  var graph = {{.Graph}};
+  var accountStatsUrl = {{.AccountStatsUrl}};
+  var playerStatsUrl = {{.PlayerStatsUrl}};
+  var canvas = document.getElementById("network");
+  var context = canvas.getContext("2d");
+
+  var nodes = {};
+  var maxWeight = 1;
+  graph.nodes.forEach(function(node) {
+    node.x = canvas.width / 2 + (Math.random() - 0.5) * canvas.width / 2;
+    node.y = canvas.height / 2 + (Math.random() - 0.5) * canvas.height / 2;
+    node.vx = 0;
+    node.vy = 0;
+    nodes[node.id] = node;
+  });
+  graph.edges.forEach(function(edge) {
+    maxWeight = Math.max(maxWeight, edge.weight);
+  });
+
+  function step() {
+    var list = graph.nodes;
+    for (var i = 0; i < list.length; i++) {
+      for (var j = i + 1; j < list.length; j++) {
+        var dx = list[j].x - list[i].x;
+        var dy = list[j].y - list[i].y;
+        var distanceSquared = Math.max(dx * dx + dy * dy, 1);
+        var force = 2000 / distanceSquared;
+        var distance = Math.sqrt(distanceSquared);
+        list[i].vx -= force * dx / distance;
+        list[i].vy -= force * dy / distance;
+        list[j].vx += force * dx / distance;
+        list[j].vy += force * dy / distance;
+      }
+    }
+    graph.edges.forEach(function(edge) {
+      var source = nodes[edge.source];
+      var target = nodes[edge.target];
+      var strength = 0.002 * (1 + Math.log(edge.weight));
+      var dx = target.x - source.x;
+      var dy = target.y - source.y;
+      source.vx += dx * strength;
+      source.vy += dy * strength;
+      target.vx -= dx * strength;
+      target.vy -= dy * strength;
+    });
+    list.forEach(function(node) {
+      if (node === dragged) {
+        return;
+      }
+      node.vx += (canvas.width / 2 - node.x) * 0.0005;
+      node.vy += (canvas.height / 2 - node.y) * 0.0005;
+      node.vx *= 0.8;
+      node.vy *= 0.8;
+      node.x = Math.min(Math.max(node.x + node.vx, 10), canvas.width - 10);
+      node.y = Math.min(Math.max(node.y + node.vy, 10), canvas.height - 10);
+    });
+  }
+
+  function draw() {
+    context.clearRect(0, 0, canvas.width, canvas.height);
+    graph.edges.forEach(function(edge) {
+      var source = nodes[edge.source];
+      var target = nodes[edge.target];
+      context.strokeStyle = "rgba(0, 0, 0, " + (0.1 + 0.6 * edge.weight / maxWeight) + ")";
+      context.lineWidth = 1 + 4 * edge.weight / maxWeight;
+      context.beginPath();
+      context.moveTo(source.x, source.y);
+      context.lineTo(target.x, target.y);
+      context.stroke();
+    });
+    graph.nodes.forEach(function(node) {
+      context.fillStyle = node.isRoot ? "#d04040" : (node.isAccount ? "#4060d0" : "#808080");
+      context.beginPath();
+      context.arc(node.x, node.y, node.isRoot ? 8 : 5, 0, 2 * Math.PI);
+      context.fill();
+      context.fillStyle = "black";
+      context.fillText(node.label, node.x + 8, node.y - 8);
+    });
+  }
+
+  var dragged = null;
+  var moved = false;
+  function nodeAt(event) {
+    var rect = canvas.getBoundingClientRect();
+    var x = event.clientX - rect.left;
+    var y = event.clientY - rect.top;
+    for (var i = 0; i < graph.nodes.length; i++) {
+      var node = graph.nodes[i];
+      if ((node.x - x) * (node.x - x) + (node.y - y) * (node.y - y) < 64) {
+        return node;
+      }
+    }
+    return null;
+  }
+  canvas.addEventListener("mousedown", function(event) {
+    dragged = nodeAt(event);
+    moved = false;
+  });
+  canvas.addEventListener("mousemove", function(event) {
+    if (dragged) {
+      var rect = canvas.getBoundingClientRect();
+      dragged.x = event.clientX - rect.left;
+      dragged.y = event.clientY - rect.top;
+      moved = true;
+    }
+  });
+  canvas.addEventListener("mouseup", function(event) {
+    if (dragged && !moved) {
+      if (dragged.isAccount) {
+        window.location = accountStatsUrl + "?account_name=" + encodeURIComponent(dragged.account);
+      } else {
+        window.location = playerStatsUrl + "?player_id=" + dragged.playerId;
+      }
+    }
+    dragged = null;
+  });
+
+  function frame() {
+    step();
+    draw();
+    window.requestAnimationFrame(frame);
+  }
+  frame();
+})();
+</script>
+{{- end}}`
+
+func (r *Renderer) RenderRaidNetwork(
+	wr io.Writer,
+	name string,
+	graph network.Graph,
+	depth int,
+	minWeight int64,
+	query url.Values,
+	accountStatsUrl string,
+	playerStatsUrl string,
+	scanReportsUrl string,
+	searchUrl string,
+	oauth2LoginUrl string,
+) error {
+	exportUrl := func(format string) string {
+		exportQuery := url.Values{}
+		for name, values := range query {
+			exportQuery[name] = values
+		}
+		exportQuery.Set("format", format)
+		return "?" + exportQuery.Encode()
+	}
+
+	return r.templates[raidNetworkTemplateName].ExecuteTemplate(wr, baseDefinitionName, struct {
+		Title           string
+		Name            string
+		Graph           network.Graph
+		Depth           int
+		MinWeight       int64
+		Query           url.Values
+		GraphmlUrl      string
+		GexfUrl         string
+		JsonUrl         string
+		AccountStatsUrl string
+		PlayerStatsUrl  string
+		ScanReportsUrl  string
+		SearchUrl       string
+		Oauth2LoginUrl  string
+	}{
+		Title:           fmt.Sprintf("Raid network: %v", name),
+		Name:            name,
+		Graph:           graph,
+		Depth:           depth,
+		MinWeight:       minWeight,
+		Query:           query,
+		GraphmlUrl:      exportUrl("graphml"),
+		GexfUrl:         exportUrl("gexf"),
+		JsonUrl:         exportUrl("json"),
+		AccountStatsUrl: accountStatsUrl,
+		PlayerStatsUrl:  playerStatsUrl,
+		ScanReportsUrl:  scanReportsUrl,
+		SearchUrl:       searchUrl,
+		Oauth2LoginUrl:  oauth2LoginUrl,
+	})
+}
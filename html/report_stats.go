@@ -0,0 +1,190 @@
+package html
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/FabianHahn/raidlogscan/datastore"
+)
+
+const reportStatsHtmlTemplate = `{{define "body"}}
+<h1>{{.Report.Title}}</h1>
+<b>Date</b>: {{.Report.StartTime.Format "Mon, 02 Jan 2006 15:04:05 MST"}}<br>
+<b>Zone</b>: {{.Report.Zone}}<br>
+{{- if ne .Report.GuildId 0}}
+<b>Guild / Raid team</b>: <a href="{{.GuildStatsUrl}}?guild_id={{.Report.GuildId}}">{{.Report.GuildName}}</a><br>
+{{- end}}
+<b>Warcraft Logs</b>: <a href="https://classic.warcraftlogs.com/reports/{{.Code}}" target="_blank">link</a><br>
+<b>Raiders</b>: {{.NumRaiders}}<br>
+{{- if ne .Report.GuildId 0}}
+<b>First raid with this guild</b>: {{.NumFirstTime}}<br>
+<b>Regulars</b>: {{.NumRegulars}}<br>
+{{- end}}
+
+<div class="column">
+  <h2>Raiders</h2>
+{{- range .RoleGroups}}
+  <h3>{{.Role}} ({{len .Raiders}})</h3>
+  <table>
+    <tr>
+      <th>Name</th>
+      <th>Class</th>
+      <th>Spec</th>
+      <th>Account</th>
+  {{- if ne $.Report.GuildId 0}}
+      <th>Guild raids</th>
+      <th></th>
+  {{- end}}
+    </tr>
+  {{- range .Raiders}}
+    <tr>
+      <td><a href="{{$.PlayerStatsUrl}}?player_id={{.Player.Id}}">{{.Player.Name}}-{{.Player.Server}}</a></td>
+      <td>{{.Player.Class}}</td>
+      <td>{{.Player.Spec}}</td>
+      <td>
+    {{- if .Account}}
+        <a href="{{$.AccountStatsUrl}}?account_name={{.Account}}">#{{.Account}}</a>
+    {{- end}}
+      </td>
+    {{- if ne $.Report.GuildId 0}}
+      <td>{{.GuildRaids}}</td>
+      <td>{{if .FirstTime}}first raid{{else if .Regular}}regular{{end}}</td>
+    {{- end}}
+    </tr>
+  {{- end}}
+  </table>
+{{- end}}
+</div>
+
+<div class="column">
+  <h2>Composition</h2>
+  <table>
+    <tr>
+      <th>Role</th>
+      <th>Raiders</th>
+    </tr>
+{{- range .Roles}}
+    <tr>
+      <td>{{.Name}}</td>
+      <td>{{.Count}}</td>
+    </tr>
+{{- end}}
+  </table>
+  <br>
+  <table>
+    <tr>
+      <th>Class</th>
+      <th>Raiders</th>
+    </tr>
+{{- range .Classes}}
+    <tr>
+      <td>{{.Name}}</td>
+      <td>{{.Count}}</td>
+    </tr>
+{{- end}}
+  </table>
+  <br>
+  <table>
+    <tr>
+      <th>Spec</th>
+      <th>Raiders</th>
+    </tr>
+{{- range .Specs}}
+    <tr>
+      <td>{{.Name}}</td>
+      <td>{{.Count}}</td>
+    </tr>
+{{- end}}
+  </table>
+</div>
+
+<div class="column">
+  <h2>Accounts</h2>
+  <table>
+    <tr>
+      <th>Name</th>
+    </tr>
+{{- range .Accounts}}
+    <tr>
+      <td><a href="{{$.AccountStatsUrl}}?account_name={{.}}">#{{.}}</a></td>
+    </tr>
+{{- end}}
+  </table>
+</div>
+{{- end}}`
+
+type ReportCount struct {
+	Name  string
+	Count int
+}
+
+type ReportRoleGroup struct {
+	Role    string
+	Raiders []ReportRaider
+}
+
+type ReportRaider struct {
+	Player     datastore.ReportPlayer
+	Account    string
+	GuildRaids int64
+	FirstTime  bool
+	Regular    bool
+}
+
+func (r *Renderer) RenderReportStats(
+	wr io.Writer,
+	code string,
+	report datastore.Report,
+	numRaiders int,
+	roleGroups []ReportRoleGroup,
+	roles []ReportCount,
+	classes []ReportCount,
+	specs []ReportCount,
+	accounts []string,
+	numFirstTime int,
+	numRegulars int,
+	accountStatsUrl string,
+	playerStatsUrl string,
+	guildStatsUrl string,
+	scanReportsUrl string,
+	searchUrl string,
+	oauth2LoginUrl string,
+) error {
+	return r.templates[reportStatsTemplateName].ExecuteTemplate(wr, baseDefinitionName, struct {
+		Title           string
+		Code            string
+		Report          datastore.Report
+		NumRaiders      int
+		RoleGroups      []ReportRoleGroup
+		Roles           []ReportCount
+		Classes         []ReportCount
+		Specs           []ReportCount
+		Accounts        []string
+		NumFirstTime    int
+		NumRegulars     int
+		AccountStatsUrl string
+		PlayerStatsUrl  string
+		GuildStatsUrl   string
+		ScanReportsUrl  string
+		SearchUrl       string
+		Oauth2LoginUrl  string
+	}{
+		Title:           fmt.Sprintf("%v (%v)", report.Title, report.StartTime.Format("02 Jan 2006")),
+		Code:            code,
+		Report:          report,
+		NumRaiders:      numRaiders,
+		RoleGroups:      roleGroups,
+		Roles:           roles,
+		Classes:         classes,
+		Specs:           specs,
+		Accounts:        accounts,
+		NumFirstTime:    numFirstTime,
+		NumRegulars:     numRegulars,
+		AccountStatsUrl: accountStatsUrl,
+		PlayerStatsUrl:  playerStatsUrl,
+		GuildStatsUrl:   guildStatsUrl,
+		ScanReportsUrl:  scanReportsUrl,
+		SearchUrl:       searchUrl,
+		Oauth2LoginUrl:  oauth2LoginUrl,
+	})
+}
@@ -0,0 +1,46 @@
+package html
+
+const roleDistributionHtmlTemplate = `{{define "role_distribution"}}
+{{- if .RoleDistributions}}
+<div class="column">
+  <h2>Roles and specs</h2>
+  <table>
+    <tr>
+      <th>Window</th>
+      <th>Raids</th>
+      <th>Roles</th>
+      <th>Specs</th>
+    </tr>
+{{- range .RoleDistributions}}
+    <tr>
+      <td>{{.Window}}</td>
+      <td>{{.NumRaids}}</td>
+      <td>
+  {{- range $i, $role := .Roles}}
+    {{- if $i}}<br>{{end}}{{$role.Percentage}}% {{$role.Name}}
+  {{- end}}
+      </td>
+      <td>
+  {{- range $i, $spec := .Specs}}
+    {{- if $i}}<br>{{end}}{{$spec.Percentage}}% {{$spec.Name}}
+  {{- end}}
+      </td>
+    </tr>
+{{- end}}
+  </table>
+</div>
+{{- end}}
+{{- end}}`
+
+type RoleShare struct {
+	Name       string
+	Count      int64
+	Percentage int64
+}
+
+type RoleDistribution struct {
+	Window   string
+	NumRaids int64
+	Roles    []RoleShare
+	Specs    []RoleShare
+}
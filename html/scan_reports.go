@@ -0,0 +1,78 @@
+package html
+
+import (
+	"io"
+)
+
+const scanReportsHtmlTemplate = `{{define "scan_reports"}}
+<html>
+<head>
+  <title>Scan reports - WoW Raid Stats</title>
+{{- if .NumPending}}
+  <meta http-equiv="refresh" content="10">
+{{- end}}
+</head>
+<body>
+<h1>Scan reports</h1>
+{{- if .Reports}}
+{{.NumScanned}} of {{len .Reports}} reports scanned.<br><br>
+<table>
+  <tr>
+    <th>Code</th>
+    <th>Status</th>
+  </tr>
+{{- range .Reports}}
+  <tr>
+    <td>{{.Code}}</td>
+  {{- if .Scanned}}
+    <td><a href="{{$.ReportStatsUrl}}?code={{.Code}}">{{.Title}}</a></td>
+  {{- else}}
+    <td>pending</td>
+  {{- end}}
+  </tr>
+{{- end}}
+</table>
+{{- else}}
+<form method="post">
+  <label for="reports">Paste Warcraft Logs report links or codes, one per line:</label><br>
+  <textarea id="reports" name="reports" rows="10" cols="80"></textarea><br>
+  <input type="submit" value="Scan">
+</form>
+{{- end}}
+</body>
+</html>
+{{end}}`
+
+// ScanReportStatus is a report that was requested to be scanned. Title is only known once it was scanned.
+type ScanReportStatus struct {
+	Code    string
+	Title   string
+	Scanned bool
+}
+
+// RenderScanReports renders the form to paste report links into, or the scan status of the given reports if there
+// are any. Titles are chosen by whoever uploaded a log, so they must only ever be rendered through the template.
+func (r *Renderer) RenderScanReports(
+	wr io.Writer,
+	reports []ScanReportStatus,
+	reportStatsUrl string,
+) error {
+	numScanned := 0
+	for _, report := range reports {
+		if report.Scanned {
+			numScanned++
+		}
+	}
+
+	return r.templates[scanReportsTemplateName].ExecuteTemplate(wr, scanReportsDefinitionName, struct {
+		Reports        []ScanReportStatus
+		NumScanned     int
+		NumPending     int
+		ReportStatsUrl string
+	}{
+		Reports:        reports,
+		NumScanned:     numScanned,
+		NumPending:     len(reports) - numScanned,
+		ReportStatsUrl: reportStatsUrl,
+	})
+}
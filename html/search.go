@@ -0,0 +1,98 @@
+package html
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/FabianHahn/raidlogscan/datastore"
+)
+
+const searchHtmlTemplate = `{{define "body"}}
+<h1>Search: {{.Query}}</h1>
+
+<div class="column">
+  <h2>Characters</h2>
+  <table>
+    <tr>
+      <th>Name</th>
+      <th>Server</th>
+      <th>Class</th>
+    </tr>
+{{- range .Characters}}
+    <tr>
+      <td><a href="{{$.PlayerStatsUrl}}?player_id={{.Id}}">{{.Name}}</a></td>
+      <td>{{.Server}}</td>
+      <td>{{.Class}}</td>
+    </tr>
+{{- end}}
+  </table>
+</div>
+
+<div class="column">
+  <h2>Accounts</h2>
+  <table>
+    <tr>
+      <th>Name</th>
+    </tr>
+{{- range .Accounts}}
+    <tr>
+      <td><a href="{{$.AccountStatsUrl}}?account_name={{.}}">#{{.}}</a></td>
+    </tr>
+{{- end}}
+  </table>
+</div>
+
+<div class="column">
+  <h2>Guilds / Raid Teams</h2>
+  <table>
+    <tr>
+      <th>Name</th>
+    </tr>
+{{- range .Guilds}}
+    <tr>
+      <td><a href="{{$.GuildStatsUrl}}?guild_id={{.GuildId}}">{{.GuildName}}</a></td>
+    </tr>
+{{- end}}
+  </table>
+</div>
+{{- end}}`
+
+func (r *Renderer) RenderSearch(
+	wr io.Writer,
+	query string,
+	characters []datastore.PlayerCoraider,
+	accounts []string,
+	guilds []GuildLeaderboardEntry,
+	accountStatsUrl string,
+	playerStatsUrl string,
+	guildStatsUrl string,
+	scanReportsUrl string,
+	searchUrl string,
+	oauth2LoginUrl string,
+) error {
+	return r.templates[searchTemplateName].ExecuteTemplate(wr, baseDefinitionName, struct {
+		Title           string
+		Query           string
+		Characters      []datastore.PlayerCoraider
+		Accounts        []string
+		Guilds          []GuildLeaderboardEntry
+		AccountStatsUrl string
+		PlayerStatsUrl  string
+		GuildStatsUrl   string
+		ScanReportsUrl  string
+		SearchUrl       string
+		Oauth2LoginUrl  string
+	}{
+		Title:           fmt.Sprintf("Search: %v", query),
+		Query:           query,
+		Characters:      characters,
+		Accounts:        accounts,
+		Guilds:          guilds,
+		AccountStatsUrl: accountStatsUrl,
+		PlayerStatsUrl:  playerStatsUrl,
+		GuildStatsUrl:   guildStatsUrl,
+		ScanReportsUrl:  scanReportsUrl,
+		SearchUrl:       searchUrl,
+		Oauth2LoginUrl:  oauth2LoginUrl,
+	})
+}
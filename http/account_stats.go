@@ -6,12 +6,13 @@ import (
 	"io"
 	go_http "net/http"
 	"sort"
+	"time"
 
 	google_datastore "cloud.google.com/go/datastore"
+	"github.com/FabianHahn/raidlogscan/aggregate"
 	"github.com/FabianHahn/raidlogscan/cache"
 	"github.com/FabianHahn/raidlogscan/datastore"
 	"github.com/FabianHahn/raidlogscan/html"
-	"google.golang.org/api/iterator"
 )
 
 func AccountStats(
@@ -19,8 +20,16 @@ func AccountStats(
 	r *go_http.Request,
 	htmlRenderer *html.Renderer,
 	datastoreClient *google_datastore.Client,
+	pageCache *cache.PageCache,
 	playerStatsUrl string,
 	guildStatsUrl string,
+	claimAccountUrl string,
+	raidNetworkUrl string,
+	raidGroupsUrl string,
+	raidCalendarUrl string,
+	reportFeedUrl string,
+	scanReportsUrl string,
+	searchUrl string,
 	oauth2LoginUrl string,
 ) {
 	ctx := context.Background()
@@ -33,103 +42,108 @@ func AccountStats(
 		return
 	}
 
-	accountStatsKey := google_datastore.NameKey("account_stats", accountName, nil)
-	var accountStats datastore.AccountStats
-	err := datastoreClient.Get(ctx, accountStatsKey, &accountStats)
-	if err != nil && err != google_datastore.ErrNoSuchEntity {
-		w.WriteHeader(go_http.StatusInternalServerError)
-		fmt.Fprintf(w, "Datastore query failed: %v", err)
-		return
-	} else if err == nil {
-		cache.WriteCompressedResponseOrDecompress(w, r, accountStats.HtmlGzip)
+	statsPage := cache.AccountStatsPage(accountName)
+	if statsPage.OutputCached(w, r, pageCache, ctx) {
 		return
 	}
+	creationTime := time.Now()
 
-	characters := map[int64]datastore.PlayerCoraider{}
-	coraiders := map[int64]datastore.PlayerCoraider{}
-	guilds := map[int32]html.GuildLeaderboardEntry{}
-	coaccounts := map[int64]string{}
-	query := google_datastore.NewQuery("player").FilterField("Account", "=", accountName)
-	responseIter := datastoreClient.Run(ctx, query)
-	for {
-		var player datastore.Player
-		key, err := responseIter.Next(&player)
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			w.WriteHeader(go_http.StatusInternalServerError)
-			fmt.Fprintf(w, "Datastore query failed: %v", err)
-			return
-		}
+	stats, err := loadAccountStats(ctx, datastoreClient, accountName)
+	if err != nil {
+		w.WriteHeader(go_http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to load account stats: %v", err)
+		return
+	}
 
-		character := datastore.PlayerCoraider{
-			Id:     key.ID,
-			Name:   player.Name,
-			Server: player.Server,
-			Class:  player.Class,
-			Count:  0,
-		}
+	now := time.Now()
+	recentRaids, err := aggregate.QueryAccountRaids(
+		ctx,
+		datastoreClient,
+		stats.Account,
+		now.AddDate(0, 0, -maxRoleDistributionDays))
+	if err != nil {
+		w.WriteHeader(go_http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to load recent raids: %v", err)
+		return
+	}
 
-		for _, playerReport := range player.Reports {
-			if !playerReport.Duplicate {
-				character.Count++
-			}
-
-			if playerReport.GuildId != 0 {
-				if entry, ok := guilds[playerReport.GuildId]; ok {
-					entry.Count++
-					guilds[playerReport.GuildId] = entry
-				} else {
-					guilds[playerReport.GuildId] = html.GuildLeaderboardEntry{
-						Count:     1,
-						GuildId:   playerReport.GuildId,
-						GuildName: playerReport.GuildName,
-					}
-				}
-			}
-		}
+	altSuggestions, err := findAltSuggestions(ctx, datastoreClient, stats.Account, recentRaids)
+	if err != nil {
+		w.WriteHeader(go_http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to find alt suggestions: %v", err)
+		return
+	}
 
-		characters[key.ID] = character
+	roleDistributions := computeRoleDistributions(recentRaids, stats.Account.RoleCounts, now)
 
-		for _, playerCoraider := range player.Coraiders {
-			// Skip our own characters
-			if _, ok := characters[playerCoraider.Id]; ok {
-				continue
-			}
+	statsPage.CacheAndOutput(w, r, pageCache, ctx, creationTime, func(wr io.Writer) error {
+		return htmlRenderer.RenderAccountStats(
+			wr,
+			accountName,
+			stats.NumRaids,
+			stats.Characters,
+			stats.Leaderboard,
+			stats.GuildLeaderboard,
+			altSuggestions,
+			roleDistributions,
+			playerStatsUrl,
+			guildStatsUrl,
+			claimAccountUrl,
+			raidNetworkUrl,
+			raidGroupsUrl,
+			raidCalendarUrl,
+			reportFeedUrl,
+			scanReportsUrl,
+			searchUrl,
+			oauth2LoginUrl)
+	})
+}
 
-			if entry, ok := coraiders[playerCoraider.Id]; ok {
-				entry.Count += playerCoraider.Count
-				coraiders[playerCoraider.Id] = entry
-			} else {
-				coraiders[playerCoraider.Id] = playerCoraider
-			}
-		}
+type accountAggregate struct {
+	NumRaids         int
+	Characters       []datastore.PlayerCoraider
+	Leaderboard      []html.LeaderboardEntry
+	GuildLeaderboard []html.GuildLeaderboardEntry
+	Account          datastore.Account
+}
 
-		for _, playerCoraiderAccount := range player.CoraiderAccounts {
-			coaccounts[playerCoraiderAccount.PlayerId] = playerCoraiderAccount.Name
-		}
+// loadAccountStats ranks the characters, coraiders and guilds of an account from its precomputed aggregate.
+func loadAccountStats(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	accountName string,
+) (accountAggregate, error) {
+	account, err := aggregate.LoadAccount(ctx, datastoreClient, accountName)
+	if err != nil {
+		return accountAggregate{}, err
 	}
 
 	numRaids := 0
-	charactersSlice := []datastore.PlayerCoraider{}
-	for _, character := range characters {
-		charactersSlice = append(charactersSlice, character)
-		numRaids += int(character.Count)
+	characters := []datastore.PlayerCoraider{}
+	for _, character := range account.Characters {
+		characters = append(characters, datastore.PlayerCoraider{
+			Id:     character.PlayerId,
+			Name:   character.Name,
+			Server: character.Server,
+			Class:  character.Class,
+			Count:  character.NumRaids,
+		})
+		numRaids += int(character.NumRaids)
 	}
-	sort.SliceStable(charactersSlice, func(i int, j int) bool {
-		return charactersSlice[i].Count > charactersSlice[j].Count
+	sort.SliceStable(characters, func(i int, j int) bool {
+		return characters[i].Count > characters[j].Count
 	})
 
+	coraiders := []datastore.AccountCoraider{}
 	accountCounts := map[string]int64{}
-	for playerId, playerAccountName := range coaccounts {
-		if coraider, coraiderExists := coraiders[playerId]; coraiderExists {
-			if _, ok := accountCounts[playerAccountName]; !ok {
-				accountCounts[playerAccountName] = 0
-			}
-
-			accountCounts[playerAccountName] += coraider.Count
-			delete(coraiders, playerId)
+	for _, coraider := range account.Coraiders {
+		if coraider.Count == 0 {
+			continue
+		}
+		if coraider.Account != "" {
+			accountCounts[coraider.Account] += coraider.Count
+		} else {
+			coraiders = append(coraiders, coraider)
 		}
 	}
 
@@ -159,23 +173,22 @@ func AccountStats(
 	})
 
 	guildLeaderboard := []html.GuildLeaderboardEntry{}
-	for _, guild := range guilds {
-		guildLeaderboard = append(guildLeaderboard, guild)
+	for _, guild := range account.Guilds {
+		guildLeaderboard = append(guildLeaderboard, html.GuildLeaderboardEntry{
+			Count:     guild.Count,
+			GuildId:   guild.GuildId,
+			GuildName: guild.GuildName,
+		})
 	}
 	sort.SliceStable(guildLeaderboard, func(i int, j int) bool {
 		return guildLeaderboard[i].Count > guildLeaderboard[j].Count
 	})
 
-	cache.CacheAndOutputAccountStats(w, r, datastoreClient, ctx, accountName, func(wr io.Writer) error {
-		return htmlRenderer.RenderAccountStats(
-			wr,
-			accountName,
-			numRaids,
-			charactersSlice,
-			leaderboard,
-			guildLeaderboard,
-			playerStatsUrl,
-			guildStatsUrl,
-			oauth2LoginUrl)
-	})
+	return accountAggregate{
+		NumRaids:         numRaids,
+		Characters:       characters,
+		Leaderboard:      leaderboard,
+		GuildLeaderboard: guildLeaderboard,
+		Account:          account,
+	}, nil
 }
@@ -5,6 +5,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/FabianHahn/raidlogscan/cache"
 	"github.com/FabianHahn/raidlogscan/datastore"
 	"github.com/FabianHahn/raidlogscan/html"
 )
@@ -20,10 +21,33 @@ func TestAccountStats(t *testing.T) {
 	rr := httptest.NewRecorder()
 	htmlRenderer := html.CreateRendererOrDie()
 	datastoreClient := datastore.CreateDatastoreClientOrDie()
+	pageCache := cache.CreatePageCache(datastoreClient, "")
 	playerStatsUrl := "http://example.com/playerstats"
 	guildStatsUrl := "http://example.com/guildstats"
+	claimAccountUrl := "http://example.com/claimaccount"
+	raidNetworkUrl := "http://example.com/raidnetwork"
+	raidGroupsUrl := "http://example.com/raidgroups"
+	raidCalendarUrl := "http://example.com/raidcalendar"
+	reportFeedUrl := "http://example.com/reportfeed"
+	scanReportsUrl := "http://example.com/scanreports"
+	searchUrl := "http://example.com/search"
 	oauth2LoginUrl := "http://example.com/oauth2login"
-	AccountStats(rr, req, htmlRenderer, datastoreClient, playerStatsUrl, guildStatsUrl, oauth2LoginUrl)
+	AccountStats(
+		rr,
+		req,
+		htmlRenderer,
+		datastoreClient,
+		pageCache,
+		playerStatsUrl,
+		guildStatsUrl,
+		claimAccountUrl,
+		raidNetworkUrl,
+		raidGroupsUrl,
+		raidCalendarUrl,
+		reportFeedUrl,
+		scanReportsUrl,
+		searchUrl,
+		oauth2LoginUrl)
 
 	t.Log(rr.Body.String())
 }
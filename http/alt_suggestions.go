@@ -0,0 +1,283 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	google_datastore "cloud.google.com/go/datastore"
+	"github.com/FabianHahn/raidlogscan/aggregate"
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"github.com/FabianHahn/raidlogscan/html"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	altSuggestionSeedCoraiders   = 20
+	altSuggestionCandidates      = 30
+	altSuggestionMinScore        = 0.3
+	maxAltSuggestions            = 10
+	altSuggestionCoraiderWeight  = 0.7
+	altSuggestionScheduleWeight  = 0.3
+	altSuggestionScheduleBuckets = 7 * 8
+)
+
+type altCandidate struct {
+	player         datastore.Player
+	score          float64
+	sharedUploader bool
+}
+
+// findAltSuggestions proposes characters that are likely alts of the characters of an account. Alts can never
+// appear in the same report as the account's characters, so candidates are taken from the coraiders of the account's
+// strongest coraiders and scored by how similar their coraiders and raid schedules are, using the given recent raids as
+// the schedule of the account. Characters registered on the same Warcraft Logs user as one of the account's characters
+// are always suggested.
+func findAltSuggestions(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	account datastore.Account,
+	recentRaids []datastore.AccountRaid,
+) ([]html.AltSuggestion, error) {
+	excluded := map[int64]struct{}{}
+	coraiderCounts := map[int64]float64{}
+	for _, character := range account.Characters {
+		excluded[character.PlayerId] = struct{}{}
+	}
+	for _, coraider := range account.Coraiders {
+		excluded[coraider.Id] = struct{}{}
+		coraiderCounts[coraider.Id] += float64(coraider.Count)
+	}
+	schedule := raidSchedule(recentRaids)
+
+	seedIds := []int64{}
+	for coraiderId := range coraiderCounts {
+		seedIds = append(seedIds, coraiderId)
+	}
+	sort.SliceStable(seedIds, func(i int, j int) bool {
+		return coraiderCounts[seedIds[i]] > coraiderCounts[seedIds[j]]
+	})
+	if len(seedIds) > altSuggestionSeedCoraiders {
+		seedIds = seedIds[:altSuggestionSeedCoraiders]
+	}
+
+	seeds, err := loadPlayers(ctx, datastoreClient, seedIds)
+	if err != nil {
+		return nil, err
+	}
+
+	candidateWeights := map[int64]int64{}
+	for _, seed := range seeds {
+		for _, coraider := range seed.Coraiders {
+			if _, ok := excluded[coraider.Id]; !ok {
+				candidateWeights[coraider.Id] += coraider.Count
+			}
+		}
+	}
+
+	candidateIds := []int64{}
+	for candidateId := range candidateWeights {
+		candidateIds = append(candidateIds, candidateId)
+	}
+	sort.SliceStable(candidateIds, func(i int, j int) bool {
+		return candidateWeights[candidateIds[i]] > candidateWeights[candidateIds[j]]
+	})
+	if len(candidateIds) > altSuggestionCandidates {
+		candidateIds = candidateIds[:altSuggestionCandidates]
+	}
+
+	uploaderIds, err := findSharedUploaderCharacters(ctx, datastoreClient, account.Characters)
+	if err != nil {
+		return nil, err
+	}
+	for _, uploaderId := range uploaderIds {
+		if _, ok := excluded[uploaderId]; !ok {
+			candidateIds = append(candidateIds, uploaderId)
+		}
+	}
+
+	candidatePlayers, err := loadPlayers(ctx, datastoreClient, candidateIds)
+	if err != nil {
+		return nil, err
+	}
+
+	sharedUploader := map[int64]struct{}{}
+	for _, uploaderId := range uploaderIds {
+		sharedUploader[uploaderId] = struct{}{}
+	}
+
+	candidates := map[int64]altCandidate{}
+	for candidateId, candidate := range candidatePlayers {
+		// Characters that are already claimed by another account are not alts we can suggest.
+		if candidate.Account != "" {
+			continue
+		}
+
+		candidateCoraiderCounts := map[int64]float64{}
+		for _, coraider := range candidate.Coraiders {
+			if coraider.Id != candidateId {
+				candidateCoraiderCounts[coraider.Id] += float64(coraider.Count)
+			}
+		}
+		candidateSchedule := raidSchedule(aggregate.PlayerRaids(candidateId, candidate))
+
+		score := altSuggestionCoraiderWeight*cosineSimilarity(coraiderCounts, candidateCoraiderCounts) +
+			altSuggestionScheduleWeight*scheduleSimilarity(schedule, candidateSchedule)
+		_, isSharedUploader := sharedUploader[candidateId]
+		if score < altSuggestionMinScore && !isSharedUploader {
+			continue
+		}
+
+		candidates[candidateId] = altCandidate{
+			player:         candidate,
+			score:          score,
+			sharedUploader: isSharedUploader,
+		}
+	}
+
+	suggestions := []html.AltSuggestion{}
+	for candidateId, candidate := range candidates {
+		numRaids := int64(0)
+		for _, report := range candidate.player.Reports {
+			if !report.Duplicate {
+				numRaids++
+			}
+		}
+
+		suggestions = append(suggestions, html.AltSuggestion{
+			Character: datastore.PlayerCoraider{
+				Id:     candidateId,
+				Name:   candidate.player.Name,
+				Server: candidate.player.Server,
+				Class:  candidate.player.Class,
+				Count:  numRaids,
+			},
+			Score:          int(math.Round(candidate.score * 100)),
+			SharedUploader: candidate.sharedUploader,
+		})
+	}
+	sort.SliceStable(suggestions, func(i int, j int) bool {
+		if suggestions[i].SharedUploader != suggestions[j].SharedUploader {
+			return suggestions[i].SharedUploader
+		}
+		return suggestions[i].Score > suggestions[j].Score
+	})
+	if len(suggestions) > maxAltSuggestions {
+		suggestions = suggestions[:maxAltSuggestions]
+	}
+	return suggestions, nil
+}
+
+// findSharedUploaderCharacters returns the player IDs of all characters registered on a Warcraft Logs user that also
+// has one of the given characters registered.
+func findSharedUploaderCharacters(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	characters []datastore.AccountCharacter,
+) ([]int64, error) {
+	ownKeys := map[string]struct{}{}
+	for _, character := range characters {
+		ownKeys[datastore.UserCharacterKey(character.Name, character.Server)] = struct{}{}
+	}
+
+	otherCharacters := map[string]datastore.UserCharacter{}
+	for characterKey := range ownKeys {
+		query := google_datastore.NewQuery("user").FilterField("CharacterKeys", "=", characterKey)
+		responseIter := datastoreClient.Run(ctx, query)
+		for {
+			var user datastore.User
+			_, err := responseIter.Next(&user)
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("datastore user query failed: %v", err)
+			}
+
+			for _, userCharacter := range user.Characters {
+				userCharacterKey := datastore.UserCharacterKey(userCharacter.Name, userCharacter.Server)
+				if _, ok := ownKeys[userCharacterKey]; !ok {
+					otherCharacters[userCharacterKey] = userCharacter
+				}
+			}
+		}
+	}
+
+	playerIds := []int64{}
+	for _, userCharacter := range otherCharacters {
+		matches, err := queryPlayersByCharacter(ctx, datastoreClient, userCharacter.Name, userCharacter.Server)
+		if err != nil {
+			return nil, err
+		}
+		for playerId := range matches {
+			playerIds = append(playerIds, playerId)
+		}
+	}
+	return playerIds, nil
+}
+
+// queryPlayersByCharacter finds the players matching a Warcraft Logs character by name and normalized server.
+func queryPlayersByCharacter(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	name string,
+	server string,
+) (map[int64]datastore.Player, error) {
+	characterKey := datastore.UserCharacterKey(name, server)
+	players := map[int64]datastore.Player{}
+	query := google_datastore.NewQuery("player").FilterField("Name", "=", name)
+	responseIter := datastoreClient.Run(ctx, query)
+	for {
+		var player datastore.Player
+		key, err := responseIter.Next(&player)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("datastore player query failed: %v", err)
+		}
+
+		if datastore.UserCharacterKey(player.Name, player.Server) == characterKey {
+			players[key.ID] = player
+		}
+	}
+	return players, nil
+}
+
+// raidSchedule builds a histogram of raid start times over weekdays and three hour slots of the day.
+func raidSchedule(raids []datastore.AccountRaid) []float64 {
+	schedule := make([]float64, altSuggestionScheduleBuckets)
+	for _, raid := range raids {
+		startTime := raid.StartTime.UTC()
+		schedule[int(startTime.Weekday())*8+startTime.Hour()/3]++
+	}
+	return schedule
+}
+
+func scheduleSimilarity(first []float64, second []float64) float64 {
+	firstMap := map[int64]float64{}
+	secondMap := map[int64]float64{}
+	for i := range first {
+		firstMap[int64(i)] = first[i]
+		secondMap[int64(i)] = second[i]
+	}
+	return cosineSimilarity(firstMap, secondMap)
+}
+
+func cosineSimilarity(first map[int64]float64, second map[int64]float64) float64 {
+	dot := 0.0
+	firstNorm := 0.0
+	secondNorm := 0.0
+	for id, value := range first {
+		dot += value * second[id]
+		firstNorm += value * value
+	}
+	for _, value := range second {
+		secondNorm += value * value
+	}
+	if firstNorm == 0 || secondNorm == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(firstNorm) * math.Sqrt(secondNorm))
+}
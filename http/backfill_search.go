@@ -0,0 +1,170 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	go_http "net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	google_datastore "cloud.google.com/go/datastore"
+	"github.com/FabianHahn/raidlogscan/cache"
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	defaultBackfillSearchLimit = 500
+	maxBackfillSearchLimit     = 5000
+)
+
+// searchFieldBackfill fills in the normalized search fields of one kind of entity. update returns whether the fields
+// of the given entity had to be changed.
+type searchFieldBackfill struct {
+	newEntity func() interface{}
+	update    func(entity interface{}) bool
+}
+
+var searchFieldBackfills = map[string]searchFieldBackfill{
+	"player": {
+		newEntity: func() interface{} { return &datastore.Player{} },
+		update: func(entity interface{}) bool {
+			player := entity.(*datastore.Player)
+			searchName := datastore.PlayerSearchName(player.Name, player.Server)
+			searchAccount := datastore.NormalizeSearch(player.Account)
+			if player.SearchName == searchName && player.SearchAccount == searchAccount {
+				return false
+			}
+			player.SearchName = searchName
+			player.SearchAccount = searchAccount
+			return true
+		},
+	},
+	"guild": {
+		newEntity: func() interface{} { return &datastore.Guild{} },
+		update: func(entity interface{}) bool {
+			guild := entity.(*datastore.Guild)
+			searchName := datastore.NormalizeSearch(guild.Name)
+			if guild.SearchName == searchName {
+				return false
+			}
+			guild.SearchName = searchName
+			return true
+		},
+	},
+}
+
+// BackfillSearch fills in the normalized search fields of entities that were written before search existed, up to
+// limit entities of the given kind per request. It returns a cursor to continue from, so it needs to be called
+// repeatedly for every kind until no cursor is returned anymore.
+func BackfillSearch(
+	w go_http.ResponseWriter,
+	r *go_http.Request,
+	datastoreClient *google_datastore.Client,
+) {
+	ctx := context.Background()
+	w.Header().Set("Cache-Control", cache.CacheControlPrivate)
+
+	kind := r.URL.Query().Get("kind")
+	backfill, ok := searchFieldBackfills[kind]
+	if !ok {
+		kinds := []string{}
+		for kind := range searchFieldBackfills {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		w.WriteHeader(go_http.StatusBadRequest)
+		fmt.Fprintf(w, "kind must be one of %v", strings.Join(kinds, ", "))
+		return
+	}
+
+	limit := defaultBackfillSearchLimit
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		var err error
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit <= 0 || limit > maxBackfillSearchLimit {
+			w.WriteHeader(go_http.StatusBadRequest)
+			fmt.Fprintf(w, "limit must be a number between 1 and %v", maxBackfillSearchLimit)
+			return
+		}
+	}
+
+	query := google_datastore.NewQuery(kind).Limit(limit)
+	if cursorParam := r.URL.Query().Get("cursor"); cursorParam != "" {
+		cursor, err := google_datastore.DecodeCursor(cursorParam)
+		if err != nil {
+			w.WriteHeader(go_http.StatusBadRequest)
+			fmt.Fprintf(w, "invalid cursor: %v", err)
+			return
+		}
+		query = query.Start(cursor)
+	}
+
+	scanned := 0
+	updated := 0
+	responseIter := datastoreClient.Run(ctx, query)
+	for {
+		entity := backfill.newEntity()
+		key, err := responseIter.Next(entity)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			w.WriteHeader(go_http.StatusInternalServerError)
+			fmt.Fprintf(w, "datastore %v query failed after updating %v entities: %v", kind, updated, err)
+			return
+		}
+		scanned++
+
+		if !backfill.update(entity) {
+			continue
+		}
+		err = backfillSearchEntity(ctx, datastoreClient, key, backfill)
+		if err != nil {
+			w.WriteHeader(go_http.StatusInternalServerError)
+			fmt.Fprintf(w, "updated %v %v entities before failing: %v", updated, kind, err)
+			return
+		}
+		updated++
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	fmt.Fprintf(w, "Updated %v of %v %v entities.\n", updated, scanned, kind)
+	if scanned == limit {
+		cursor, err := responseIter.Cursor()
+		if err != nil {
+			fmt.Fprintf(w, "Failed to get cursor to continue from: %v\n", err)
+			return
+		}
+		fmt.Fprintf(w, "Continue with cursor=%v\n", cursor.String())
+	}
+}
+
+// backfillSearchEntity rewrites the search fields of an entity in a transaction, so that concurrent updates to the
+// entity don't get lost.
+func backfillSearchEntity(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	key *google_datastore.Key,
+	backfill searchFieldBackfill,
+) error {
+	return datastore.RunTransaction(ctx, datastoreClient, func(tx *google_datastore.Transaction) error {
+		entity := backfill.newEntity()
+		err := tx.Get(key, entity)
+		if err == google_datastore.ErrNoSuchEntity {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("datastore get %v failed: %v", key, err)
+		}
+
+		if !backfill.update(entity) {
+			return nil
+		}
+		_, err = tx.Put(key, entity)
+		if err != nil {
+			return fmt.Errorf("datastore write %v failed: %v", key, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,18 @@
+package http
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/FabianHahn/raidlogscan/datastore"
+)
+
+func TestBackfillSearch(t *testing.T) {
+	req := httptest.NewRequest("GET", "/?kind=guild&limit=1", nil)
+
+	rr := httptest.NewRecorder()
+	datastoreClient := datastore.CreateDatastoreClientOrDie()
+	BackfillSearch(rr, req, datastoreClient)
+
+	t.Log(rr.Body.String())
+}
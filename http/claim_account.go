@@ -8,6 +8,7 @@ import (
 
 	google_datastore "cloud.google.com/go/datastore"
 	google_pubsub "cloud.google.com/go/pubsub"
+	"github.com/FabianHahn/raidlogscan/aggregate"
 	"github.com/FabianHahn/raidlogscan/cache"
 	"github.com/FabianHahn/raidlogscan/datastore"
 	"github.com/FabianHahn/raidlogscan/pubsub"
@@ -39,52 +40,93 @@ func ClaimAccount(
 		return
 	}
 
-	query := google_datastore.NewQuery("player").FilterField("Name", "=", accountName)
-	count, err := datastoreClient.Count(ctx, query)
+	valid, err := isValidAccountName(ctx, datastoreClient, accountName)
 	if err != nil {
 		w.WriteHeader(go_http.StatusInternalServerError)
-		fmt.Fprintf(w, "player by name %v lookup failed: %v", accountName, err.Error())
+		fmt.Fprintf(w, "%v", err)
 		return
 	}
-	if count == 0 {
+	if !valid {
 		w.WriteHeader(go_http.StatusBadRequest)
 		fmt.Fprintf(w, "cannot claim account name %v that doesn't correspond to a known character name", accountName)
 		return
 	}
 
-	playerKey := google_datastore.IDKey("player", playerId, nil)
-	tx, err := datastoreClient.NewTransaction(ctx)
+	player, err := claimPlayerAccount(ctx, datastoreClient, pubsubClient, playerId, accountName)
 	if err != nil {
 		w.WriteHeader(go_http.StatusInternalServerError)
-		fmt.Fprintf(w, "failed to create transaction: %v", err.Error())
+		fmt.Fprintf(w, "%v", err)
 		return
 	}
 
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	fmt.Fprintf(w, "Successfully assigned character <a href=\"%v?player_id=%v\">%v-%v (%v)</a> to player #<a href=\"%v?account_name=%v\">%v</a>.<br>\n",
+		playerStatsUrl,
+		playerId,
+		player.Name,
+		player.Server,
+		player.Class,
+		accountStatsUrl,
+		accountName,
+		accountName,
+	)
+}
+
+// claimPlayerAccount assigns a player to an account name and propagates the claim to all of the player's coraiders
+// and reports.
+func claimPlayerAccount(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	pubsubClient *google_pubsub.Client,
+	playerId int64,
+	accountName string,
+) (datastore.Player, error) {
+	playerKey := google_datastore.IDKey("player", playerId, nil)
+	tx, err := datastoreClient.NewTransaction(ctx)
+	if err != nil {
+		return datastore.Player{}, fmt.Errorf("failed to create transaction: %v", err.Error())
+	}
+
 	var player datastore.Player
 	err = tx.Get(playerKey, &player)
 	if err != nil {
 		tx.Rollback()
-		w.WriteHeader(go_http.StatusInternalServerError)
-		fmt.Fprintf(w, "for claim account %v datastore get player %v failed: %v", accountName, playerId, err.Error())
-		return
+		return player, fmt.Errorf("for claim account %v datastore get player %v failed: %v", accountName, playerId, err.Error())
 	}
 
 	oldAccountName := player.Account
 	player.Account = accountName
+	player.SearchName = datastore.PlayerSearchName(player.Name, player.Server)
+	player.SearchAccount = datastore.NormalizeSearch(player.Account)
 
 	_, err = tx.Put(playerKey, &player)
 	if err != nil {
 		tx.Rollback()
-		w.WriteHeader(go_http.StatusInternalServerError)
-		fmt.Fprintf(w, "datastore write claim account %v player %v failed: %v", accountName, playerId, err.Error())
-		return
+		return player, fmt.Errorf("datastore write claim account %v player %v failed: %v", accountName, playerId, err.Error())
+	}
+
+	// Which coraiders count as the account's own characters changes with the claim, so both accounts get rebuilt the
+	// next time they are read.
+	accountNames := []string{accountName}
+	if oldAccountName != "" && oldAccountName != accountName {
+		accountNames = append(accountNames, oldAccountName)
+	}
+	for _, name := range accountNames {
+		err = aggregate.UpdateAccount(tx, name, aggregate.InvalidateAccount)
+		if err != nil {
+			tx.Rollback()
+			return player, fmt.Errorf("claim account %v player %v failed: %v", accountName, playerId, err.Error())
+		}
 	}
 
 	_, err = tx.Commit()
 	if err != nil {
-		w.WriteHeader(go_http.StatusInternalServerError)
-		fmt.Fprintf(w, "datastore write claim account %v player %v failed: %v", accountName, playerId, err.Error())
-		return
+		return player, fmt.Errorf("datastore write claim account %v player %v failed: %v", accountName, playerId, err.Error())
+	}
+
+	err = datastore.LoadPlayerHistory(ctx, datastoreClient, playerKey, &player)
+	if err != nil {
+		return player, fmt.Errorf("failed to claim account %v player %v: %v", accountName, playerId, err.Error())
 	}
 
 	coraiderPlayerIds := []int64{}
@@ -97,55 +139,60 @@ func ClaimAccount(
 		reportCodes = append(reportCodes, report.Code)
 	}
 
+	// The claim fans out to many events, which share the claim as their cause.
+	causeId := pubsub.NewCauseId()
 	err = pubsub.PublishCoraiderAccountClaimEvents(
 		pubsubClient,
 		ctx,
+		causeId,
 		playerId,
 		accountName,
 		coraiderPlayerIds)
 	if err != nil {
-		w.WriteHeader(go_http.StatusInternalServerError)
-		fmt.Fprintf(w, "failed to claim account %v player %v: %v", accountName, playerId, err.Error())
-		return
+		return player, fmt.Errorf("failed to claim account %v player %v: %v", accountName, playerId, err.Error())
 	}
 
 	err = pubsub.PublishReportAccountClaimEvents(
 		pubsubClient,
 		ctx,
+		causeId,
 		playerId,
 		accountName,
 		reportCodes)
 	if err != nil {
-		w.WriteHeader(go_http.StatusInternalServerError)
-		fmt.Fprintf(w, "failed to report claim account %v player %v: %v", accountName, playerId, err.Error())
-		return
+		return player, fmt.Errorf("failed to report claim account %v player %v: %v", accountName, playerId, err.Error())
 	}
 
 	if oldAccountName != "" {
 		err = cache.InvalidateAccountStatsCache(ctx, datastoreClient, oldAccountName)
 		if err != nil {
-			w.WriteHeader(go_http.StatusInternalServerError)
-			fmt.Fprintf(w, "failed to invalidate account stats cache for %v: %v", oldAccountName, err)
-			return
+			return player, fmt.Errorf("failed to invalidate account stats cache for %v: %v", oldAccountName, err)
 		}
 	}
 
 	err = cache.InvalidateAccountStatsCache(ctx, datastoreClient, player.Account)
 	if err != nil {
-		w.WriteHeader(go_http.StatusInternalServerError)
-		fmt.Fprintf(w, "failed to invalidate account stats cache for %v: %v", player.Account, err)
-		return
+		return player, fmt.Errorf("failed to invalidate account stats cache for %v: %v", player.Account, err)
 	}
 
-	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
-	fmt.Fprintf(w, "Successfully assigned character <a href=\"%v?player_id=%v\">%v-%v (%v)</a> to player #<a href=\"%v?account_name=%v\">%v</a>.<br>\n",
-		playerStatsUrl,
-		playerId,
-		player.Name,
-		player.Server,
-		player.Class,
-		accountStatsUrl,
-		accountName,
-		accountName,
-	)
+	err = cache.InvalidatePlayerStatsCache(ctx, datastoreClient, playerId)
+	if err != nil {
+		return player, fmt.Errorf("failed to invalidate player stats cache for %v: %v", playerId, err)
+	}
+
+	return player, nil
+}
+
+// isValidAccountName checks that an account name corresponds to a known character name.
+func isValidAccountName(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	accountName string,
+) (bool, error) {
+	query := google_datastore.NewQuery("player").FilterField("Name", "=", accountName)
+	count, err := datastoreClient.Count(ctx, query)
+	if err != nil {
+		return false, fmt.Errorf("player by name %v lookup failed: %v", accountName, err.Error())
+	}
+	return count > 0, nil
 }
@@ -0,0 +1,106 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	go_http "net/http"
+	"sort"
+
+	google_datastore "cloud.google.com/go/datastore"
+	google_pubsub "cloud.google.com/go/pubsub"
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"github.com/FabianHahn/raidlogscan/oauth2"
+)
+
+func ClaimUserCharacters(
+	w go_http.ResponseWriter,
+	r *go_http.Request,
+	datastoreClient *google_datastore.Client,
+	pubsubClient *google_pubsub.Client,
+	playerStatsUrl string,
+	accountStatsUrl string,
+) {
+	ctx := context.Background()
+
+	// The user is taken from the session token handed out on login, since anyone could pass any user ID otherwise.
+	userId, err := oauth2.ParseSessionToken(r.PostFormValue("session"))
+	if err != nil {
+		w.WriteHeader(go_http.StatusForbidden)
+		fmt.Fprintf(w, "invalid session, log into Warcraft Logs first: %v", err.Error())
+		return
+	}
+
+	accountName := r.FormValue("account_name")
+
+	valid, err := isValidAccountName(ctx, datastoreClient, accountName)
+	if err != nil {
+		w.WriteHeader(go_http.StatusInternalServerError)
+		fmt.Fprintf(w, "%v", err)
+		return
+	}
+	if !valid {
+		w.WriteHeader(go_http.StatusBadRequest)
+		fmt.Fprintf(w, "cannot claim account name %v that doesn't correspond to a known character name", accountName)
+		return
+	}
+
+	userKey := google_datastore.IDKey("user", int64(userId), nil)
+	var user datastore.User
+	err = datastoreClient.Get(ctx, userKey, &user)
+	if err == google_datastore.ErrNoSuchEntity {
+		w.WriteHeader(go_http.StatusNotFound)
+		fmt.Fprintf(w, "No such Warcraft Logs user: %v. Log into Warcraft Logs first.", userId)
+		return
+	} else if err != nil {
+		w.WriteHeader(go_http.StatusInternalServerError)
+		fmt.Fprintf(w, "Datastore query failed: %v", err)
+		return
+	}
+
+	claimed := []string{}
+	missing := []string{}
+	for _, character := range user.Characters {
+		players, err := queryPlayersByCharacter(ctx, datastoreClient, character.Name, character.Server)
+		if err != nil {
+			w.WriteHeader(go_http.StatusInternalServerError)
+			fmt.Fprintf(w, "failed to look up character %v-%v: %v", character.Name, character.Server, err)
+			return
+		}
+		if len(players) == 0 {
+			missing = append(missing, fmt.Sprintf("%v-%v", character.Name, character.Server))
+			continue
+		}
+
+		for playerId := range players {
+			player, err := claimPlayerAccount(ctx, datastoreClient, pubsubClient, playerId, accountName)
+			if err != nil {
+				w.WriteHeader(go_http.StatusInternalServerError)
+				fmt.Fprintf(w, "%v", err)
+				return
+			}
+			claimed = append(claimed, fmt.Sprintf("<a href=\"%v?player_id=%v\">%v-%v (%v)</a>",
+				playerStatsUrl,
+				playerId,
+				player.Name,
+				player.Server,
+				player.Class))
+		}
+	}
+	sort.Strings(claimed)
+	sort.Strings(missing)
+
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	fmt.Fprintf(w, "Assigned %v characters of Warcraft Logs user %v to player #<a href=\"%v?account_name=%v\">%v</a>.<br>\n",
+		len(claimed),
+		user.Name,
+		accountStatsUrl,
+		accountName,
+		accountName,
+	)
+	for _, character := range claimed {
+		fmt.Fprintf(w, "Assigned %v.<br>\n", character)
+	}
+	for _, character := range missing {
+		fmt.Fprintf(w, "Not found in any scanned report: %v.<br>\n", character)
+	}
+}
@@ -0,0 +1,88 @@
+package http
+
+import (
+	"fmt"
+	go_http "net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"github.com/FabianHahn/raidlogscan/oauth2"
+	"github.com/FabianHahn/raidlogscan/pubsub"
+)
+
+const (
+	testClaimUserCharactersAccountName = "Jaythe"
+	testClaimUserCharactersUserId      = 1258790
+)
+
+func TestClaimUserCharacters(t *testing.T) {
+	if os.Getenv("RAIDLOGSCAN_SESSION_SECRET") == "" {
+		os.Setenv("RAIDLOGSCAN_SESSION_SECRET", "test")
+	}
+	session, err := oauth2.CreateSessionToken(testClaimUserCharactersUserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	form := url.Values{
+		"account_name": {testClaimUserCharactersAccountName},
+		"session":      {session},
+	}
+	req := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	datastoreClient := datastore.CreateDatastoreClientOrDie()
+	pubsubClient := pubsub.CreatePubsubClientOrDie()
+	playerStatsUrl := "http://example.com/playerstats"
+	accountStatsUrl := "http://example.com/accountstats"
+	ClaimUserCharacters(rr, req, datastoreClient, pubsubClient, playerStatsUrl, accountStatsUrl)
+
+	t.Log(rr.Body.String())
+}
+
+func TestClaimUserCharactersInvalidSession(t *testing.T) {
+	if os.Getenv("RAIDLOGSCAN_SESSION_SECRET") == "" {
+		os.Setenv("RAIDLOGSCAN_SESSION_SECRET", "test")
+	}
+
+	form := url.Values{
+		"account_name": {testClaimUserCharactersAccountName},
+		"session":      {fmt.Sprintf("%v.0.forged", testClaimUserCharactersUserId)},
+	}
+	req := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	ClaimUserCharacters(rr, req, nil, nil, "http://example.com/playerstats", "http://example.com/accountstats")
+	if rr.Code != go_http.StatusForbidden {
+		t.Fatalf("expected status %v for a forged session, got %v", go_http.StatusForbidden, rr.Code)
+	}
+
+	t.Log(rr.Body.String())
+}
+
+func TestClaimUserCharactersSessionInQuery(t *testing.T) {
+	if os.Getenv("RAIDLOGSCAN_SESSION_SECRET") == "" {
+		os.Setenv("RAIDLOGSCAN_SESSION_SECRET", "test")
+	}
+	session, err := oauth2.CreateSessionToken(testClaimUserCharactersUserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sessions are only accepted in form bodies, so that they don't end up in logs and browser history.
+	req := httptest.NewRequest("GET", fmt.Sprintf("/?account_name=%v&session=%v", testClaimUserCharactersAccountName, url.QueryEscape(session)), nil)
+
+	rr := httptest.NewRecorder()
+	ClaimUserCharacters(rr, req, nil, nil, "http://example.com/playerstats", "http://example.com/accountstats")
+	if rr.Code != go_http.StatusForbidden {
+		t.Fatalf("expected status %v for a session in the query, got %v", go_http.StatusForbidden, rr.Code)
+	}
+
+	t.Log(rr.Body.String())
+}
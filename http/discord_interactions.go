@@ -0,0 +1,357 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	go_http "net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	google_datastore "cloud.google.com/go/datastore"
+	google_pubsub "cloud.google.com/go/pubsub"
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"github.com/FabianHahn/raidlogscan/discord"
+	"github.com/FabianHahn/raidlogscan/html"
+	"github.com/FabianHahn/raidlogscan/pubsub"
+)
+
+const (
+	discordCommandName        = "raidstats"
+	discordMaxBodySize        = 64 * 1024
+	discordLeaderboardEntries = 10
+	discordMaxScanReports     = 10
+)
+
+// DiscordInteractions answers the /raidstats slash command of a Discord application configured to send interactions
+// to this endpoint. Replies are built from the same aggregates as the account, player and guild stats pages, but
+// computed fresh since Discord expects an answer within three seconds and the page caches only hold rendered HTML.
+func DiscordInteractions(
+	w go_http.ResponseWriter,
+	r *go_http.Request,
+	datastoreClient *google_datastore.Client,
+	pubsubClient *google_pubsub.Client,
+	discordPublicKey string,
+	accountStatsUrl string,
+	playerStatsUrl string,
+	guildStatsUrl string,
+	scanReportsUrl string,
+) {
+	ctx := context.Background()
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, discordMaxBodySize))
+	if err != nil {
+		w.WriteHeader(go_http.StatusBadRequest)
+		fmt.Fprintf(w, "failed to read request body: %v", err)
+		return
+	}
+
+	err = discord.VerifySignature(
+		discordPublicKey,
+		r.Header.Get("X-Signature-Ed25519"),
+		r.Header.Get("X-Signature-Timestamp"),
+		body)
+	if err != nil {
+		w.WriteHeader(go_http.StatusUnauthorized)
+		fmt.Fprintf(w, "invalid request signature: %v", err)
+		return
+	}
+
+	var interaction discord.Interaction
+	err = json.Unmarshal(body, &interaction)
+	if err != nil {
+		w.WriteHeader(go_http.StatusBadRequest)
+		fmt.Fprintf(w, "failed to parse interaction: %v", err)
+		return
+	}
+
+	var response discord.InteractionResponse
+	switch interaction.Type {
+	case discord.InteractionTypePing:
+		response = discord.InteractionResponse{Type: discord.ResponseTypePong}
+	case discord.InteractionTypeApplicationCommand:
+		response = handleDiscordCommand(
+			ctx,
+			datastoreClient,
+			pubsubClient,
+			interaction.Data,
+			accountStatsUrl,
+			playerStatsUrl,
+			guildStatsUrl,
+			scanReportsUrl)
+	default:
+		w.WriteHeader(go_http.StatusBadRequest)
+		fmt.Fprintf(w, "unsupported interaction type %v", interaction.Type)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func handleDiscordCommand(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	pubsubClient *google_pubsub.Client,
+	data discord.InteractionData,
+	accountStatsUrl string,
+	playerStatsUrl string,
+	guildStatsUrl string,
+	scanReportsUrl string,
+) discord.InteractionResponse {
+	if data.Name != discordCommandName || len(data.Options) != 1 {
+		return discordErrorResponse("Unknown command, try /%v account, player, guild or scan.", discordCommandName)
+	}
+	subcommand := data.Options[0]
+
+	switch subcommand.Name {
+	case "account":
+		option, ok := discord.FindOption(subcommand.Options, "name")
+		if !ok {
+			return discordErrorResponse("Please specify an account name.")
+		}
+		return discordAccountResponse(ctx, datastoreClient, strings.TrimPrefix(option.StringValue(), "#"),
+			accountStatsUrl, playerStatsUrl, guildStatsUrl)
+	case "player":
+		option, ok := discord.FindOption(subcommand.Options, "player_id")
+		if !ok {
+			return discordErrorResponse("Please specify a player ID.")
+		}
+		playerId, err := strconv.ParseInt(option.StringValue(), 10, 64)
+		if err != nil {
+			return discordErrorResponse("Not a valid player ID: %v", option.StringValue())
+		}
+		return discordPlayerResponse(ctx, datastoreClient, playerId, accountStatsUrl, playerStatsUrl)
+	case "guild":
+		option, ok := discord.FindOption(subcommand.Options, "guild_id")
+		if !ok {
+			return discordErrorResponse("Please specify a guild ID.")
+		}
+		guildId, err := strconv.ParseInt(option.StringValue(), 10, 32)
+		if err != nil {
+			return discordErrorResponse("Not a valid guild ID: %v", option.StringValue())
+		}
+		return discordGuildResponse(ctx, datastoreClient, int32(guildId), accountStatsUrl, playerStatsUrl, guildStatsUrl)
+	case "scan":
+		option, ok := discord.FindOption(subcommand.Options, "report")
+		if !ok {
+			return discordErrorResponse("Please specify a Warcraft Logs report link or code.")
+		}
+		return discordScanResponse(ctx, pubsubClient, option.StringValue(), scanReportsUrl)
+	}
+	return discordErrorResponse("Unknown subcommand %v.", subcommand.Name)
+}
+
+func discordAccountResponse(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	accountName string,
+	accountStatsUrl string,
+	playerStatsUrl string,
+	guildStatsUrl string,
+) discord.InteractionResponse {
+	aggregate, err := loadAccountStats(ctx, datastoreClient, accountName)
+	if err != nil {
+		return discordErrorResponse("Failed to load account stats: %v", err)
+	}
+	if len(aggregate.Characters) == 0 {
+		return discordErrorResponse("No characters are claimed by account #%v.", accountName)
+	}
+
+	characters := []string{}
+	for _, character := range aggregate.Characters {
+		characters = append(characters, fmt.Sprintf("%v (%v)", discordCharacterLink(character, playerStatsUrl), character.Count))
+	}
+	guilds := []string{}
+	for _, guild := range aggregate.GuildLeaderboard {
+		guilds = append(guilds, fmt.Sprintf("[%v](%v?guild_id=%v) (%v)", guild.GuildName, guildStatsUrl, guild.GuildId, guild.Count))
+	}
+
+	return discordEmbedResponse(discord.Embed{
+		Title:       fmt.Sprintf("#%v", accountName),
+		Url:         fmt.Sprintf("%v?account_name=%v", accountStatsUrl, url.QueryEscape(accountName)),
+		Description: fmt.Sprintf("%v raids on %v characters", aggregate.NumRaids, len(aggregate.Characters)),
+		Color:       discord.EmbedColor,
+		Fields: []discord.EmbedField{
+			discordListField("Characters", characters),
+			discordListField("Top coraiders", discordLeaderboardLines(aggregate.Leaderboard, accountStatsUrl, playerStatsUrl)),
+			discordListField("Guilds", guilds),
+		},
+	})
+}
+
+func discordPlayerResponse(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	playerId int64,
+	accountStatsUrl string,
+	playerStatsUrl string,
+) discord.InteractionResponse {
+	playerKey := google_datastore.IDKey("player", playerId, nil)
+	var player datastore.Player
+	err := datastoreClient.Get(ctx, playerKey, &player)
+	if err == google_datastore.ErrNoSuchEntity {
+		return discordErrorResponse("No such player: %v", playerId)
+	} else if err != nil {
+		return discordErrorResponse("Failed to load player: %v", err)
+	}
+
+	err = datastore.LoadPlayerHistory(ctx, datastoreClient, playerKey, &player)
+	if err != nil {
+		return discordErrorResponse("Failed to load player: %v", err)
+	}
+
+	numRaids := 0
+	for _, report := range player.Reports {
+		if !report.Duplicate {
+			numRaids++
+		}
+	}
+	description := fmt.Sprintf("%v, %v raids", player.Class, numRaids)
+	if player.Account != "" {
+		description = fmt.Sprintf("[#%v](%v?account_name=%v), %v",
+			player.Account, accountStatsUrl, url.QueryEscape(player.Account), description)
+	}
+
+	recentRaids := []string{}
+	for _, report := range player.Reports {
+		recentRaids = append(recentRaids, fmt.Sprintf("%v (%v)", report.Title, report.StartTime.Format("2006-01-02")))
+	}
+
+	return discordEmbedResponse(discord.Embed{
+		Title:       fmt.Sprintf("%v-%v", player.Name, player.Server),
+		Url:         fmt.Sprintf("%v?player_id=%v", playerStatsUrl, playerId),
+		Description: description,
+		Color:       discord.EmbedColor,
+		Fields: []discord.EmbedField{
+			discordListField("Top coraiders", discordLeaderboardLines(playerLeaderboard(playerId, player), accountStatsUrl, playerStatsUrl)),
+			discordListField("Recent raids", recentRaids),
+		},
+	})
+}
+
+func discordGuildResponse(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	guildId int32,
+	accountStatsUrl string,
+	playerStatsUrl string,
+	guildStatsUrl string,
+) discord.InteractionResponse {
+	aggregate, err := loadGuildStats(ctx, datastoreClient, guildId)
+	if err != nil {
+		return discordErrorResponse("Failed to load guild stats: %v", err)
+	}
+	if len(aggregate.Raids) == 0 {
+		return discordErrorResponse("No raids have been scanned for guild %v.", guildId)
+	}
+
+	members := []string{}
+	for _, member := range aggregate.Members {
+		members = append(members, fmt.Sprintf("%v (%v%%)",
+			discordEntryLink(member.Entry, accountStatsUrl, playerStatsUrl),
+			member.AttendancePresentOrBenched))
+	}
+
+	return discordEmbedResponse(discord.Embed{
+		Title: aggregate.Guild.Name,
+		Url:   fmt.Sprintf("%v?guild_id=%v", guildStatsUrl, guildId),
+		Description: fmt.Sprintf("%v raids, %v roster members, last raid %v",
+			aggregate.NumRaids, len(aggregate.Members), aggregate.Raids[0].StartTime.Format("2006-01-02")),
+		Color: discord.EmbedColor,
+		Fields: []discord.EmbedField{
+			discordListField("Members by attendance", members),
+			discordListField("Top PUGs", discordLeaderboardLines(aggregate.Pugs, accountStatsUrl, playerStatsUrl)),
+		},
+	})
+}
+
+func discordScanResponse(
+	ctx context.Context,
+	pubsubClient *google_pubsub.Client,
+	reports string,
+	scanReportsUrl string,
+) discord.InteractionResponse {
+	codes, invalid := parseReportCodes(reports)
+	if len(invalid) > 0 {
+		return discordErrorResponse("Not a Warcraft Logs report URL or code: %v", strings.Join(invalid, ", "))
+	}
+	if len(codes) == 0 {
+		return discordErrorResponse("Please specify a Warcraft Logs report link or code.")
+	}
+	if len(codes) > discordMaxScanReports {
+		return discordErrorResponse("Can scan at most %v reports at once, got %v.", discordMaxScanReports, len(codes))
+	}
+
+	err := pubsub.PublishReportEvents(pubsubClient, ctx, pubsub.NewCauseId(), codes)
+	if err != nil {
+		return discordErrorResponse("Failed to start scanning: %v", err)
+	}
+
+	return discordEmbedResponse(discord.Embed{
+		Title:       fmt.Sprintf("Scanning %v reports", len(codes)),
+		Url:         fmt.Sprintf("%v?codes=%v", scanReportsUrl, strings.Join(codes, ",")),
+		Description: strings.Join(codes, "\n"),
+		Color:       discord.EmbedColor,
+	})
+}
+
+func discordLeaderboardLines(leaderboard []html.LeaderboardEntry, accountStatsUrl string, playerStatsUrl string) []string {
+	lines := []string{}
+	for _, entry := range leaderboard {
+		lines = append(lines, fmt.Sprintf("%v (%v)", discordEntryLink(entry, accountStatsUrl, playerStatsUrl), entry.Count))
+	}
+	return lines
+}
+
+func discordEntryLink(entry html.LeaderboardEntry, accountStatsUrl string, playerStatsUrl string) string {
+	if entry.IsAccount {
+		return fmt.Sprintf("[#%v](%v?account_name=%v)", entry.Account, accountStatsUrl, url.QueryEscape(entry.Account))
+	}
+	return discordCharacterLink(entry.Character, playerStatsUrl)
+}
+
+func discordCharacterLink(character datastore.PlayerCoraider, playerStatsUrl string) string {
+	return fmt.Sprintf("[%v-%v](%v?player_id=%v)", character.Name, character.Server, playerStatsUrl, character.Id)
+}
+
+// discordListField joins the first lines of a list into an embed field, staying within Discord's limit of 1024
+// characters per field value.
+func discordListField(name string, lines []string) discord.EmbedField {
+	value := ""
+	for i, line := range lines {
+		if i >= discordLeaderboardEntries || len(value)+len(line)+1 > 1024 {
+			break
+		}
+		value += line + "\n"
+	}
+	if value == "" {
+		value = "None"
+	}
+	return discord.EmbedField{
+		Name:  name,
+		Value: value,
+	}
+}
+
+func discordEmbedResponse(embed discord.Embed) discord.InteractionResponse {
+	return discord.InteractionResponse{
+		Type: discord.ResponseTypeChannelMessageWithSource,
+		Data: &discord.InteractionResponseData{
+			Embeds: []discord.Embed{embed},
+		},
+	}
+}
+
+// discordErrorResponse replies with a message only visible to the user that issued the command.
+func discordErrorResponse(format string, args ...interface{}) discord.InteractionResponse {
+	return discord.InteractionResponse{
+		Type: discord.ResponseTypeChannelMessageWithSource,
+		Data: &discord.InteractionResponseData{
+			Content: fmt.Sprintf(format, args...),
+			Flags:   discord.MessageFlagEphemeral,
+		},
+	}
+}
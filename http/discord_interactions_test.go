@@ -0,0 +1,69 @@
+package http
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDiscordInteractionsPing(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"type":1}`
+	timestamp := "1700000000"
+	signature := ed25519.Sign(privateKey, []byte(timestamp+body))
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Add("X-Signature-Ed25519", hex.EncodeToString(signature))
+	req.Header.Add("X-Signature-Timestamp", timestamp)
+
+	rr := httptest.NewRecorder()
+	DiscordInteractions(
+		rr,
+		req,
+		nil,
+		nil,
+		hex.EncodeToString(publicKey),
+		"http://example.com/accountstats",
+		"http://example.com/playerstats",
+		"http://example.com/guildstats",
+		"http://example.com/scanreports",
+	)
+
+	if rr.Code != 200 || strings.TrimSpace(rr.Body.String()) != `{"type":1}` {
+		t.Errorf("unexpected ping response %v: %v", rr.Code, rr.Body.String())
+	}
+}
+
+func TestDiscordInteractionsInvalidSignature(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"type":1}`))
+	req.Header.Add("X-Signature-Ed25519", strings.Repeat("00", ed25519.SignatureSize))
+	req.Header.Add("X-Signature-Timestamp", "1700000000")
+
+	rr := httptest.NewRecorder()
+	DiscordInteractions(
+		rr,
+		req,
+		nil,
+		nil,
+		hex.EncodeToString(publicKey),
+		"http://example.com/accountstats",
+		"http://example.com/playerstats",
+		"http://example.com/guildstats",
+		"http://example.com/scanreports",
+	)
+
+	if rr.Code != 401 {
+		t.Errorf("expected unauthorized, got %v: %v", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,403 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	go_http "net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	google_datastore "cloud.google.com/go/datastore"
+	"github.com/FabianHahn/raidlogscan/cache"
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"github.com/FabianHahn/raidlogscan/graphql"
+	"github.com/FabianHahn/raidlogscan/html"
+	"github.com/FabianHahn/raidlogscan/oauth2"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	maxRosterRaids = 50
+)
+
+func GuildRoster(
+	w go_http.ResponseWriter,
+	r *go_http.Request,
+	htmlRenderer *html.Renderer,
+	datastoreClient *google_datastore.Client,
+	pageCache *cache.PageCache,
+	accountStatsUrl string,
+	playerStatsUrl string,
+	guildStatsUrl string,
+	guildRosterUrl string,
+	scanReportsUrl string,
+	searchUrl string,
+	oauth2LoginUrl string,
+) {
+	ctx := context.Background()
+
+	guildId64, err := strconv.ParseInt(r.FormValue("guild_id"), 10, 32)
+	if err != nil {
+		w.WriteHeader(go_http.StatusBadRequest)
+		fmt.Fprintf(w, "guild ID conversion failed: %v", err.Error())
+		return
+	}
+	guildId := int32(guildId64)
+
+	session := r.PostFormValue("session")
+	canEdit := false
+	if session != "" {
+		canEdit, err = isGuildOfficer(ctx, datastoreClient, session, guildId)
+		if err != nil {
+			w.WriteHeader(go_http.StatusForbidden)
+			fmt.Fprintf(w, "invalid session: %v", err.Error())
+			return
+		}
+	}
+
+	// Following the roster link from the login page posts the session without an action.
+	if action := r.PostFormValue("action"); action != "" {
+		if !canEdit {
+			w.WriteHeader(go_http.StatusForbidden)
+			fmt.Fprintf(w, "Only officers of this guild can edit its roster.")
+			return
+		}
+
+		switch action {
+		case "add", "remove":
+			var member datastore.GuildRosterMember
+			member, err = parseRosterMember(ctx, datastoreClient, r)
+			if err != nil {
+				w.WriteHeader(go_http.StatusBadRequest)
+				fmt.Fprintf(w, "invalid roster member: %v", err.Error())
+				return
+			}
+			err = updateGuildRoster(ctx, datastoreClient, guildId, member, action == "add")
+		case "absence_add", "absence_remove":
+			var absence datastore.GuildRaidAbsence
+			absence, err = parseRaidAbsence(ctx, datastoreClient, r, guildId)
+			if err != nil {
+				w.WriteHeader(go_http.StatusBadRequest)
+				fmt.Fprintf(w, "invalid bench or absence entry: %v", err.Error())
+				return
+			}
+			err = updateGuildAbsences(ctx, datastoreClient, guildId, absence, action == "absence_add")
+		default:
+			w.WriteHeader(go_http.StatusBadRequest)
+			fmt.Fprintf(w, "unknown roster action %v", action)
+			return
+		}
+		if err != nil {
+			w.WriteHeader(go_http.StatusInternalServerError)
+			fmt.Fprintf(w, "failed to update roster: %v", err.Error())
+			return
+		}
+
+		// Roster edits are made by hand, so the page is rendered again without waiting for invalidations to settle.
+		err = cache.GuildStatsPage(guildId).InvalidateNow(ctx, pageCache)
+		if err != nil {
+			w.WriteHeader(go_http.StatusInternalServerError)
+			fmt.Fprintf(w, "failed to invalidate guild stats cache for %v: %v", guildId, err)
+			return
+		}
+	}
+
+	guildKey := google_datastore.IDKey("guild", guildId64, nil)
+	var guild datastore.Guild
+	err = datastoreClient.Get(ctx, guildKey, &guild)
+	if err == google_datastore.ErrNoSuchEntity && !canEdit {
+		w.WriteHeader(go_http.StatusNotFound)
+		fmt.Fprintf(w, "Unknown guild %v, scan some of its reports first.", guildId)
+		return
+	} else if err != nil && err != google_datastore.ErrNoSuchEntity {
+		w.WriteHeader(go_http.StatusInternalServerError)
+		fmt.Fprintf(w, "Datastore query failed: %v", err)
+		return
+	}
+
+	raids := []html.GuildRaid{}
+	query := google_datastore.NewQuery("report").
+		FilterField("GuildId", "=", guildId).
+		Order("-StartTime").
+		Limit(maxRosterRaids)
+	responseIter := datastoreClient.Run(ctx, query)
+	for {
+		var report datastore.Report
+		key, err := responseIter.Next(&report)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			w.WriteHeader(go_http.StatusInternalServerError)
+			fmt.Fprintf(w, "Datastore query failed: %v", err)
+			return
+		}
+
+		raids = append(raids, html.GuildRaid{
+			Code:       key.Name,
+			StartTime:  report.StartTime,
+			Title:      report.Title,
+			Zone:       report.Zone,
+			NumPlayers: len(report.Players),
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	w.Header().Set("Cache-Control", cache.CacheControlPrivate)
+	err = htmlRenderer.RenderGuildRoster(
+		w,
+		guildId,
+		guild,
+		raids,
+		canEdit,
+		session,
+		accountStatsUrl,
+		playerStatsUrl,
+		guildStatsUrl,
+		guildRosterUrl,
+		scanReportsUrl,
+		searchUrl,
+		oauth2LoginUrl)
+	if err != nil {
+		fmt.Fprintf(w, "failed to render template: %v", err)
+		return
+	}
+}
+
+// isGuildOfficer checks whether the user identified by a session token was an officer of the given guild when they
+// last logged in.
+func isGuildOfficer(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	session string,
+	guildId int32,
+) (bool, error) {
+	userId, err := oauth2.ParseSessionToken(session)
+	if err != nil {
+		return false, err
+	}
+
+	userKey := google_datastore.IDKey("user", int64(userId), nil)
+	var user datastore.User
+	err = datastoreClient.Get(ctx, userKey, &user)
+	if err != nil {
+		return false, fmt.Errorf("datastore get user %v failed: %v", userId, err)
+	}
+
+	for _, officerGuildId := range user.OfficerGuildIds {
+		if officerGuildId == guildId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// parseRosterMember builds a roster member from the submitted form. Characters that are claimed by an account are
+// added as that account, so that their attendance is counted the same way as on the guild stats page.
+func parseRosterMember(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	r *go_http.Request,
+) (datastore.GuildRosterMember, error) {
+	member := datastore.GuildRosterMember{
+		Account: r.FormValue("account_name"),
+		Rank:    r.FormValue("rank"),
+		Role:    r.FormValue("role"),
+	}
+	if member.Role != "" && member.Role != "tank" && member.Role != "healer" && member.Role != "dps" {
+		return member, fmt.Errorf("unknown role %v", member.Role)
+	}
+
+	if member.Account != "" {
+		query := google_datastore.NewQuery("player").FilterField("Account", "=", member.Account)
+		count, err := datastoreClient.Count(ctx, query)
+		if err != nil {
+			return member, fmt.Errorf("player by account %v lookup failed: %v", member.Account, err)
+		}
+		if count == 0 {
+			return member, fmt.Errorf("no characters are claimed by account %v", member.Account)
+		}
+		return member, nil
+	}
+
+	playerId, err := strconv.ParseInt(r.FormValue("player_id"), 10, 64)
+	if err != nil {
+		return member, fmt.Errorf("player ID conversion failed: %v", err)
+	}
+
+	playerKey := google_datastore.IDKey("player", playerId, nil)
+	var player datastore.Player
+	err = datastoreClient.Get(ctx, playerKey, &player)
+	if err != nil {
+		return member, fmt.Errorf("datastore get player %v failed: %v", playerId, err)
+	}
+
+	if player.Account != "" {
+		member.Account = player.Account
+		return member, nil
+	}
+	member.PlayerId = playerId
+	member.Name = player.Name
+	member.Class = player.Class
+	member.Server = player.Server
+	return member, nil
+}
+
+// updateGuildRoster removes the given member from a guild's roster, and adds it back with its new rank and role if add
+// is set.
+func updateGuildRoster(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	guildId int32,
+	member datastore.GuildRosterMember,
+	add bool,
+) error {
+	guildKey := google_datastore.IDKey("guild", int64(guildId), nil)
+	tx, err := datastoreClient.NewTransaction(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create transaction: %v", err.Error())
+	}
+
+	var guild datastore.Guild
+	err = tx.Get(guildKey, &guild)
+	if err == google_datastore.ErrNoSuchEntity {
+		guild.Flavour = graphql.Flavour
+	} else if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("datastore get guild %v failed: %v", guildId, err.Error())
+	}
+
+	roster := []datastore.GuildRosterMember{}
+	for _, existing := range guild.Roster {
+		if existing.Account == member.Account && existing.PlayerId == member.PlayerId {
+			continue
+		}
+		roster = append(roster, existing)
+	}
+	if add {
+		roster = append(roster, member)
+	}
+	sort.SliceStable(roster, func(i int, j int) bool {
+		if roster[i].Rank != roster[j].Rank {
+			return roster[i].Rank < roster[j].Rank
+		}
+		return roster[i].Account+roster[i].Name < roster[j].Account+roster[j].Name
+	})
+	guild.Roster = roster
+
+	_, err = tx.Put(guildKey, &guild)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("datastore write guild %v failed: %v", guildId, err.Error())
+	}
+
+	_, err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("guild %v roster datastore transaction failed: %v", guildId, err.Error())
+	}
+	return nil
+}
+
+// parseRaidAbsence builds a bench or absence entry from the submitted form. The member is given as
+// datastore.GuildMemberKey of a roster member, and the report has to be a raid of the guild.
+func parseRaidAbsence(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	r *go_http.Request,
+	guildId int32,
+) (datastore.GuildRaidAbsence, error) {
+	absence := datastore.GuildRaidAbsence{
+		Code: r.FormValue("code"),
+		Kind: r.FormValue("kind"),
+		Note: r.FormValue("note"),
+	}
+	if absence.Kind != datastore.GuildAbsenceBenched && absence.Kind != datastore.GuildAbsenceExcused {
+		return absence, fmt.Errorf("unknown absence kind %v", absence.Kind)
+	}
+
+	member := r.FormValue("member")
+	if strings.HasPrefix(member, "#") {
+		absence.Account = strings.TrimPrefix(member, "#")
+	} else {
+		playerId, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			return absence, fmt.Errorf("member conversion failed: %v", err)
+		}
+		absence.PlayerId = playerId
+	}
+
+	reportKey := google_datastore.NameKey("report", absence.Code, nil)
+	var report datastore.Report
+	err := datastoreClient.Get(ctx, reportKey, &report)
+	if err != nil {
+		return absence, fmt.Errorf("datastore get report %v failed: %v", absence.Code, err)
+	}
+	if report.GuildId != guildId {
+		return absence, fmt.Errorf("report %v is not a raid of guild %v", absence.Code, guildId)
+	}
+	return absence, nil
+}
+
+// updateGuildAbsences removes the bench or absence entry of a member for a raid, and adds the given one instead if add
+// is set.
+func updateGuildAbsences(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	guildId int32,
+	absence datastore.GuildRaidAbsence,
+	add bool,
+) error {
+	guildKey := google_datastore.IDKey("guild", int64(guildId), nil)
+	tx, err := datastoreClient.NewTransaction(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create transaction: %v", err.Error())
+	}
+
+	var guild datastore.Guild
+	err = tx.Get(guildKey, &guild)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("datastore get guild %v failed: %v", guildId, err.Error())
+	}
+
+	if add {
+		isMember := false
+		for _, member := range guild.Roster {
+			if member.Account == absence.Account && member.PlayerId == absence.PlayerId {
+				isMember = true
+				break
+			}
+		}
+		if !isMember {
+			tx.Rollback()
+			return fmt.Errorf("%v is not on the roster", datastore.GuildMemberKey(absence.Account, absence.PlayerId))
+		}
+	}
+
+	absences := []datastore.GuildRaidAbsence{}
+	for _, existing := range guild.Absences {
+		if existing.Code == absence.Code &&
+			existing.Account == absence.Account &&
+			existing.PlayerId == absence.PlayerId {
+			continue
+		}
+		absences = append(absences, existing)
+	}
+	if add {
+		absences = append(absences, absence)
+	}
+	guild.Absences = absences
+
+	_, err = tx.Put(guildKey, &guild)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("datastore write guild %v failed: %v", guildId, err.Error())
+	}
+
+	_, err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("guild %v absences datastore transaction failed: %v", guildId, err.Error())
+	}
+	return nil
+}
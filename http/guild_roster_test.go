@@ -0,0 +1,47 @@
+package http
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/FabianHahn/raidlogscan/cache"
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"github.com/FabianHahn/raidlogscan/html"
+)
+
+const (
+	testRosterGuildId = "687460"
+)
+
+func TestGuildRoster(t *testing.T) {
+	req := httptest.NewRequest("GET", fmt.Sprintf("/?guild_id=%v", testRosterGuildId), nil)
+	req.Header.Add("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	htmlRenderer := html.CreateRendererOrDie()
+	datastoreClient := datastore.CreateDatastoreClientOrDie()
+	pageCache := cache.CreatePageCache(datastoreClient, "")
+	accountStatsUrl := "http://example.com/accountstats"
+	playerStatsUrl := "http://example.com/playerstats"
+	guildStatsUrl := "http://example.com/guildstats"
+	guildRosterUrl := "http://example.com/guildroster"
+	scanReportsUrl := "http://example.com/scanreports"
+	searchUrl := "http://example.com/search"
+	oauth2LoginUrl := "http://example.com/oauth2login"
+	GuildRoster(
+		rr,
+		req,
+		htmlRenderer,
+		datastoreClient,
+		pageCache,
+		accountStatsUrl,
+		playerStatsUrl,
+		guildStatsUrl,
+		guildRosterUrl,
+		scanReportsUrl,
+		searchUrl,
+		oauth2LoginUrl)
+
+	t.Log(rr.Body.String())
+}
@@ -7,12 +7,13 @@ import (
 	go_http "net/http"
 	"sort"
 	"strconv"
+	"time"
 
 	google_datastore "cloud.google.com/go/datastore"
+	"github.com/FabianHahn/raidlogscan/aggregate"
 	"github.com/FabianHahn/raidlogscan/cache"
 	"github.com/FabianHahn/raidlogscan/datastore"
 	"github.com/FabianHahn/raidlogscan/html"
-	"google.golang.org/api/iterator"
 )
 
 func GuildStats(
@@ -20,9 +21,17 @@ func GuildStats(
 	r *go_http.Request,
 	htmlRenderer *html.Renderer,
 	datastoreClient *google_datastore.Client,
+	pageCache *cache.PageCache,
 	scanGuildReportsUrl string,
 	accountStatsUrl string,
 	playerStatsUrl string,
+	reportStatsUrl string,
+	guildRosterUrl string,
+	raidNetworkUrl string,
+	raidCalendarUrl string,
+	reportFeedUrl string,
+	scanReportsUrl string,
+	searchUrl string,
 	oauth2LoginUrl string,
 ) {
 	ctx := context.Background()
@@ -36,113 +45,316 @@ func GuildStats(
 	}
 	guildId := int32(guildId64)
 
-	guildStatsKey := google_datastore.IDKey("guild_stats", guildId64, nil)
-	var guildStats datastore.GuildStats
-	err = datastoreClient.Get(ctx, guildStatsKey, &guildStats)
-	if err != nil && err != google_datastore.ErrNoSuchEntity {
-		w.WriteHeader(go_http.StatusInternalServerError)
-		fmt.Fprintf(w, "Datastore query failed: %v", err)
-		return
-	} else if err == nil {
-		cache.WriteCompressedResponseOrDecompress(w, r, guildStats.HtmlGzip)
+	statsPage := cache.GuildStatsPage(guildId)
+	if statsPage.OutputCached(w, r, pageCache, ctx) {
 		return
 	}
+	creationTime := time.Now()
 
-	guildName := ""
-	raids := []html.GuildRaid{}
-	playerAccounts := map[int64]string{}
-	accountCounts := map[string]int64{}
-	raiders := map[int64]datastore.PlayerCoraider{}
-	query := google_datastore.NewQuery("report").FilterField("GuildId", "=", guildId).Order("-StartTime")
-	responseIter := datastoreClient.Run(ctx, query)
-	for {
-		var report datastore.Report
-		key, err := responseIter.Next(&report)
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			w.WriteHeader(go_http.StatusInternalServerError)
-			fmt.Fprintf(w, "Datastore query failed: %v", err)
-			return
-		}
+	stats, err := loadGuildStats(ctx, datastoreClient, guildId)
+	if err != nil {
+		w.WriteHeader(go_http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to load guild stats: %v", err)
+		return
+	}
 
-		guildName = report.GuildName
-		raids = append(raids, html.GuildRaid{
-			Code:       key.Name,
-			StartTime:  report.StartTime,
-			Title:      report.Title,
-			Zone:       report.Zone,
-			NumPlayers: len(report.Players),
-		})
+	statsPage.CacheAndOutput(w, r, pageCache, ctx, creationTime, func(wr io.Writer) error {
+		return htmlRenderer.RenderGuildStats(
+			wr,
+			guildId,
+			stats.Guild,
+			stats.Members,
+			stats.Pugs,
+			stats.NumRaids,
+			stats.Raids,
+			scanGuildReportsUrl,
+			accountStatsUrl,
+			playerStatsUrl,
+			reportStatsUrl,
+			guildRosterUrl,
+			raidNetworkUrl,
+			raidCalendarUrl,
+			reportFeedUrl,
+			scanReportsUrl,
+			searchUrl,
+			oauth2LoginUrl)
+	})
+}
 
-		for _, playerAccount := range report.PlayerAccounts {
-			playerAccounts[playerAccount.PlayerId] = playerAccount.Name
-		}
+type guildAggregate struct {
+	Guild    datastore.Guild
+	Members  []html.GuildMember
+	Pugs     []html.LeaderboardEntry
+	NumRaids int64
+	Raids    []html.GuildRaid
+}
 
-		reportPlayers := map[int64]struct{}{}
-		for _, player := range report.Players {
-			// Don't count duplicate players in a report multiple times
-			if _, ok := reportPlayers[player.Id]; ok {
-				continue
-			}
-			reportPlayers[player.Id] = struct{}{}
+// loadGuildStats aggregates the raids of a guild into its roster members, PUGs and attendance, based on the
+// precomputed guild aggregate.
+func loadGuildStats(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	guildId int32,
+) (guildAggregate, error) {
+	guildKey := google_datastore.IDKey("guild", int64(guildId), nil)
+	var guild datastore.Guild
+	err := datastoreClient.Get(ctx, guildKey, &guild)
+	if err != nil && err != google_datastore.ErrNoSuchEntity {
+		return guildAggregate{}, fmt.Errorf("datastore guild query failed: %v", err)
+	}
 
-			if accountName, ok := playerAccounts[player.Id]; ok {
-				accountCounts[accountName]++
-				continue
-			}
+	stored, err := aggregate.LoadGuildAggregate(ctx, datastoreClient, guildId)
+	if err != nil {
+		return guildAggregate{}, err
+	}
 
-			if entry, ok := raiders[player.Id]; ok {
-				entry.Count += 1
-				raiders[player.Id] = entry
-			} else {
-				raiders[player.Id] = datastore.PlayerCoraider{
-					Id:     player.Id,
-					Name:   player.Name,
-					Server: player.Server,
-					Class:  player.Class,
-					Count:  1,
-				}
-			}
+	playerAccounts := map[int64]string{}
+	for _, raider := range stored.Raiders {
+		if raider.Account != "" {
+			playerAccounts[raider.PlayerId] = raider.Account
 		}
 	}
 
-	leaderboard := []html.LeaderboardEntry{}
-	for accountName, count := range accountCounts {
-		leaderboard = append(leaderboard, html.LeaderboardEntry{
-			Count:     count,
-			IsAccount: true,
-			Account:   accountName,
+	raids := []html.GuildRaid{}
+	for _, raid := range stored.Raids {
+		raids = append(raids, html.GuildRaid{
+			Code:       raid.Code,
+			StartTime:  raid.StartTime,
+			Title:      raid.Title,
+			Zone:       raid.Zone,
+			NumPlayers: int(raid.NumPlayers),
+			NumTanks:   int(raid.NumTanks),
+			NumHealers: int(raid.NumHealers),
+			NumDps:     int(raid.NumDps),
 		})
 	}
 
-	for _, raider := range raiders {
+	leaderboard := []html.LeaderboardEntry{}
+	for _, raider := range stored.Raiders {
+		if raider.Account != "" {
+			continue
+		}
+
 		leaderboard = append(leaderboard, html.LeaderboardEntry{
 			Count:     raider.Count,
 			IsAccount: false,
 			Character: datastore.PlayerCoraider{
-				Id:     raider.Id,
+				Id:     raider.PlayerId,
 				Name:   raider.Name,
 				Server: raider.Server,
 				Class:  raider.Class,
 			},
 		})
 	}
+	for _, account := range stored.Accounts {
+		leaderboard = append(leaderboard, html.LeaderboardEntry{
+			Count:     account.Count,
+			IsAccount: true,
+			Account:   account.Name,
+		})
+	}
 	sort.SliceStable(leaderboard, func(i int, j int) bool {
 		return leaderboard[i].Count > leaderboard[j].Count
 	})
 
-	cache.CacheAndOutputGuildStats(w, r, datastoreClient, ctx, guildId, guildName, func(wr io.Writer) error {
-		return htmlRenderer.RenderGuildStats(
-			wr,
-			guildId,
-			guildName,
-			leaderboard,
-			raids,
-			scanGuildReportsUrl,
-			accountStatsUrl,
-			playerStatsUrl,
-			oauth2LoginUrl)
+	raidParticipants := guildRaidParticipants(guild.Absences, stored.Raids, playerAccounts)
+
+	benched, excused := countGuildAbsences(guild.Absences, playerAccounts, raids, raidParticipants)
+	members, pugs := splitGuildRoster(guild.Roster, leaderboard, playerAccounts, stored.NumRaids, benched, excused)
+
+	if guild.Name == "" {
+		guild.Name = stored.GuildName
+	}
+	return guildAggregate{
+		Guild:    guild,
+		Members:  members,
+		Pugs:     pugs,
+		NumRaids: stored.NumRaids,
+		Raids:    raids,
+	}, nil
+}
+
+// guildRaidParticipants collects who took part in the raids that have bench or absence entries, keyed by
+// datastore.GuildMemberKey, to tell whether the entries apply.
+func guildRaidParticipants(
+	absences []datastore.GuildRaidAbsence,
+	raids []datastore.GuildAggregateRaid,
+	playerAccounts map[int64]string,
+) map[string]map[string]struct{} {
+	absenceCodes := map[string]struct{}{}
+	for _, absence := range absences {
+		absenceCodes[absence.Code] = struct{}{}
+	}
+
+	raidParticipants := map[string]map[string]struct{}{}
+	for _, raid := range raids {
+		if _, ok := absenceCodes[raid.Code]; !ok {
+			continue
+		}
+
+		participants := map[string]struct{}{}
+		for _, raiderId := range raid.RaiderIds {
+			participants[datastore.GuildMemberKey(playerAccounts[raiderId], raiderId)] = struct{}{}
+		}
+		raidParticipants[raid.Code] = participants
+	}
+	return raidParticipants
+}
+
+// splitGuildRoster separates the guild leaderboard into roster members and PUGs. Roster members that never attended
+// a raid are included with a count of zero.
+func splitGuildRoster(
+	roster []datastore.GuildRosterMember,
+	leaderboard []html.LeaderboardEntry,
+	playerAccounts map[int64]string,
+	numRaids int64,
+	benched map[string]int64,
+	excused map[string]int64,
+) ([]html.GuildMember, []html.LeaderboardEntry) {
+	rosterAccounts := map[string]datastore.GuildRosterMember{}
+	rosterPlayers := map[int64]datastore.GuildRosterMember{}
+	for _, member := range roster {
+		member.Account = resolveGuildMemberAccount(member.Account, member.PlayerId, playerAccounts)
+		if member.Account != "" {
+			rosterAccounts[member.Account] = member
+		} else {
+			rosterPlayers[member.PlayerId] = member
+		}
+	}
+
+	members := []html.GuildMember{}
+	pugs := []html.LeaderboardEntry{}
+	for _, entry := range leaderboard {
+		var member datastore.GuildRosterMember
+		var ok bool
+		if entry.IsAccount {
+			member, ok = rosterAccounts[entry.Account]
+			delete(rosterAccounts, entry.Account)
+		} else {
+			member, ok = rosterPlayers[entry.Character.Id]
+			delete(rosterPlayers, entry.Character.Id)
+		}
+		if !ok {
+			pugs = append(pugs, entry)
+			continue
+		}
+
+		members = append(members, createGuildMember(entry, member, numRaids, benched, excused))
+	}
+
+	for accountName, member := range rosterAccounts {
+		entry := html.LeaderboardEntry{
+			IsAccount: true,
+			Account:   accountName,
+		}
+		members = append(members, createGuildMember(entry, member, numRaids, benched, excused))
+	}
+	for playerId, member := range rosterPlayers {
+		entry := html.LeaderboardEntry{
+			Character: datastore.PlayerCoraider{
+				Id:     playerId,
+				Name:   member.Name,
+				Server: member.Server,
+				Class:  member.Class,
+			},
+		}
+		members = append(members, createGuildMember(entry, member, numRaids, benched, excused))
+	}
+	// Members without raids come from map iteration, so ties are broken by name to keep the order (and ETag) stable.
+	sort.SliceStable(members, func(i int, j int) bool {
+		if members[i].Entry.Count != members[j].Entry.Count {
+			return members[i].Entry.Count > members[j].Entry.Count
+		}
+		nameI := guildMemberSortName(members[i].Entry)
+		nameJ := guildMemberSortName(members[j].Entry)
+		if nameI != nameJ {
+			return nameI < nameJ
+		}
+		return members[i].Entry.Character.Id < members[j].Entry.Character.Id
 	})
+
+	return members, pugs
+}
+
+func guildMemberSortName(entry html.LeaderboardEntry) string {
+	if entry.IsAccount {
+		return entry.Account
+	}
+	return entry.Character.Name + "-" + entry.Character.Server
+}
+
+func createGuildMember(
+	entry html.LeaderboardEntry,
+	member datastore.GuildRosterMember,
+	numRaids int64,
+	benched map[string]int64,
+	excused map[string]int64,
+) html.GuildMember {
+	key := datastore.GuildMemberKey(entry.Account, entry.Character.Id)
+	return html.GuildMember{
+		Entry:                      entry,
+		Rank:                       member.Rank,
+		Role:                       member.Role,
+		Benched:                    benched[key],
+		Excused:                    excused[key],
+		AttendancePresent:          attendancePercentage(entry.Count, numRaids),
+		AttendancePresentOrBenched: attendancePercentage(entry.Count+benched[key], numRaids),
+		AttendanceExcused:          attendancePercentage(entry.Count+benched[key], numRaids-excused[key]),
+	}
+}
+
+// countGuildAbsences counts the bench and excused absence entries per raider, keyed by datastore.GuildMemberKey, and
+// fills in the per raid counts of the listed raids. Entries for raiders that show up in a listed raid anyway are
+// ignored, while entries for older raids are counted as they are.
+func countGuildAbsences(
+	absences []datastore.GuildRaidAbsence,
+	playerAccounts map[int64]string,
+	raids []html.GuildRaid,
+	raidParticipants map[string]map[string]struct{},
+) (map[string]int64, map[string]int64) {
+	raidIndices := map[string]int{}
+	for i, raid := range raids {
+		raidIndices[raid.Code] = i
+	}
+
+	benched := map[string]int64{}
+	excused := map[string]int64{}
+	for _, absence := range absences {
+		key := datastore.GuildMemberKey(
+			resolveGuildMemberAccount(absence.Account, absence.PlayerId, playerAccounts),
+			absence.PlayerId)
+		if _, ok := raidParticipants[absence.Code][key]; ok {
+			continue
+		}
+
+		raidIndex, listed := raidIndices[absence.Code]
+		if absence.Kind == datastore.GuildAbsenceBenched {
+			benched[key]++
+			if listed {
+				raids[raidIndex].NumBenched++
+			}
+		} else {
+			excused[key]++
+			if listed {
+				raids[raidIndex].NumExcused++
+			}
+		}
+	}
+	return benched, excused
+}
+
+// resolveGuildMemberAccount returns the account a roster entry counts towards, which differs from the stored one if
+// the character was claimed by an account after the entry was made.
+func resolveGuildMemberAccount(account string, playerId int64, playerAccounts map[int64]string) string {
+	if account != "" {
+		return account
+	}
+	return playerAccounts[playerId]
+}
+
+func attendancePercentage(count int64, numRaids int64) int64 {
+	if numRaids <= 0 {
+		return 0
+	}
+	return count * 100 / numRaids
 }
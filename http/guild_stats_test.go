@@ -5,6 +5,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/FabianHahn/raidlogscan/cache"
 	"github.com/FabianHahn/raidlogscan/datastore"
 	"github.com/FabianHahn/raidlogscan/html"
 )
@@ -20,18 +21,34 @@ func TestGuildStats(t *testing.T) {
 	rr := httptest.NewRecorder()
 	htmlRenderer := html.CreateRendererOrDie()
 	datastoreClient := datastore.CreateDatastoreClientOrDie()
+	pageCache := cache.CreatePageCache(datastoreClient, "")
 	scanGuildReportsUrl := "http://example.com/scanguildreports"
 	accountStatsUrl := "http://example.com/accountstats"
 	playerStatsUrl := "http://example.com/playerstats"
+	reportStatsUrl := "http://example.com/reportstats"
+	guildRosterUrl := "http://example.com/guildroster"
+	raidNetworkUrl := "http://example.com/raidnetwork"
+	raidCalendarUrl := "http://example.com/raidcalendar"
+	reportFeedUrl := "http://example.com/reportfeed"
+	scanReportsUrl := "http://example.com/scanreports"
+	searchUrl := "http://example.com/search"
 	oauth2LoginUrl := "http://example.com/oauth2login"
 	GuildStats(
 		rr,
 		req,
 		htmlRenderer,
 		datastoreClient,
+		pageCache,
 		scanGuildReportsUrl,
 		accountStatsUrl,
 		playerStatsUrl,
+		reportStatsUrl,
+		guildRosterUrl,
+		raidNetworkUrl,
+		raidCalendarUrl,
+		reportFeedUrl,
+		scanReportsUrl,
+		searchUrl,
 		oauth2LoginUrl)
 
 	t.Log(rr.Body.String())
@@ -0,0 +1,101 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	go_http "net/http"
+	"net/url"
+	"strconv"
+
+	google_datastore "cloud.google.com/go/datastore"
+	"github.com/FabianHahn/raidlogscan/cache"
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	defaultMigratePlayersLimit = 100
+	maxMigratePlayersLimit     = 1000
+)
+
+// MigratePlayers moves the history of players that still store it in legacy arrays into child entities, up to limit
+// players per request. Players are also migrated on their next update, so this only needs to be called repeatedly
+// until no players are left to get rid of the legacy arrays everywhere.
+//
+// Players stored before versions were introduced don't have a Version property at all, which the version query never
+// matches. Passing all=true scans all players instead, limit at a time, and returns the cursor to continue from until
+// the scan is done.
+func MigratePlayers(
+	w go_http.ResponseWriter,
+	r *go_http.Request,
+	datastoreClient *google_datastore.Client,
+) {
+	ctx := context.Background()
+	w.Header().Set("Cache-Control", cache.CacheControlPrivate)
+
+	limit := defaultMigratePlayersLimit
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		var err error
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit <= 0 || limit > maxMigratePlayersLimit {
+			w.WriteHeader(go_http.StatusBadRequest)
+			fmt.Fprintf(w, "limit must be a number between 1 and %v", maxMigratePlayersLimit)
+			return
+		}
+	}
+
+	scanAll := r.URL.Query().Get("all") == "true"
+	query := google_datastore.NewQuery("player").KeysOnly().Limit(limit)
+	if scanAll {
+		if cursorParam := r.URL.Query().Get("cursor"); cursorParam != "" {
+			cursor, err := google_datastore.DecodeCursor(cursorParam)
+			if err != nil {
+				w.WriteHeader(go_http.StatusBadRequest)
+				fmt.Fprintf(w, "invalid cursor: %v", err)
+				return
+			}
+			query = query.Start(cursor)
+		}
+	} else {
+		query = query.FilterField("Version", "<", datastore.PlayerVersion)
+	}
+
+	keys := []*google_datastore.Key{}
+	responseIter := datastoreClient.Run(ctx, query)
+	for {
+		key, err := responseIter.Next(nil)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			w.WriteHeader(go_http.StatusInternalServerError)
+			fmt.Fprintf(w, "datastore player query failed: %v", err)
+			return
+		}
+		keys = append(keys, key)
+	}
+	nextCursor, err := responseIter.Cursor()
+	if err != nil {
+		w.WriteHeader(go_http.StatusInternalServerError)
+		fmt.Fprintf(w, "datastore player query cursor failed: %v", err)
+		return
+	}
+
+	for i, key := range keys {
+		err = datastore.MigratePlayer(ctx, datastoreClient, key.ID)
+		if err != nil {
+			w.WriteHeader(go_http.StatusInternalServerError)
+			fmt.Fprintf(w, "migrated %v players before failing: %v", i, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	if !scanAll {
+		fmt.Fprintf(w, "Migrated %v players.\n", len(keys))
+	} else if len(keys) == limit {
+		fmt.Fprintf(w, "Scanned %v players, continue with cursor=%v\n", len(keys), url.QueryEscape(nextCursor.String()))
+	} else {
+		fmt.Fprintf(w, "Scanned %v players, no players are left.\n", len(keys))
+	}
+}
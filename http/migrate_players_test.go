@@ -0,0 +1,18 @@
+package http
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/FabianHahn/raidlogscan/datastore"
+)
+
+func TestMigratePlayers(t *testing.T) {
+	req := httptest.NewRequest("GET", "/?limit=1", nil)
+
+	rr := httptest.NewRecorder()
+	datastoreClient := datastore.CreateDatastoreClientOrDie()
+	MigratePlayers(rr, req, datastoreClient)
+
+	t.Log(rr.Body.String())
+}
@@ -4,8 +4,13 @@ import (
 	"context"
 	"fmt"
 	go_http "net/http"
+	"time"
 
+	google_datastore "cloud.google.com/go/datastore"
+	"github.com/FabianHahn/raidlogscan/cache"
+	"github.com/FabianHahn/raidlogscan/datastore"
 	"github.com/FabianHahn/raidlogscan/graphql"
+	"github.com/FabianHahn/raidlogscan/oauth2"
 	go_oauth2 "golang.org/x/oauth2"
 )
 
@@ -13,8 +18,12 @@ func Oauth2Callback(
 	w go_http.ResponseWriter,
 	r *go_http.Request,
 	userConfig *go_oauth2.Config,
+	datastoreClient *google_datastore.Client,
 	scanUserReportsUrl string,
 	scanRecentCharacterReportsUrl string,
+	claimUserCharactersUrl string,
+	guildRosterUrl string,
+	webhooksUrl string,
 ) {
 	ctx := context.Background()
 
@@ -39,7 +48,45 @@ func Oauth2Callback(
 		return
 	}
 
+	// Remember which characters belong to this user, so that they can be suggested as alts of each other.
+	user := datastore.User{
+		Name:      userData.Name,
+		UpdatedAt: time.Now(),
+	}
+	for _, character := range userData.Characters {
+		user.CharacterKeys = append(user.CharacterKeys, datastore.UserCharacterKey(character.Name, character.Server))
+		user.Characters = append(user.Characters, datastore.UserCharacter{
+			Id:     character.Id,
+			Name:   character.Name,
+			Server: character.Server,
+		})
+	}
+	officerGuilds := []graphql.UserDataGuild{}
+	for _, guild := range userData.Guilds {
+		if isOfficerRank(guild.Rank) {
+			officerGuilds = append(officerGuilds, guild)
+			user.OfficerGuildIds = append(user.OfficerGuildIds, guild.Id)
+		}
+	}
+	userKey := google_datastore.IDKey("user", int64(userData.Id), nil)
+	_, err = datastoreClient.Put(ctx, userKey, &user)
+	if err != nil {
+		w.WriteHeader(go_http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to store user data: %v", err.Error())
+		return
+	}
+
+	// The session token is a bearer credential, so it is only ever posted in form bodies and never put into URLs, where
+	// it would end up in access logs, browser history and referrers.
+	sessionToken, err := oauth2.CreateSessionToken(userData.Id)
+	if err != nil {
+		w.WriteHeader(go_http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to create session: %v", err.Error())
+		return
+	}
+
 	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	w.Header().Set("Cache-Control", cache.CacheControlPrivate)
 	fmt.Fprintf(w, `<html>
 <head>
 <title>Warcraft Logs Account: %v - WoW Raid Stats</title>
@@ -75,7 +122,11 @@ div {
 	fmt.Fprintf(w, "<div>")
 	fmt.Fprintf(w, "<h1>Warcraft Logs Account</h1>\n")
 	fmt.Fprintf(w, "<b>Account Name</b>: %v<br>\n", userData.Name)
-	fmt.Fprintf(w, "<a href=\"%v?user_id=%v\">Scan personal logs</a>\n", scanUserReportsUrl, userData.Id)
+	fmt.Fprintf(w, "<a href=\"%v?user_id=%v\">Scan personal logs</a><br>\n", scanUserReportsUrl, userData.Id)
+	fmt.Fprintf(w, "<form action=\"%v\" method=\"post\">\n", webhooksUrl)
+	fmt.Fprintf(w, "<input type=\"hidden\" name=\"session\" value=\"%v\">\n", sessionToken)
+	fmt.Fprintf(w, "<input type=\"submit\" value=\"Manage webhooks\">\n")
+	fmt.Fprintf(w, "</form>\n")
 	fmt.Fprintf(w, "</div>")
 
 	fmt.Fprintf(w, "<div class=\"column\">")
@@ -86,7 +137,35 @@ div {
 			character.Name, character.Server, scanRecentCharacterReportsUrl, character.Id)
 	}
 	fmt.Fprintf(w, "</table>\n")
+	fmt.Fprintf(w, "<br>\n")
+	fmt.Fprintf(w, "<form action=\"%v\" method=\"post\">\n", claimUserCharactersUrl)
+	fmt.Fprintf(w, "<input type=\"hidden\" id=\"session\" name=\"session\" value=\"%v\">\n", sessionToken)
+	fmt.Fprintf(w, "<label for=\"account_name\"><b>Assign all characters to account name:</b></label><br>\n")
+	fmt.Fprintf(w, "<input type=\"text\" id=\"account_name\" name=\"account_name\">&nbsp;\n")
+	fmt.Fprintf(w, "<input type=\"submit\" value=\"Assign all\">\n")
+	fmt.Fprintf(w, "</form>\n")
 	fmt.Fprintf(w, "</div>")
 
+	if len(officerGuilds) > 0 {
+		fmt.Fprintf(w, "<div class=\"column\">")
+		fmt.Fprintf(w, "<h2>Officer Guilds</h2>\n")
+		fmt.Fprintf(w, "<table><tr><th>Name</th><th>Server</th><th>Rank</th><th>Roster</th></tr>\n")
+		for _, guild := range officerGuilds {
+			fmt.Fprintf(w, "<tr><td>%v</td><td>%v</td><td>%v</td><td>", guild.Name, guild.Server, guild.Rank)
+			fmt.Fprintf(w, "<form action=\"%v\" method=\"post\">", guildRosterUrl)
+			fmt.Fprintf(w, "<input type=\"hidden\" name=\"guild_id\" value=\"%v\">", guild.Id)
+			fmt.Fprintf(w, "<input type=\"hidden\" name=\"session\" value=\"%v\">", sessionToken)
+			fmt.Fprintf(w, "<input type=\"submit\" value=\"Manage roster\">")
+			fmt.Fprintf(w, "</form></td></tr>\n")
+		}
+		fmt.Fprintf(w, "</table>\n")
+		fmt.Fprintf(w, "</div>")
+	}
+
 	fmt.Fprintf(w, "</body></html>\n")
 }
+
+// isOfficerRank returns whether a Warcraft Logs guild rank is allowed to manage the guild's roster.
+func isOfficerRank(rank string) bool {
+	return rank == "Officer" || rank == "GuildMaster"
+}
@@ -3,11 +3,15 @@ package http
 import (
 	"context"
 	"fmt"
+	"io"
 	go_http "net/http"
 	"sort"
 	"strconv"
+	"time"
 
 	google_datastore "cloud.google.com/go/datastore"
+	"github.com/FabianHahn/raidlogscan/aggregate"
+	"github.com/FabianHahn/raidlogscan/cache"
 	"github.com/FabianHahn/raidlogscan/datastore"
 	"github.com/FabianHahn/raidlogscan/html"
 )
@@ -17,9 +21,16 @@ func PlayerStats(
 	r *go_http.Request,
 	htmlRenderer *html.Renderer,
 	datastoreClient *google_datastore.Client,
+	pageCache *cache.PageCache,
+	playerStatsUrl string,
 	accountStatsUrl string,
 	guildStatsUrl string,
+	reportStatsUrl string,
 	claimAccountUrl string,
+	raidNetworkUrl string,
+	reportFeedUrl string,
+	scanReportsUrl string,
+	searchUrl string,
 	oauth2LoginUrl string,
 ) {
 	ctx := context.Background()
@@ -30,6 +41,13 @@ func PlayerStats(
 		return
 	}
 
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	statsPage := cache.PlayerStatsPage(playerId)
+	if statsPage.OutputCached(w, r, pageCache, ctx) {
+		return
+	}
+	creationTime := time.Now()
+
 	playerKey := google_datastore.IDKey("player", playerId, nil)
 	var player datastore.Player
 	err = datastoreClient.Get(ctx, playerKey, &player)
@@ -43,6 +61,70 @@ func PlayerStats(
 		return
 	}
 
+	err = datastore.LoadPlayerHistory(ctx, datastoreClient, playerKey, &player)
+	if err != nil {
+		w.WriteHeader(go_http.StatusInternalServerError)
+		fmt.Fprintf(w, "Datastore query failed: %v", err)
+		return
+	}
+
+	leaderboard := playerLeaderboard(playerId, player)
+
+	now := time.Now()
+	altSuggestions := []html.AltSuggestion{}
+	if player.Account != "" {
+		account, err := aggregate.LoadAccount(ctx, datastoreClient, player.Account)
+		if err != nil {
+			w.WriteHeader(go_http.StatusInternalServerError)
+			fmt.Fprintf(w, "failed to load account %v: %v", player.Account, err)
+			return
+		}
+
+		recentRaids, err := aggregate.QueryAccountRaids(
+			ctx,
+			datastoreClient,
+			account,
+			now.AddDate(0, 0, -maxRoleDistributionDays))
+		if err != nil {
+			w.WriteHeader(go_http.StatusInternalServerError)
+			fmt.Fprintf(w, "failed to load recent raids of account %v: %v", player.Account, err)
+			return
+		}
+
+		altSuggestions, err = findAltSuggestions(ctx, datastoreClient, account, recentRaids)
+		if err != nil {
+			w.WriteHeader(go_http.StatusInternalServerError)
+			fmt.Fprintf(w, "failed to find alt suggestions: %v", err)
+			return
+		}
+	}
+
+	raids := aggregate.PlayerRaids(playerId, player)
+	roleDistributions := computeRoleDistributions(raids, aggregate.CountRaidRoles(raids), now)
+
+	statsPage.CacheAndOutput(w, r, pageCache, ctx, creationTime, func(wr io.Writer) error {
+		return htmlRenderer.RenderPlayerStats(
+			wr,
+			playerId,
+			player,
+			leaderboard,
+			altSuggestions,
+			roleDistributions,
+			playerStatsUrl,
+			accountStatsUrl,
+			guildStatsUrl,
+			reportStatsUrl,
+			claimAccountUrl,
+			raidNetworkUrl,
+			reportFeedUrl,
+			scanReportsUrl,
+			searchUrl,
+			oauth2LoginUrl)
+	})
+}
+
+// playerLeaderboard ranks the coraiders of a player, merging characters claimed by the same account.
+func playerLeaderboard(playerId int64, player datastore.Player) []html.LeaderboardEntry {
 	coraiders := map[int64]datastore.PlayerCoraider{}
 	for _, playerCoraider := range player.Coraiders {
 		if entry, ok := coraiders[playerCoraider.Id]; ok {
@@ -59,14 +141,14 @@ func PlayerStats(
 	}
 
 	accountCounts := map[string]int64{}
-	for playerId, playerAccountName := range coaccounts {
-		if coraider, coraiderExists := coraiders[playerId]; coraiderExists {
+	for coraiderId, playerAccountName := range coaccounts {
+		if coraider, coraiderExists := coraiders[coraiderId]; coraiderExists {
 			if _, ok := accountCounts[playerAccountName]; !ok {
 				accountCounts[playerAccountName] = 0
 			}
 
 			accountCounts[playerAccountName] += coraider.Count
-			delete(coraiders, playerId)
+			delete(coraiders, coraiderId)
 		}
 	}
 
@@ -102,19 +184,5 @@ func PlayerStats(
 	sort.SliceStable(leaderboard, func(i int, j int) bool {
 		return leaderboard[i].Count > leaderboard[j].Count
 	})
-
-	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
-	err = htmlRenderer.RenderPlayerStats(
-		w,
-		playerId,
-		player,
-		leaderboard,
-		accountStatsUrl,
-		guildStatsUrl,
-		claimAccountUrl,
-		oauth2LoginUrl)
-	if err != nil {
-		fmt.Fprintf(w, "failed to render template: %v", err)
-		return
-	}
+	return leaderboard
 }
@@ -5,6 +5,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/FabianHahn/raidlogscan/cache"
 	"github.com/FabianHahn/raidlogscan/datastore"
 	"github.com/FabianHahn/raidlogscan/html"
 )
@@ -21,18 +22,32 @@ func TestPlayerStats(t *testing.T) {
 	rr := httptest.NewRecorder()
 	htmlRenderer := html.CreateRendererOrDie()
 	datastoreClient := datastore.CreateDatastoreClientOrDie()
+	pageCache := cache.CreatePageCache(datastoreClient, "")
+	playerStatsUrl := "http://example.com/playerstats"
 	accountStatsUrl := "http://example.com/accountstats"
 	guildStatsUrl := "http://example.com/guildstats"
+	reportStatsUrl := "http://example.com/reportstats"
 	claimAccountUrl := "http://example.com/claimaccount"
+	raidNetworkUrl := "http://example.com/raidnetwork"
+	reportFeedUrl := "http://example.com/reportfeed"
+	scanReportsUrl := "http://example.com/scanreports"
+	searchUrl := "http://example.com/search"
 	oauth2LoginUrl := "http://example.com/oauth2login"
 	PlayerStats(
 		rr,
 		req,
 		htmlRenderer,
 		datastoreClient,
+		pageCache,
+		playerStatsUrl,
 		accountStatsUrl,
 		guildStatsUrl,
+		reportStatsUrl,
 		claimAccountUrl,
+		raidNetworkUrl,
+		reportFeedUrl,
+		scanReportsUrl,
+		searchUrl,
 		oauth2LoginUrl,
 	)
 
@@ -0,0 +1,59 @@
+package http
+
+import (
+	"context"
+	"fmt"
+
+	google_datastore "cloud.google.com/go/datastore"
+	"github.com/FabianHahn/raidlogscan/datastore"
+)
+
+const (
+	maxDatastoreGetMultiKeys = 1000
+)
+
+// loadPlayers fetches the player entities for the given IDs including their history, silently skipping IDs that don't
+// exist.
+func loadPlayers(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	playerIds []int64,
+) (map[int64]datastore.Player, error) {
+	players := map[int64]datastore.Player{}
+	for start := 0; start < len(playerIds); start += maxDatastoreGetMultiKeys {
+		end := start + maxDatastoreGetMultiKeys
+		if end > len(playerIds) {
+			end = len(playerIds)
+		}
+
+		keys := []*google_datastore.Key{}
+		for _, playerId := range playerIds[start:end] {
+			keys = append(keys, google_datastore.IDKey("player", playerId, nil))
+		}
+
+		chunk := make([]datastore.Player, len(keys))
+		err := datastoreClient.GetMulti(ctx, keys, chunk)
+		if multiErr, ok := err.(google_datastore.MultiError); ok {
+			for i, keyErr := range multiErr {
+				if keyErr == nil {
+					players[keys[i].ID] = chunk[i]
+				} else if keyErr != google_datastore.ErrNoSuchEntity {
+					return nil, fmt.Errorf("datastore get player %v failed: %v", keys[i].ID, keyErr)
+				}
+			}
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("datastore get players failed: %v", err)
+		}
+
+		for i := range keys {
+			players[keys[i].ID] = chunk[i]
+		}
+	}
+
+	err := datastore.LoadPlayersHistory(ctx, datastoreClient, players)
+	if err != nil {
+		return nil, err
+	}
+	return players, nil
+}
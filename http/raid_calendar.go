@@ -0,0 +1,264 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	go_http "net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	google_datastore "cloud.google.com/go/datastore"
+	"github.com/FabianHahn/raidlogscan/aggregate"
+	"github.com/FabianHahn/raidlogscan/cache"
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"github.com/FabianHahn/raidlogscan/feed"
+)
+
+const (
+	raidScheduleWeeks    = 8
+	raidScheduleMinShare = 0.5
+	raidScheduleMinWeeks = 2
+	raidScheduleWeek     = 7 * 24 * time.Hour
+	// raidCalendarWindow bounds how far back the raids of an account are listed. Guild calendars list the raids kept in
+	// the guild aggregate instead.
+	raidCalendarWindow = 365 * 24 * time.Hour
+)
+
+type calendarRaid struct {
+	Code      string
+	Title     string
+	Zone      string
+	GuildName string
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+type raidScheduleSlot struct {
+	Weekday time.Weekday
+	Hour    int
+}
+
+// RaidCalendar serves the raids of a guild or an account as an iCalendar feed. Besides the past raids, the feed
+// contains weekly recurring events for the usual raid times inferred from the last weeks of raids.
+func RaidCalendar(
+	w go_http.ResponseWriter,
+	r *go_http.Request,
+	datastoreClient *google_datastore.Client,
+	reportStatsUrl string,
+) {
+	ctx := context.Background()
+
+	var name string
+	var calendarId string
+	var raids []calendarRaid
+	var err error
+	accountName := r.URL.Query().Get("account_name")
+	guildIdParam := r.URL.Query().Get("guild_id")
+	if accountName != "" {
+		name = fmt.Sprintf("#%v", accountName)
+		calendarId = fmt.Sprintf("account-%v", accountName)
+		raids, err = queryAccountCalendarRaids(ctx, datastoreClient, accountName)
+	} else if guildIdParam != "" {
+		guildId, parseErr := strconv.ParseInt(guildIdParam, 10, 32)
+		if parseErr != nil {
+			w.WriteHeader(go_http.StatusBadRequest)
+			fmt.Fprintf(w, "Guild ID conversion failed: %v", parseErr)
+			return
+		}
+		calendarId = fmt.Sprintf("guild-%v", guildId)
+		name, raids, err = queryGuildCalendarRaids(ctx, datastoreClient, int32(guildId))
+	} else {
+		w.WriteHeader(go_http.StatusBadRequest)
+		fmt.Fprintf(w, "No account_name or guild_id specified")
+		return
+	}
+	if err != nil {
+		w.WriteHeader(go_http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to load raids: %v", err)
+		return
+	}
+
+	calendar := feed.Calendar{
+		Name: fmt.Sprintf("%v raids - WoW Raid Stats", name),
+	}
+	schedule := inferRaidSchedule(calendarId, raids)
+	if len(schedule) > 0 {
+		times := []string{}
+		for _, event := range schedule {
+			times = append(times, event.Start.UTC().Format("Monday 15:04 UTC"))
+		}
+		calendar.Description = fmt.Sprintf("Usual raid times: %v", strings.Join(times, ", "))
+	}
+	calendar.Events = append(calendar.Events, schedule...)
+	for _, raid := range raids {
+		description := fmt.Sprintf("https://classic.warcraftlogs.com/reports/%v", raid.Code)
+		if raid.GuildName != "" {
+			description = fmt.Sprintf("%v\n%v", raid.GuildName, description)
+		}
+		calendar.Events = append(calendar.Events, feed.CalendarEvent{
+			Uid:         fmt.Sprintf("%v@raidlogscan", raid.Code),
+			Summary:     raid.Title,
+			Description: description,
+			Location:    raid.Zone,
+			Url:         fmt.Sprintf("%v?code=%v", reportStatsUrl, raid.Code),
+			Start:       raid.StartTime,
+			End:         raid.EndTime,
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=UTF-8")
+	w.Header().Set("Content-Disposition", "inline; filename=\"raids.ics\"")
+	w.Header().Set("Cache-Control", cache.CacheControlFeed)
+	err = feed.WriteCalendar(w, calendar)
+	if err != nil {
+		fmt.Fprintf(w, "failed to write calendar: %v", err)
+		return
+	}
+}
+
+// queryGuildCalendarRaids lists the most recent raids of a guild from its aggregate.
+func queryGuildCalendarRaids(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	guildId int32,
+) (string, []calendarRaid, error) {
+	guildAggregate, err := aggregate.LoadGuildAggregate(ctx, datastoreClient, guildId)
+	if err != nil {
+		return "", nil, err
+	}
+
+	raids := []calendarRaid{}
+	for _, raid := range guildAggregate.Raids {
+		raids = append(raids, calendarRaid{
+			Code:      raid.Code,
+			Title:     raid.Title,
+			Zone:      raid.Zone,
+			StartTime: raid.StartTime,
+			EndTime:   raid.EndTime,
+		})
+	}
+
+	guildName := guildAggregate.GuildName
+	if guildName == "" {
+		guildName = fmt.Sprintf("Guild %v", guildId)
+	}
+	return guildName, raids, nil
+}
+
+// queryAccountCalendarRaids collects the raids of all characters of an account within the calendar window, leaving out
+// reports that overlap with another report of the same character.
+func queryAccountCalendarRaids(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	accountName string,
+) ([]calendarRaid, error) {
+	players := []datastore.Player{}
+	playerKeys, err := datastoreClient.GetAll(ctx, google_datastore.NewQuery("player").
+		FilterField("Account", "=", accountName), &players)
+	if err != nil {
+		return nil, fmt.Errorf("datastore account players query failed: %v", err)
+	}
+
+	since := time.Now().Add(-raidCalendarWindow)
+	codes := map[string]struct{}{}
+	raids := []calendarRaid{}
+	for i, player := range players {
+		playerReports, err := datastore.LoadPlayerReportsSince(ctx, datastoreClient, playerKeys[i], player, since)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, report := range playerReports {
+			if report.Duplicate {
+				continue
+			}
+			if _, ok := codes[report.Code]; ok {
+				continue
+			}
+			codes[report.Code] = struct{}{}
+
+			raids = append(raids, calendarRaid{
+				Code:      report.Code,
+				Title:     report.Title,
+				Zone:      report.Zone,
+				GuildName: report.GuildName,
+				StartTime: report.StartTime,
+				EndTime:   report.EndTime,
+			})
+		}
+	}
+	sort.SliceStable(raids, func(i int, j int) bool {
+		return raids[i].StartTime.After(raids[j].StartTime)
+	})
+	return raids, nil
+}
+
+// inferRaidSchedule finds the weekday and hour slots in UTC that were raided in at least half of the weeks leading up
+// to the latest raid, and returns them as weekly recurring events starting one week after the latest raid in each
+// slot. The duration of each event is the median duration of the raids in its slot.
+func inferRaidSchedule(calendarId string, raids []calendarRaid) []feed.CalendarEvent {
+	if len(raids) == 0 {
+		return []feed.CalendarEvent{}
+	}
+
+	latest := raids[0].StartTime
+	for _, raid := range raids {
+		if raid.StartTime.After(latest) {
+			latest = raid.StartTime
+		}
+	}
+
+	slotWeeks := map[raidScheduleSlot]map[int]struct{}{}
+	slotDurations := map[raidScheduleSlot][]time.Duration{}
+	slotLatest := map[raidScheduleSlot]time.Time{}
+	numWeeks := 0
+	for _, raid := range raids {
+		weekIndex := int(latest.Sub(raid.StartTime) / raidScheduleWeek)
+		if weekIndex >= raidScheduleWeeks {
+			continue
+		}
+		if weekIndex+1 > numWeeks {
+			numWeeks = weekIndex + 1
+		}
+
+		startTime := raid.StartTime.UTC()
+		slot := raidScheduleSlot{Weekday: startTime.Weekday(), Hour: startTime.Hour()}
+		if _, ok := slotWeeks[slot]; !ok {
+			slotWeeks[slot] = map[int]struct{}{}
+		}
+		slotWeeks[slot][weekIndex] = struct{}{}
+		slotDurations[slot] = append(slotDurations[slot], raid.EndTime.Sub(raid.StartTime))
+		if startTime.After(slotLatest[slot]) {
+			slotLatest[slot] = startTime
+		}
+	}
+
+	schedule := []feed.CalendarEvent{}
+	for slot, weeks := range slotWeeks {
+		if len(weeks) < raidScheduleMinWeeks || float64(len(weeks)) < raidScheduleMinShare*float64(numWeeks) {
+			continue
+		}
+
+		durations := slotDurations[slot]
+		sort.Slice(durations, func(i int, j int) bool {
+			return durations[i] < durations[j]
+		})
+		start := slotLatest[slot].Add(raidScheduleWeek)
+		schedule = append(schedule, feed.CalendarEvent{
+			Uid:     fmt.Sprintf("schedule-%v-%v-%v@raidlogscan", calendarId, slot.Weekday, slot.Hour),
+			Summary: "Usual raid time",
+			Start:   start,
+			End:     start.Add(durations[len(durations)/2]),
+			Weekly:  true,
+		})
+	}
+	sort.SliceStable(schedule, func(i int, j int) bool {
+		if schedule[i].Start.Weekday() != schedule[j].Start.Weekday() {
+			return schedule[i].Start.Weekday() < schedule[j].Start.Weekday()
+		}
+		return schedule[i].Start.Hour() < schedule[j].Start.Hour()
+	})
+	return schedule
+}
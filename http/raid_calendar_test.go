@@ -0,0 +1,24 @@
+package http
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/FabianHahn/raidlogscan/datastore"
+)
+
+const (
+	testRaidCalendarGuildId = "687460"
+)
+
+func TestRaidCalendar(t *testing.T) {
+	req := httptest.NewRequest("GET", fmt.Sprintf("/?guild_id=%v", testRaidCalendarGuildId), nil)
+
+	rr := httptest.NewRecorder()
+	datastoreClient := datastore.CreateDatastoreClientOrDie()
+	reportStatsUrl := "http://example.com/reportstats"
+	RaidCalendar(rr, req, datastoreClient, reportStatsUrl)
+
+	t.Log(rr.Body.String())
+}
@@ -0,0 +1,61 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	go_http "net/http"
+
+	google_datastore "cloud.google.com/go/datastore"
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"github.com/FabianHahn/raidlogscan/html"
+)
+
+const (
+	maxListedRaidGroups = 100
+)
+
+func RaidGroups(
+	w go_http.ResponseWriter,
+	r *go_http.Request,
+	htmlRenderer *html.Renderer,
+	datastoreClient *google_datastore.Client,
+	accountStatsUrl string,
+	playerStatsUrl string,
+	guildStatsUrl string,
+	scanReportsUrl string,
+	searchUrl string,
+	oauth2LoginUrl string,
+) {
+	ctx := context.Background()
+
+	accountName := r.URL.Query().Get("account_name")
+	query := google_datastore.NewQuery("raid_group")
+	if accountName != "" {
+		query = query.FilterField("MemberAccounts", "=", accountName)
+	}
+	query = query.Order("-NumRaids").Limit(maxListedRaidGroups)
+
+	raidGroups := []datastore.RaidGroup{}
+	_, err := datastoreClient.GetAll(ctx, query, &raidGroups)
+	if err != nil {
+		w.WriteHeader(go_http.StatusInternalServerError)
+		fmt.Fprintf(w, "Datastore query failed: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	err = htmlRenderer.RenderRaidGroups(
+		w,
+		accountName,
+		raidGroups,
+		accountStatsUrl,
+		playerStatsUrl,
+		guildStatsUrl,
+		scanReportsUrl,
+		searchUrl,
+		oauth2LoginUrl)
+	if err != nil {
+		fmt.Fprintf(w, "failed to render template: %v", err)
+		return
+	}
+}
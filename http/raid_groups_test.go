@@ -0,0 +1,32 @@
+package http
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"github.com/FabianHahn/raidlogscan/html"
+)
+
+const (
+	testRaidGroupsAccountName = "Jaythe"
+)
+
+func TestRaidGroups(t *testing.T) {
+	req := httptest.NewRequest("GET", fmt.Sprintf("/?account_name=%v", testRaidGroupsAccountName), nil)
+	req.Header.Add("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	htmlRenderer := html.CreateRendererOrDie()
+	datastoreClient := datastore.CreateDatastoreClientOrDie()
+	accountStatsUrl := "http://example.com/accountstats"
+	playerStatsUrl := "http://example.com/playerstats"
+	guildStatsUrl := "http://example.com/guildstats"
+	scanReportsUrl := "http://example.com/scanreports"
+	searchUrl := "http://example.com/search"
+	oauth2LoginUrl := "http://example.com/oauth2login"
+	RaidGroups(rr, req, htmlRenderer, datastoreClient, accountStatsUrl, playerStatsUrl, guildStatsUrl, scanReportsUrl, searchUrl, oauth2LoginUrl)
+
+	t.Log(rr.Body.String())
+}
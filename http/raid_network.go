@@ -0,0 +1,295 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	go_http "net/http"
+	"sort"
+	"strconv"
+
+	google_datastore "cloud.google.com/go/datastore"
+	"github.com/FabianHahn/raidlogscan/aggregate"
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"github.com/FabianHahn/raidlogscan/html"
+	"github.com/FabianHahn/raidlogscan/network"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	defaultNetworkDepth     = 1
+	maxNetworkDepth         = 2
+	defaultNetworkMinWeight = 1
+	maxNetworkLoadedPlayers = 500
+)
+
+type playerPair struct {
+	first  int64
+	second int64
+}
+
+func RaidNetwork(
+	w go_http.ResponseWriter,
+	r *go_http.Request,
+	htmlRenderer *html.Renderer,
+	datastoreClient *google_datastore.Client,
+	accountStatsUrl string,
+	playerStatsUrl string,
+	scanReportsUrl string,
+	searchUrl string,
+	oauth2LoginUrl string,
+) {
+	ctx := context.Background()
+
+	depth := defaultNetworkDepth
+	if depthParam := r.URL.Query().Get("depth"); depthParam != "" {
+		var err error
+		depth, err = strconv.Atoi(depthParam)
+		if err != nil || depth < 1 || depth > maxNetworkDepth {
+			w.WriteHeader(go_http.StatusBadRequest)
+			fmt.Fprintf(w, "depth must be between 1 and %v", maxNetworkDepth)
+			return
+		}
+	}
+
+	minWeight := int64(defaultNetworkMinWeight)
+	if minWeightParam := r.URL.Query().Get("min_weight"); minWeightParam != "" {
+		var err error
+		minWeight, err = strconv.ParseInt(minWeightParam, 10, 64)
+		if err != nil || minWeight < 1 {
+			w.WriteHeader(go_http.StatusBadRequest)
+			fmt.Fprintf(w, "min_weight must be a positive number")
+			return
+		}
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "html"
+	}
+	if format != "html" && format != "json" && format != "graphml" && format != "gexf" {
+		w.WriteHeader(go_http.StatusBadRequest)
+		fmt.Fprintf(w, "unknown format %v, expected one of html, json, graphml, gexf", format)
+		return
+	}
+
+	title := ""
+	rootAccount := ""
+	rootPlayerIds := []int64{}
+	accountName := r.URL.Query().Get("account_name")
+	playerIdParam := r.URL.Query().Get("player_id")
+	guildIdParam := r.URL.Query().Get("guild_id")
+	if accountName != "" {
+		title = fmt.Sprintf("#%v", accountName)
+		rootAccount = accountName
+		players, err := aggregate.QueryAccountPlayers(ctx, datastoreClient, accountName)
+		if err != nil {
+			w.WriteHeader(go_http.StatusInternalServerError)
+			fmt.Fprintf(w, "failed to load players of account %v: %v", accountName, err)
+			return
+		}
+		for playerId := range players {
+			rootPlayerIds = append(rootPlayerIds, playerId)
+		}
+	} else if playerIdParam != "" {
+		playerId, err := strconv.ParseInt(playerIdParam, 10, 64)
+		if err != nil {
+			w.WriteHeader(go_http.StatusBadRequest)
+			fmt.Fprintf(w, "player ID conversion failed: %v", err.Error())
+			return
+		}
+		title = fmt.Sprintf("Player %v", playerId)
+		rootPlayerIds = append(rootPlayerIds, playerId)
+	} else if guildIdParam != "" {
+		guildId64, err := strconv.ParseInt(guildIdParam, 10, 32)
+		if err != nil {
+			w.WriteHeader(go_http.StatusBadRequest)
+			fmt.Fprintf(w, "guild ID conversion failed: %v", err.Error())
+			return
+		}
+		guildName, guildPlayerIds, err := queryGuildPlayerIds(ctx, datastoreClient, int32(guildId64))
+		if err != nil {
+			w.WriteHeader(go_http.StatusInternalServerError)
+			fmt.Fprintf(w, "failed to load players of guild %v: %v", guildId64, err)
+			return
+		}
+		title = guildName
+		rootPlayerIds = guildPlayerIds
+	} else {
+		w.WriteHeader(go_http.StatusBadRequest)
+		fmt.Fprintf(w, "No account_name, player_id or guild_id specified")
+		return
+	}
+
+	if len(rootPlayerIds) == 0 {
+		w.WriteHeader(go_http.StatusNotFound)
+		fmt.Fprintf(w, "No known players for the requested network")
+		return
+	}
+
+	// Load players breadth first, starting from the roots. Players at the last level of depth are only known
+	// through the coraider lists of the players loaded before them.
+	loaded := map[int64]datastore.Player{}
+	frontier := rootPlayerIds
+	for level := 0; level < depth && len(frontier) > 0; level++ {
+		if len(loaded)+len(frontier) > maxNetworkLoadedPlayers {
+			frontier = frontier[:maxNetworkLoadedPlayers-len(loaded)]
+		}
+
+		players, err := loadPlayers(ctx, datastoreClient, frontier)
+		if err != nil {
+			w.WriteHeader(go_http.StatusInternalServerError)
+			fmt.Fprintf(w, "failed to load players: %v", err)
+			return
+		}
+
+		nextCounts := map[int64]int64{}
+		for playerId, player := range players {
+			loaded[playerId] = player
+			for _, coraider := range player.Coraiders {
+				if _, ok := loaded[coraider.Id]; !ok && coraider.Count >= minWeight {
+					nextCounts[coraider.Id] += coraider.Count
+				}
+			}
+		}
+
+		// Expand the strongest connections first in case we hit the limit of loaded players.
+		frontier = []int64{}
+		for playerId := range nextCounts {
+			if _, ok := loaded[playerId]; !ok {
+				frontier = append(frontier, playerId)
+			}
+		}
+		sort.SliceStable(frontier, func(i int, j int) bool {
+			return nextCounts[frontier[i]] > nextCounts[frontier[j]]
+		})
+	}
+
+	if player, ok := loaded[rootPlayerIds[0]]; ok && playerIdParam != "" && accountName == "" {
+		title = fmt.Sprintf("%v-%v (%v)", player.Name, player.Server, player.Class)
+	}
+
+	playerAccounts := map[int64]string{}
+	coraiderDetails := map[int64]datastore.PlayerCoraider{}
+	pairCounts := map[playerPair]int64{}
+	for playerId, player := range loaded {
+		for _, coraiderAccount := range player.CoraiderAccounts {
+			playerAccounts[coraiderAccount.PlayerId] = coraiderAccount.Name
+		}
+		for _, coraider := range player.Coraiders {
+			if coraider.Id == playerId {
+				continue
+			}
+			coraiderDetails[coraider.Id] = coraider
+
+			// Both sides of a pair store the same count if they are both loaded, so don't add them up.
+			pair := playerPair{first: playerId, second: coraider.Id}
+			if coraider.Id < playerId {
+				pair = playerPair{first: coraider.Id, second: playerId}
+			}
+			if coraider.Count > pairCounts[pair] {
+				pairCounts[pair] = coraider.Count
+			}
+		}
+	}
+	for playerId, player := range loaded {
+		if player.Account != "" {
+			playerAccounts[playerId] = player.Account
+		} else {
+			delete(playerAccounts, playerId)
+		}
+	}
+
+	roots := map[int64]struct{}{}
+	for _, playerId := range rootPlayerIds {
+		roots[playerId] = struct{}{}
+	}
+
+	builder := network.CreateBuilder()
+	addNode := func(playerId int64) string {
+		_, isRoot := roots[playerId]
+		if account, ok := playerAccounts[playerId]; ok {
+			return builder.AddAccountNode(account, isRoot || account == rootAccount)
+		}
+		if player, ok := loaded[playerId]; ok {
+			return builder.AddPlayerNode(playerId, player.Name, player.Class, player.Server, isRoot)
+		}
+		coraider := coraiderDetails[playerId]
+		return builder.AddPlayerNode(playerId, coraider.Name, coraider.Class, coraider.Server, isRoot)
+	}
+	for _, playerId := range rootPlayerIds {
+		if _, ok := loaded[playerId]; ok {
+			addNode(playerId)
+		}
+	}
+	for pair, count := range pairCounts {
+		builder.AddEdgeWeight(addNode(pair.first), addNode(pair.second), count)
+	}
+	graph := builder.Build(minWeight)
+
+	var err error
+	switch format {
+	case "json":
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		err = network.WriteJson(w, graph)
+	case "graphml":
+		w.Header().Set("Content-Type", "application/graphml+xml; charset=UTF-8")
+		w.Header().Set("Content-Disposition", "attachment; filename=\"raidnetwork.graphml\"")
+		err = network.WriteGraphml(w, graph)
+	case "gexf":
+		w.Header().Set("Content-Type", "application/gexf+xml; charset=UTF-8")
+		w.Header().Set("Content-Disposition", "attachment; filename=\"raidnetwork.gexf\"")
+		err = network.WriteGexf(w, graph)
+	default:
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		query := r.URL.Query()
+		query.Del("format")
+		err = htmlRenderer.RenderRaidNetwork(
+			w,
+			title,
+			graph,
+			depth,
+			minWeight,
+			query,
+			accountStatsUrl,
+			playerStatsUrl,
+			scanReportsUrl,
+			searchUrl,
+			oauth2LoginUrl)
+	}
+	if err != nil {
+		fmt.Fprintf(w, "failed to write raid network: %v", err)
+		return
+	}
+}
+
+func queryGuildPlayerIds(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	guildId int32,
+) (string, []int64, error) {
+	guildName := ""
+	playerIds := []int64{}
+	seen := map[int64]struct{}{}
+	query := google_datastore.NewQuery("report").FilterField("GuildId", "=", guildId)
+	responseIter := datastoreClient.Run(ctx, query)
+	for {
+		var report datastore.Report
+		_, err := responseIter.Next(&report)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("datastore query failed: %v", err)
+		}
+
+		guildName = report.GuildName
+		for _, player := range report.Players {
+			if _, ok := seen[player.Id]; ok {
+				continue
+			}
+			seen[player.Id] = struct{}{}
+			playerIds = append(playerIds, player.Id)
+		}
+	}
+	return guildName, playerIds, nil
+}
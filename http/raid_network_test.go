@@ -0,0 +1,31 @@
+package http
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"github.com/FabianHahn/raidlogscan/html"
+)
+
+const (
+	testRaidNetworkAccountName = "Jaythe"
+)
+
+func TestRaidNetwork(t *testing.T) {
+	req := httptest.NewRequest("GET", fmt.Sprintf("/?account_name=%v&depth=2&min_weight=3&format=json", testRaidNetworkAccountName), nil)
+	req.Header.Add("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	htmlRenderer := html.CreateRendererOrDie()
+	datastoreClient := datastore.CreateDatastoreClientOrDie()
+	accountStatsUrl := "http://example.com/accountstats"
+	playerStatsUrl := "http://example.com/playerstats"
+	scanReportsUrl := "http://example.com/scanreports"
+	searchUrl := "http://example.com/search"
+	oauth2LoginUrl := "http://example.com/oauth2login"
+	RaidNetwork(rr, req, htmlRenderer, datastoreClient, accountStatsUrl, playerStatsUrl, scanReportsUrl, searchUrl, oauth2LoginUrl)
+
+	t.Log(rr.Body.String())
+}
@@ -0,0 +1,245 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	go_http "net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	google_datastore "cloud.google.com/go/datastore"
+	"github.com/FabianHahn/raidlogscan/cache"
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"github.com/FabianHahn/raidlogscan/feed"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	maxReportFeedEntries = 50
+	reportFeedBatchSize  = 500
+	reportFeedWindow     = 90 * 24 * time.Hour
+)
+
+type feedReport struct {
+	Code   string
+	Report datastore.Report
+}
+
+// ReportFeed serves an Atom feed of the most recently scanned reports of a guild, an account or a player. Entries are
+// ordered by when a report was first scanned rather than when it was raided, so that scanning old logs shows up too.
+func ReportFeed(
+	w go_http.ResponseWriter,
+	r *go_http.Request,
+	datastoreClient *google_datastore.Client,
+	accountStatsUrl string,
+	playerStatsUrl string,
+	guildStatsUrl string,
+	reportStatsUrl string,
+	reportFeedUrl string,
+) {
+	ctx := context.Background()
+	since := time.Now().Add(-reportFeedWindow)
+
+	var atomFeed feed.AtomFeed
+	var reports []feedReport
+	var err error
+	accountName := r.URL.Query().Get("account_name")
+	playerIdParam := r.URL.Query().Get("player_id")
+	guildIdParam := r.URL.Query().Get("guild_id")
+	if accountName != "" {
+		atomFeed.Title = fmt.Sprintf("#%v", accountName)
+		atomFeed.Url = fmt.Sprintf("%v?account_name=%v", accountStatsUrl, url.QueryEscape(accountName))
+
+		players := []datastore.Player{}
+		var playerKeys []*google_datastore.Key
+		playerKeys, err = datastoreClient.GetAll(ctx, google_datastore.NewQuery("player").
+			FilterField("Account", "=", accountName), &players)
+		if err == nil {
+			reports, err = queryPlayerFeedReports(ctx, datastoreClient, playerKeys, players, since)
+		}
+	} else if playerIdParam != "" {
+		playerId, parseErr := strconv.ParseInt(playerIdParam, 10, 64)
+		if parseErr != nil {
+			w.WriteHeader(go_http.StatusBadRequest)
+			fmt.Fprintf(w, "Player ID conversion failed: %v", parseErr)
+			return
+		}
+
+		playerKey := google_datastore.IDKey("player", playerId, nil)
+		var player datastore.Player
+		err = datastoreClient.Get(ctx, playerKey, &player)
+		if err == google_datastore.ErrNoSuchEntity {
+			w.WriteHeader(go_http.StatusNotFound)
+			fmt.Fprintf(w, "No such player: %v", playerId)
+			return
+		}
+		atomFeed.Title = fmt.Sprintf("%v-%v", player.Name, player.Server)
+		atomFeed.Url = fmt.Sprintf("%v?player_id=%v", playerStatsUrl, playerId)
+		if err == nil {
+			reports, err = queryPlayerFeedReports(
+				ctx,
+				datastoreClient,
+				[]*google_datastore.Key{playerKey},
+				[]datastore.Player{player},
+				since)
+		}
+	} else if guildIdParam != "" {
+		guildId, parseErr := strconv.ParseInt(guildIdParam, 10, 32)
+		if parseErr != nil {
+			w.WriteHeader(go_http.StatusBadRequest)
+			fmt.Fprintf(w, "Guild ID conversion failed: %v", parseErr)
+			return
+		}
+
+		atomFeed.Title = fmt.Sprintf("Guild %v", guildId)
+		atomFeed.Url = fmt.Sprintf("%v?guild_id=%v", guildStatsUrl, guildId)
+		reports, err = queryGuildFeedReports(ctx, datastoreClient, int32(guildId))
+		if err == nil && len(reports) > 0 {
+			atomFeed.Title = reports[0].Report.GuildName
+		}
+	} else {
+		w.WriteHeader(go_http.StatusBadRequest)
+		fmt.Fprintf(w, "No account_name, player_id or guild_id specified")
+		return
+	}
+	if err != nil {
+		w.WriteHeader(go_http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to load reports: %v", err)
+		return
+	}
+
+	atomFeed.Id = fmt.Sprintf("%v?%v", reportFeedUrl, r.URL.RawQuery)
+	atomFeed.SelfUrl = atomFeed.Id
+	atomFeed.Title = fmt.Sprintf("%v raids - WoW Raid Stats", atomFeed.Title)
+	atomFeed.Author = "WoW Raid Stats"
+	for _, report := range reports {
+		atomFeed.Entries = append(atomFeed.Entries, feed.AtomEntry{
+			Id:      fmt.Sprintf("%v?code=%v", reportStatsUrl, report.Code),
+			Title:   report.Report.Title,
+			Summary: reportFeedSummary(report.Report),
+			Url:     fmt.Sprintf("%v?code=%v", reportStatsUrl, report.Code),
+			Updated: report.Report.CreatedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=UTF-8")
+	w.Header().Set("Cache-Control", cache.CacheControlFeed)
+	err = feed.WriteAtom(w, atomFeed)
+	if err != nil {
+		fmt.Fprintf(w, "failed to write feed: %v", err)
+		return
+	}
+}
+
+func queryGuildFeedReports(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	guildId int32,
+) ([]feedReport, error) {
+	reports := []feedReport{}
+	query := google_datastore.NewQuery("report").
+		FilterField("GuildId", "=", guildId).
+		Order("-CreatedAt").
+		Limit(maxReportFeedEntries)
+	responseIter := datastoreClient.Run(ctx, query)
+	for {
+		var report datastore.Report
+		key, err := responseIter.Next(&report)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("datastore report query failed: %v", err)
+		}
+
+		reports = append(reports, feedReport{
+			Code:   key.Name,
+			Report: report,
+		})
+	}
+	return reports, nil
+}
+
+// queryPlayerFeedReports loads the reports the given players raided since a point in time and returns the most
+// recently scanned ones. Player reports only store start times, so every report in the window needs to be loaded to
+// find out when it was scanned, and logs uploaded long after their raid don't show up.
+func queryPlayerFeedReports(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	playerKeys []*google_datastore.Key,
+	players []datastore.Player,
+	since time.Time,
+) ([]feedReport, error) {
+	codes := []string{}
+	seen := map[string]struct{}{}
+	for i, player := range players {
+		playerReports, err := datastore.LoadPlayerReportsSince(ctx, datastoreClient, playerKeys[i], player, since)
+		if err != nil {
+			return nil, err
+		}
+		for _, playerReport := range playerReports {
+			if _, ok := seen[playerReport.Code]; ok {
+				continue
+			}
+			seen[playerReport.Code] = struct{}{}
+			codes = append(codes, playerReport.Code)
+		}
+	}
+
+	reports := []feedReport{}
+	for start := 0; start < len(codes); start += reportFeedBatchSize {
+		end := start + reportFeedBatchSize
+		if end > len(codes) {
+			end = len(codes)
+		}
+
+		keys := []*google_datastore.Key{}
+		for _, code := range codes[start:end] {
+			keys = append(keys, google_datastore.NameKey("report", code, nil))
+		}
+		batch := make([]datastore.Report, len(keys))
+		err := datastoreClient.GetMulti(ctx, keys, batch)
+		if multiErr, ok := err.(google_datastore.MultiError); ok {
+			for i, keyErr := range multiErr {
+				if keyErr != nil && keyErr != google_datastore.ErrNoSuchEntity {
+					return nil, fmt.Errorf("datastore get report %v failed: %v", keys[i].Name, keyErr)
+				}
+			}
+		} else if err != nil {
+			return nil, fmt.Errorf("datastore get reports failed: %v", err)
+		}
+
+		for i, report := range batch {
+			if report.CreatedAt.IsZero() {
+				continue
+			}
+			reports = append(reports, feedReport{
+				Code:   keys[i].Name,
+				Report: report,
+			})
+		}
+	}
+
+	sort.SliceStable(reports, func(i int, j int) bool {
+		return reports[i].Report.CreatedAt.After(reports[j].Report.CreatedAt)
+	})
+	if len(reports) > maxReportFeedEntries {
+		reports = reports[:maxReportFeedEntries]
+	}
+	return reports, nil
+}
+
+func reportFeedSummary(report datastore.Report) string {
+	players := map[int64]struct{}{}
+	for _, player := range report.Players {
+		players[player.Id] = struct{}{}
+	}
+
+	summary := fmt.Sprintf("%v, %v players, raided on %v", report.Zone, len(players), report.StartTime.UTC().Format(time.RFC1123))
+	if report.GuildName != "" {
+		summary = fmt.Sprintf("%v: %v", report.GuildName, summary)
+	}
+	return summary
+}
@@ -0,0 +1,28 @@
+package http
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/FabianHahn/raidlogscan/datastore"
+)
+
+const (
+	testReportFeedGuildId = "687460"
+)
+
+func TestReportFeed(t *testing.T) {
+	req := httptest.NewRequest("GET", fmt.Sprintf("/?guild_id=%v", testReportFeedGuildId), nil)
+
+	rr := httptest.NewRecorder()
+	datastoreClient := datastore.CreateDatastoreClientOrDie()
+	accountStatsUrl := "http://example.com/accountstats"
+	playerStatsUrl := "http://example.com/playerstats"
+	guildStatsUrl := "http://example.com/guildstats"
+	reportStatsUrl := "http://example.com/reportstats"
+	reportFeedUrl := "http://example.com/reportfeed"
+	ReportFeed(rr, req, datastoreClient, accountStatsUrl, playerStatsUrl, guildStatsUrl, reportStatsUrl, reportFeedUrl)
+
+	t.Log(rr.Body.String())
+}
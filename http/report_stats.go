@@ -0,0 +1,320 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	go_http "net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	google_datastore "cloud.google.com/go/datastore"
+	google_pubsub "cloud.google.com/go/pubsub"
+	"github.com/FabianHahn/raidlogscan/aggregate"
+	"github.com/FabianHahn/raidlogscan/cache"
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"github.com/FabianHahn/raidlogscan/html"
+	"github.com/FabianHahn/raidlogscan/pubsub"
+)
+
+var reportCodeRegexp = regexp.MustCompile("^[a-zA-Z0-9]{16}$")
+
+const (
+	regularLookbackRaids   = 10
+	regularMinRaids        = 3
+	regularAttendanceRatio = 0.5
+)
+
+func ReportStats(
+	w go_http.ResponseWriter,
+	r *go_http.Request,
+	htmlRenderer *html.Renderer,
+	datastoreClient *google_datastore.Client,
+	pubsubClient *google_pubsub.Client,
+	pageCache *cache.PageCache,
+	accountStatsUrl string,
+	playerStatsUrl string,
+	guildStatsUrl string,
+	scanReportsUrl string,
+	searchUrl string,
+	oauth2LoginUrl string,
+) {
+	ctx := context.Background()
+
+	code := r.FormValue("code")
+	if !isValidReportCode(code) {
+		w.WriteHeader(go_http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid report code: %v", code)
+		return
+	}
+
+	// Only reports that were scanned get cached, so reports that weren't are looked up again on every request.
+	statsPage := cache.ReportStatsPage(code)
+	if statsPage.OutputCached(w, r, pageCache, ctx) {
+		return
+	}
+	creationTime := time.Now()
+
+	reportKey := google_datastore.NameKey("report", code, nil)
+	var report datastore.Report
+	err := datastoreClient.Get(ctx, reportKey, &report)
+	if err == google_datastore.ErrNoSuchEntity {
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		if r.Method != go_http.MethodPost {
+			w.WriteHeader(go_http.StatusNotFound)
+			fmt.Fprintf(w, "Report %v hasn't been scanned yet.<br>\n", code)
+			fmt.Fprintf(w, "<form method=\"post\">\n")
+			fmt.Fprintf(w, "<input type=\"hidden\" name=\"code\" value=\"%v\">\n", code)
+			fmt.Fprintf(w, "<input type=\"submit\" value=\"Scan this report\">\n")
+			fmt.Fprintf(w, "</form>\n")
+			return
+		}
+
+		err = pubsub.PublishReportEvents(pubsubClient, ctx, pubsub.NewCauseId(), []string{code})
+		if err != nil {
+			w.WriteHeader(go_http.StatusInternalServerError)
+			fmt.Fprintf(w, "failed to publish report event %v: %v", code, err.Error())
+			return
+		}
+
+		fmt.Fprintf(w, "Successfully requested report %v to be scanned. <a href=\"?code=%v\">Reload</a> in a minute to see it.<br>\n",
+			code,
+			code)
+		return
+	} else if err != nil {
+		w.WriteHeader(go_http.StatusInternalServerError)
+		fmt.Fprintf(w, "Datastore query failed: %v", err)
+		return
+	}
+
+	playerAccounts := map[int64]string{}
+	for _, playerAccount := range report.PlayerAccounts {
+		playerAccounts[playerAccount.PlayerId] = playerAccount.Name
+	}
+
+	guildRaids := map[string]int64{}
+	firstRaids := map[string]time.Time{}
+	recentRaids := map[string]int{}
+	numRecentRaids := 0
+	if report.GuildId != 0 {
+		guildRaids, firstRaids, err = loadGuildRaiders(ctx, datastoreClient, report.GuildId, playerAccounts)
+		if err != nil {
+			w.WriteHeader(go_http.StatusInternalServerError)
+			fmt.Fprintf(w, "failed to load guild raiders: %v", err)
+			return
+		}
+
+		recentRaids, numRecentRaids, err = queryRecentGuildRaids(
+			ctx,
+			datastoreClient,
+			report.GuildId,
+			report.StartTime,
+			playerAccounts)
+		if err != nil {
+			w.WriteHeader(go_http.StatusInternalServerError)
+			fmt.Fprintf(w, "failed to load recent guild raids: %v", err)
+			return
+		}
+	}
+
+	raidersByRole := map[string][]html.ReportRaider{}
+	roleCounts := map[string]int{}
+	classCounts := map[string]int{}
+	specCounts := map[string]int{}
+	accountSet := map[string]struct{}{}
+	numFirstTime := 0
+	numRegulars := 0
+	reportPlayers := map[int64]struct{}{}
+	for _, player := range report.Players {
+		// Don't count duplicate players in a report multiple times
+		if _, ok := reportPlayers[player.Id]; ok {
+			continue
+		}
+		reportPlayers[player.Id] = struct{}{}
+
+		roleCounts[player.Role]++
+		classCounts[player.Class]++
+		if player.Spec != "" {
+			specCounts[player.Spec]++
+		}
+
+		accountName := playerAccounts[player.Id]
+		if accountName != "" {
+			accountSet[accountName] = struct{}{}
+		}
+
+		key := datastore.GuildMemberKey(accountName, player.Id)
+		firstRaid, ok := firstRaids[key]
+		raider := html.ReportRaider{
+			Player:     player,
+			Account:    accountName,
+			GuildRaids: guildRaids[key],
+			FirstTime:  report.GuildId != 0 && (!ok || !firstRaid.Before(report.StartTime)),
+			Regular: numRecentRaids >= regularMinRaids &&
+				float64(recentRaids[key]) >= regularAttendanceRatio*float64(numRecentRaids),
+		}
+		if raider.FirstTime {
+			numFirstTime++
+		}
+		if raider.Regular {
+			numRegulars++
+		}
+		raidersByRole[player.Role] = append(raidersByRole[player.Role], raider)
+	}
+
+	roleGroups := []html.ReportRoleGroup{}
+	for role, raiders := range raidersByRole {
+		sort.SliceStable(raiders, func(i int, j int) bool {
+			if raiders[i].Player.Class != raiders[j].Player.Class {
+				return raiders[i].Player.Class < raiders[j].Player.Class
+			}
+			return raiders[i].Player.Name < raiders[j].Player.Name
+		})
+		roleGroups = append(roleGroups, html.ReportRoleGroup{
+			Role:    role,
+			Raiders: raiders,
+		})
+	}
+	sort.SliceStable(roleGroups, func(i int, j int) bool {
+		return roleOrder(roleGroups[i].Role) < roleOrder(roleGroups[j].Role)
+	})
+
+	accounts := []string{}
+	for accountName := range accountSet {
+		accounts = append(accounts, accountName)
+	}
+	sort.Strings(accounts)
+
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	statsPage.CacheAndOutput(w, r, pageCache, ctx, creationTime, func(wr io.Writer) error {
+		return htmlRenderer.RenderReportStats(
+			wr,
+			code,
+			report,
+			len(reportPlayers),
+			roleGroups,
+			reportCounts(roleCounts),
+			reportCounts(classCounts),
+			reportCounts(specCounts),
+			accounts,
+			numFirstTime,
+			numRegulars,
+			accountStatsUrl,
+			playerStatsUrl,
+			guildStatsUrl,
+			scanReportsUrl,
+			searchUrl,
+			oauth2LoginUrl)
+	})
+}
+
+// loadGuildRaiders counts the raids of every raider of a guild and looks up their first raid with the guild, keyed by
+// datastore.GuildMemberKey, from the guild aggregate. Account claims of the report being looked at take precedence over
+// those in the aggregate, since the aggregate may not have caught up with them yet.
+func loadGuildRaiders(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	guildId int32,
+	playerAccounts map[int64]string,
+) (map[string]int64, map[string]time.Time, error) {
+	guildAggregate, err := aggregate.LoadGuildAggregate(ctx, datastoreClient, guildId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	guildRaids := map[string]int64{}
+	firstRaids := map[string]time.Time{}
+	for _, raider := range guildAggregate.Raiders {
+		accountName, ok := playerAccounts[raider.PlayerId]
+		if !ok {
+			accountName = raider.Account
+		}
+
+		key := datastore.GuildMemberKey(accountName, raider.PlayerId)
+		guildRaids[key] += raider.Count
+		if firstRaid, ok := firstRaids[key]; !ok || raider.FirstRaid.Before(firstRaid) {
+			firstRaids[key] = raider.FirstRaid
+		}
+	}
+	return guildRaids, firstRaids, nil
+}
+
+// queryRecentGuildRaids counts in how many of the most recent guild raids before the given start time each raider took
+// part, keyed by datastore.GuildMemberKey, and returns how many recent raids there were. Account claims of the report
+// being looked at take precedence over those of earlier reports, since they may have been made after those reports
+// were scanned.
+func queryRecentGuildRaids(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	guildId int32,
+	startTime time.Time,
+	playerAccounts map[int64]string,
+) (map[string]int, int, error) {
+	query := google_datastore.NewQuery("report").
+		FilterField("GuildId", "=", guildId).
+		FilterField("StartTime", "<", startTime).
+		Order("-StartTime").
+		Limit(regularLookbackRaids)
+	var reports []datastore.Report
+	_, err := datastoreClient.GetAll(ctx, query, &reports)
+	if err != nil {
+		return nil, 0, fmt.Errorf("datastore guild report query failed: %v", err)
+	}
+
+	recentRaids := map[string]int{}
+	for _, report := range reports {
+		reportAccounts := map[int64]string{}
+		for _, playerAccount := range report.PlayerAccounts {
+			reportAccounts[playerAccount.PlayerId] = playerAccount.Name
+		}
+
+		participants := map[string]struct{}{}
+		for _, player := range report.Players {
+			accountName, ok := playerAccounts[player.Id]
+			if !ok {
+				accountName = reportAccounts[player.Id]
+			}
+			participants[datastore.GuildMemberKey(accountName, player.Id)] = struct{}{}
+		}
+
+		for key := range participants {
+			recentRaids[key]++
+		}
+	}
+	return recentRaids, len(reports), nil
+}
+
+// isValidReportCode checks that a report code looks like the alphanumeric identifier in Warcraft Logs report URLs.
+func isValidReportCode(code string) bool {
+	return reportCodeRegexp.MatchString(code)
+}
+
+func reportCounts(counts map[string]int) []html.ReportCount {
+	result := []html.ReportCount{}
+	for name, count := range counts {
+		result = append(result, html.ReportCount{
+			Name:  name,
+			Count: count,
+		})
+	}
+	sort.SliceStable(result, func(i int, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+func roleOrder(role string) int {
+	switch role {
+	case "tank":
+		return 0
+	case "healer":
+		return 1
+	case "dps":
+		return 2
+	}
+	return 3
+}
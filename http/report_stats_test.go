@@ -0,0 +1,48 @@
+package http
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/FabianHahn/raidlogscan/cache"
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"github.com/FabianHahn/raidlogscan/html"
+	"github.com/FabianHahn/raidlogscan/pubsub"
+)
+
+const (
+	testStatsReportCode = "q1ZxbNt74DB6zFr2"
+)
+
+func TestReportStats(t *testing.T) {
+	req := httptest.NewRequest("GET", fmt.Sprintf("/?code=%v", testStatsReportCode), nil)
+	req.Header.Add("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	htmlRenderer := html.CreateRendererOrDie()
+	datastoreClient := datastore.CreateDatastoreClientOrDie()
+	pubsubClient := pubsub.CreatePubsubClientOrDie()
+	pageCache := cache.CreatePageCache(datastoreClient, "")
+	accountStatsUrl := "http://example.com/accountstats"
+	playerStatsUrl := "http://example.com/playerstats"
+	guildStatsUrl := "http://example.com/guildstats"
+	scanReportsUrl := "http://example.com/scanreports"
+	searchUrl := "http://example.com/search"
+	oauth2LoginUrl := "http://example.com/oauth2login"
+	ReportStats(
+		rr,
+		req,
+		htmlRenderer,
+		datastoreClient,
+		pubsubClient,
+		pageCache,
+		accountStatsUrl,
+		playerStatsUrl,
+		guildStatsUrl,
+		scanReportsUrl,
+		searchUrl,
+		oauth2LoginUrl)
+
+	t.Log(rr.Body.String())
+}
@@ -0,0 +1,89 @@
+package http
+
+import (
+	"sort"
+	"time"
+
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"github.com/FabianHahn/raidlogscan/html"
+)
+
+type roleDistributionWindow struct {
+	name string
+	days int
+}
+
+const (
+	// Raids older than this are only covered by the all time window, so they don't need to be loaded.
+	maxRoleDistributionDays = 365
+)
+
+// A window of zero days covers all raids.
+var roleDistributionWindows = []roleDistributionWindow{
+	{name: "Last 30 days", days: 30},
+	{name: "Last 90 days", days: 90},
+	{name: "Last year", days: maxRoleDistributionDays},
+	{name: "All time", days: 0},
+}
+
+// computeRoleDistributions aggregates the roles and specs played in the given non-duplicate raids over a number of time
+// windows ending now, which only need to cover the last maxRoleDistributionDays. The all time window is taken from the
+// role counters instead. Windows without any raids are left out.
+func computeRoleDistributions(
+	raids []datastore.AccountRaid,
+	allTime []datastore.AccountRoleCount,
+	now time.Time,
+) []html.RoleDistribution {
+	distributions := []html.RoleDistribution{}
+	for _, window := range roleDistributionWindows {
+		roleCounts := map[string]int64{}
+		specCounts := map[string]int64{}
+		numRaids := int64(0)
+		if window.days > 0 {
+			for _, raid := range raids {
+				if raid.StartTime.Before(now.AddDate(0, 0, -window.days)) {
+					continue
+				}
+
+				numRaids++
+				roleCounts[raid.Role]++
+				specCounts[raid.Spec]++
+			}
+		} else {
+			for _, roleCount := range allTime {
+				numRaids += roleCount.Count
+				roleCounts[roleCount.Role] += roleCount.Count
+				specCounts[roleCount.Spec] += roleCount.Count
+			}
+		}
+		if numRaids == 0 {
+			continue
+		}
+
+		distributions = append(distributions, html.RoleDistribution{
+			Window:   window.name,
+			NumRaids: numRaids,
+			Roles:    roleShares(roleCounts, numRaids),
+			Specs:    roleShares(specCounts, numRaids),
+		})
+	}
+	return distributions
+}
+
+func roleShares(counts map[string]int64, total int64) []html.RoleShare {
+	shares := []html.RoleShare{}
+	for name, count := range counts {
+		shares = append(shares, html.RoleShare{
+			Name:       name,
+			Count:      count,
+			Percentage: count * 100 / total,
+		})
+	}
+	sort.SliceStable(shares, func(i int, j int) bool {
+		if shares[i].Count != shares[j].Count {
+			return shares[i].Count > shares[j].Count
+		}
+		return shares[i].Name < shares[j].Name
+	})
+	return shares
+}
@@ -45,6 +45,7 @@ func ScanGuildReports(
 	err = pubsub.PublishGuildReportsEvent(
 		pubsubClient,
 		ctx,
+		pubsub.NewCauseId(),
 		guildId)
 	if err != nil {
 		w.WriteHeader(go_http.StatusBadRequest)
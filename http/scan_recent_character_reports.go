@@ -28,6 +28,7 @@ func ScanRecentCharacterReports(
 	err = pubsub.PublishRecentCharacterReportsEvent(
 		pubsubClient,
 		ctx,
+		pubsub.NewCauseId(),
 		characterId)
 	if err != nil {
 		w.WriteHeader(go_http.StatusBadRequest)
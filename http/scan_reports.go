@@ -0,0 +1,155 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	go_http "net/http"
+	"strings"
+	"unicode"
+
+	google_datastore "cloud.google.com/go/datastore"
+	google_pubsub "cloud.google.com/go/pubsub"
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"github.com/FabianHahn/raidlogscan/html"
+	"github.com/FabianHahn/raidlogscan/pubsub"
+)
+
+const (
+	maxScanReports = 100
+)
+
+func ScanReports(
+	w go_http.ResponseWriter,
+	r *go_http.Request,
+	htmlRenderer *html.Renderer,
+	datastoreClient *google_datastore.Client,
+	pubsubClient *google_pubsub.Client,
+	reportStatsUrl string,
+) {
+	ctx := context.Background()
+
+	if reports := r.FormValue("reports"); reports != "" {
+		// Errors echo the input back, so they must not be interpreted as HTML.
+		w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+		codes, invalid := parseReportCodes(reports)
+		if len(invalid) > 0 {
+			w.WriteHeader(go_http.StatusBadRequest)
+			fmt.Fprintf(w, "Not a Warcraft Logs report URL or code: %v", strings.Join(invalid, ", "))
+			return
+		}
+		if len(codes) > maxScanReports {
+			w.WriteHeader(go_http.StatusBadRequest)
+			fmt.Fprintf(w, "Can scan at most %v reports at once, got %v.", maxScanReports, len(codes))
+			return
+		}
+
+		err := pubsub.PublishReportEvents(pubsubClient, ctx, pubsub.NewCauseId(), codes)
+		if err != nil {
+			w.WriteHeader(go_http.StatusInternalServerError)
+			fmt.Fprintf(w, "failed to publish report events: %v", err.Error())
+			return
+		}
+
+		go_http.Redirect(w, r, "?codes="+strings.Join(codes, ","), go_http.StatusSeeOther)
+		return
+	}
+
+	statuses := []html.ScanReportStatus{}
+	if codesParam := r.FormValue("codes"); codesParam != "" {
+		codes := strings.Split(codesParam, ",")
+		if len(codes) > maxScanReports {
+			codes = codes[:maxScanReports]
+		}
+
+		var err error
+		statuses, err = loadScanReportStatuses(ctx, datastoreClient, codes)
+		if err != nil {
+			w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+			w.WriteHeader(go_http.StatusBadRequest)
+			fmt.Fprintf(w, "%v", err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	err := htmlRenderer.RenderScanReports(w, statuses, reportStatsUrl)
+	if err != nil {
+		w.WriteHeader(go_http.StatusInternalServerError)
+		fmt.Fprintf(w, "Failed to render template: %v", err)
+		return
+	}
+}
+
+// loadScanReportStatuses looks up which of the given reports were scanned already.
+func loadScanReportStatuses(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	codes []string,
+) ([]html.ScanReportStatus, error) {
+	keys := []*google_datastore.Key{}
+	for _, code := range codes {
+		if !isValidReportCode(code) {
+			return nil, fmt.Errorf("invalid report code: %v", code)
+		}
+		keys = append(keys, google_datastore.NameKey("report", code, nil))
+	}
+
+	reports := make([]datastore.Report, len(keys))
+	scanned := make([]bool, len(keys))
+	err := datastoreClient.GetMulti(ctx, keys, reports)
+	if multiErr, ok := err.(google_datastore.MultiError); ok {
+		for i, keyErr := range multiErr {
+			if keyErr != nil && keyErr != google_datastore.ErrNoSuchEntity {
+				return nil, fmt.Errorf("datastore query failed: %v", keyErr)
+			}
+			scanned[i] = keyErr == nil
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("datastore query failed: %v", err)
+	} else {
+		for i := range scanned {
+			scanned[i] = true
+		}
+	}
+
+	statuses := []html.ScanReportStatus{}
+	for i, code := range codes {
+		statuses = append(statuses, html.ScanReportStatus{
+			Code:    code,
+			Title:   reports[i].Title,
+			Scanned: scanned[i],
+		})
+	}
+	return statuses, nil
+}
+
+// parseReportCodes extracts report codes from whitespace or comma separated report URLs or codes. It returns the
+// distinct valid codes in order, and all entries that are not valid.
+func parseReportCodes(input string) ([]string, []string) {
+	codes := []string{}
+	invalid := []string{}
+	seen := map[string]struct{}{}
+	entries := strings.FieldsFunc(input, func(r rune) bool {
+		return unicode.IsSpace(r) || r == ','
+	})
+	for _, entry := range entries {
+		code := entry
+		if index := strings.Index(code, "/reports/"); index >= 0 {
+			code = code[index+len("/reports/"):]
+			if end := strings.IndexAny(code, "#?/"); end >= 0 {
+				code = code[:end]
+			}
+		}
+
+		if !isValidReportCode(code) {
+			invalid = append(invalid, entry)
+			continue
+		}
+		if _, ok := seen[code]; ok {
+			continue
+		}
+		seen[code] = struct{}{}
+		codes = append(codes, code)
+	}
+	return codes, invalid
+}
@@ -0,0 +1,48 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"github.com/FabianHahn/raidlogscan/html"
+	"github.com/FabianHahn/raidlogscan/pubsub"
+)
+
+const (
+	testScanReportsUrl = "https://classic.warcraftlogs.com/reports/q1ZxbNt74DB6zFr2#fight=last"
+)
+
+func TestScanReports(t *testing.T) {
+	req := httptest.NewRequest("GET", fmt.Sprintf("/?reports=%v", url.QueryEscape(testScanReportsUrl)), nil)
+	req.Header.Add("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	htmlRenderer := html.CreateRendererOrDie()
+	datastoreClient := datastore.CreateDatastoreClientOrDie()
+	pubsubClient := pubsub.CreatePubsubClientOrDie()
+	reportStatsUrl := "http://example.com/reportstats"
+	ScanReports(rr, req, htmlRenderer, datastoreClient, pubsubClient, reportStatsUrl)
+
+	t.Log(rr.Header().Get("Location"))
+	t.Log(rr.Body.String())
+}
+
+func TestScanReportsEscapesTitles(t *testing.T) {
+	htmlRenderer := html.CreateRendererOrDie()
+	var buffer bytes.Buffer
+	err := htmlRenderer.RenderScanReports(&buffer, []html.ScanReportStatus{
+		{Code: "q1ZxbNt74DB6zFr2", Title: "<script>alert(1)</script>", Scanned: true},
+	}, "http://example.com/reportstats")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(buffer.String(), "<script>") {
+		t.Fatalf("report title was rendered unescaped: %v", buffer.String())
+	}
+}
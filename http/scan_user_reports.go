@@ -28,6 +28,7 @@ func ScanUserReports(
 	err = pubsub.PublishUserReportsEvent(
 		pubsubClient,
 		ctx,
+		pubsub.NewCauseId(),
 		userId)
 	if err != nil {
 		w.WriteHeader(go_http.StatusBadRequest)
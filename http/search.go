@@ -0,0 +1,134 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	go_http "net/http"
+	"strings"
+
+	google_datastore "cloud.google.com/go/datastore"
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"github.com/FabianHahn/raidlogscan/html"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	minSearchLength       = 2
+	maxSearchResults      = 25
+	maxSearchScannedItems = 500
+)
+
+func Search(
+	w go_http.ResponseWriter,
+	r *go_http.Request,
+	htmlRenderer *html.Renderer,
+	datastoreClient *google_datastore.Client,
+	accountStatsUrl string,
+	playerStatsUrl string,
+	guildStatsUrl string,
+	scanReportsUrl string,
+	searchUrl string,
+	oauth2LoginUrl string,
+) {
+	ctx := context.Background()
+
+	searchQuery := strings.TrimSpace(r.URL.Query().Get("q"))
+	prefix := datastore.NormalizeSearch(strings.TrimPrefix(searchQuery, "#"))
+	if len(prefix) < minSearchLength {
+		w.WriteHeader(go_http.StatusBadRequest)
+		fmt.Fprintf(w, "Search term needs to be at least %v characters long", minSearchLength)
+		return
+	}
+
+	characters := []datastore.PlayerCoraider{}
+	query := prefixQuery("player", "SearchName", prefix).Limit(maxSearchResults)
+	responseIter := datastoreClient.Run(ctx, query)
+	for {
+		var player datastore.Player
+		key, err := responseIter.Next(&player)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			w.WriteHeader(go_http.StatusInternalServerError)
+			fmt.Fprintf(w, "Datastore query failed: %v", err)
+			return
+		}
+
+		characters = append(characters, datastore.PlayerCoraider{
+			Id:     key.ID,
+			Name:   player.Name,
+			Server: player.Server,
+			Class:  player.Class,
+		})
+	}
+
+	accounts := []string{}
+	seenAccounts := map[string]struct{}{}
+	query = prefixQuery("player", "SearchAccount", prefix).Limit(maxSearchScannedItems)
+	responseIter = datastoreClient.Run(ctx, query)
+	for len(accounts) < maxSearchResults {
+		var player datastore.Player
+		_, err := responseIter.Next(&player)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			w.WriteHeader(go_http.StatusInternalServerError)
+			fmt.Fprintf(w, "Datastore query failed: %v", err)
+			return
+		}
+
+		if _, ok := seenAccounts[player.Account]; !ok {
+			seenAccounts[player.Account] = struct{}{}
+			accounts = append(accounts, player.Account)
+		}
+	}
+
+	guilds := []html.GuildLeaderboardEntry{}
+	query = prefixQuery("guild", "SearchName", prefix).Limit(maxSearchResults)
+	responseIter = datastoreClient.Run(ctx, query)
+	for {
+		var guild datastore.Guild
+		key, err := responseIter.Next(&guild)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			w.WriteHeader(go_http.StatusInternalServerError)
+			fmt.Fprintf(w, "Datastore query failed: %v", err)
+			return
+		}
+
+		guilds = append(guilds, html.GuildLeaderboardEntry{
+			GuildId:   int32(key.ID),
+			GuildName: guild.Name,
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	err := htmlRenderer.RenderSearch(
+		w,
+		searchQuery,
+		characters,
+		accounts,
+		guilds,
+		accountStatsUrl,
+		playerStatsUrl,
+		guildStatsUrl,
+		scanReportsUrl,
+		searchUrl,
+		oauth2LoginUrl)
+	if err != nil {
+		fmt.Fprintf(w, "failed to render template: %v", err)
+		return
+	}
+}
+
+// prefixQuery matches all entities of a kind whose normalized search field starts with the given prefix.
+func prefixQuery(kind string, field string, prefix string) *google_datastore.Query {
+	return google_datastore.NewQuery(kind).
+		FilterField(field, ">=", prefix).
+		FilterField(field, "<", prefix+datastore.SearchPrefixEnd).
+		Order(field)
+}
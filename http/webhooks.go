@@ -0,0 +1,231 @@
+package http
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	go_html "html"
+	go_http "net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	google_datastore "cloud.google.com/go/datastore"
+	"github.com/FabianHahn/raidlogscan/cache"
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"github.com/FabianHahn/raidlogscan/oauth2"
+	"github.com/FabianHahn/raidlogscan/webhook"
+)
+
+// Webhooks lets users that logged into Warcraft Logs subscribe URLs to events. Subscriptions filtered to a guild
+// additionally require the user to be an officer of that guild. Unsubscribing only needs the subscription's secret.
+func Webhooks(
+	w go_http.ResponseWriter,
+	r *go_http.Request,
+	datastoreClient *google_datastore.Client,
+) {
+	ctx := context.Background()
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	w.Header().Set("Cache-Control", cache.CacheControlPrivate)
+
+	session := r.PostFormValue("session")
+	switch r.PostFormValue("action") {
+	case "":
+		writeWebhooksForm(w, session)
+	case "subscribe":
+		userId, err := oauth2.ParseSessionToken(session)
+		if err != nil {
+			w.WriteHeader(go_http.StatusForbidden)
+			fmt.Fprintf(w, "invalid session, log into Warcraft Logs first: %v", go_html.EscapeString(err.Error()))
+			return
+		}
+
+		subscription, err := parseWebhookSubscription(r)
+		if err != nil {
+			w.WriteHeader(go_http.StatusBadRequest)
+			fmt.Fprintf(w, "invalid webhook subscription: %v", go_html.EscapeString(err.Error()))
+			return
+		}
+		subscription.UserId = userId
+
+		if subscription.GuildId != 0 {
+			officer, err := isGuildOfficer(ctx, datastoreClient, session, subscription.GuildId)
+			if err != nil {
+				w.WriteHeader(go_http.StatusInternalServerError)
+				fmt.Fprintf(w, "failed to check guild officer: %v", go_html.EscapeString(err.Error()))
+				return
+			}
+			if !officer {
+				w.WriteHeader(go_http.StatusForbidden)
+				fmt.Fprintf(w, "only officers of guild %v can subscribe to its events", subscription.GuildId)
+				return
+			}
+		}
+
+		key, err := datastoreClient.Put(ctx, google_datastore.IncompleteKey("webhook_subscription", nil), &subscription)
+		if err != nil {
+			w.WriteHeader(go_http.StatusInternalServerError)
+			fmt.Fprintf(w, "failed to store webhook subscription: %v", go_html.EscapeString(err.Error()))
+			return
+		}
+
+		fmt.Fprintf(w, "Subscribed %v to %v events.<br>\n",
+			go_html.EscapeString(subscription.Url),
+			strings.Join(subscription.EventTypes, ", "))
+		fmt.Fprintf(w, "<b>Subscription ID</b>: %v<br>\n", key.ID)
+		fmt.Fprintf(w, "<b>Signing secret</b>: %v<br>\n", subscription.Secret)
+		fmt.Fprintf(w, "Keep the secret, it's needed to verify the %v header and to unsubscribe again.<br>\n",
+			webhook.SignatureHeader)
+	case "unsubscribe":
+		err := deleteWebhookSubscription(ctx, datastoreClient, r.FormValue("subscription_id"), r.FormValue("secret"))
+		if err != nil {
+			w.WriteHeader(go_http.StatusForbidden)
+			fmt.Fprintf(w, "failed to unsubscribe: %v", go_html.EscapeString(err.Error()))
+			return
+		}
+		fmt.Fprintf(w, "Unsubscribed.<br>\n")
+	default:
+		w.WriteHeader(go_http.StatusBadRequest)
+		fmt.Fprintf(w, "unknown webhook action %v", go_html.EscapeString(r.FormValue("action")))
+	}
+}
+
+func writeWebhooksForm(w go_http.ResponseWriter, session string) {
+	fmt.Fprintf(w, "<html><head><title>Webhooks - WoW Raid Stats</title></head><body>\n")
+	fmt.Fprintf(w, "<h1>Webhooks</h1>\n")
+	fmt.Fprintf(w, "<h2>Subscribe</h2>\n")
+	if _, err := oauth2.ParseSessionToken(session); err != nil {
+		fmt.Fprintf(w, "Log into Warcraft Logs and follow the webhooks link there to subscribe.<br>\n")
+	} else {
+		writeWebhooksSubscribeForm(w, session)
+	}
+	fmt.Fprintf(w, "<h2>Unsubscribe</h2>\n")
+	fmt.Fprintf(w, "<form method=\"post\">\n")
+	fmt.Fprintf(w, "<input type=\"hidden\" name=\"action\" value=\"unsubscribe\">\n")
+	fmt.Fprintf(w, "Subscription ID: <input type=\"text\" name=\"subscription_id\"><br>\n")
+	fmt.Fprintf(w, "Signing secret: <input type=\"text\" name=\"secret\"><br>\n")
+	fmt.Fprintf(w, "<input type=\"submit\" value=\"Unsubscribe\">\n")
+	fmt.Fprintf(w, "</form>\n")
+	fmt.Fprintf(w, "</body></html>\n")
+}
+
+func writeWebhooksSubscribeForm(w go_http.ResponseWriter, session string) {
+	fmt.Fprintf(w, "<form method=\"post\">\n")
+	fmt.Fprintf(w, "<input type=\"hidden\" name=\"action\" value=\"subscribe\">\n")
+	fmt.Fprintf(w, "<input type=\"hidden\" name=\"session\" value=\"%v\">\n", go_html.EscapeString(session))
+	fmt.Fprintf(w, "<label for=\"url\">URL (e.g. a Discord webhook):</label><br>\n")
+	fmt.Fprintf(w, "<input type=\"text\" id=\"url\" name=\"url\" size=\"80\"><br>\n")
+	fmt.Fprintf(w, "<label for=\"format\">Format:</label><br>\n")
+	fmt.Fprintf(w, "<select id=\"format\" name=\"format\">\n")
+	fmt.Fprintf(w, "<option value=\"%v\">Discord</option>\n", webhook.FormatDiscord)
+	fmt.Fprintf(w, "<option value=\"%v\">JSON</option>\n", webhook.FormatJson)
+	fmt.Fprintf(w, "</select><br>\n")
+	fmt.Fprintf(w, "Events:<br>\n")
+	for _, eventType := range webhook.EventTypes {
+		fmt.Fprintf(w, "<input type=\"checkbox\" id=\"%v\" name=\"event\" value=\"%v\"><label for=\"%v\">%v</label><br>\n",
+			eventType, eventType, eventType, eventType)
+	}
+	fmt.Fprintf(w, "Only for guild ID (officers only): <input type=\"text\" name=\"guild_id\"><br>\n")
+	fmt.Fprintf(w, "Only for account name: <input type=\"text\" name=\"account_name\"><br>\n")
+	fmt.Fprintf(w, "Only for player ID: <input type=\"text\" name=\"player_id\"><br>\n")
+	fmt.Fprintf(w, "Only for milestones (comma separated, any of %v): <input type=\"text\" name=\"milestones\"><br>\n",
+		webhook.Milestones)
+	fmt.Fprintf(w, "<input type=\"submit\" value=\"Subscribe\">\n")
+	fmt.Fprintf(w, "</form>\n")
+}
+
+func parseWebhookSubscription(r *go_http.Request) (datastore.WebhookSubscription, error) {
+	subscription := datastore.WebhookSubscription{
+		Url:         r.FormValue("url"),
+		Format:      r.FormValue("format"),
+		AccountName: r.FormValue("account_name"),
+		CreatedAt:   time.Now(),
+	}
+
+	err := webhook.CheckUrl(subscription.Url)
+	if err != nil {
+		return subscription, err
+	}
+	if subscription.Format != webhook.FormatDiscord && subscription.Format != webhook.FormatJson {
+		return subscription, fmt.Errorf("unknown format %v", subscription.Format)
+	}
+
+	r.ParseForm()
+	for _, eventType := range r.Form["event"] {
+		known := false
+		for _, knownEventType := range webhook.EventTypes {
+			if eventType == knownEventType {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return subscription, fmt.Errorf("unknown event type %v", eventType)
+		}
+		subscription.EventTypes = append(subscription.EventTypes, eventType)
+	}
+	if len(subscription.EventTypes) == 0 {
+		return subscription, fmt.Errorf("no event types selected")
+	}
+
+	if guildId := r.FormValue("guild_id"); guildId != "" {
+		guildId64, err := strconv.ParseInt(guildId, 10, 32)
+		if err != nil {
+			return subscription, fmt.Errorf("guild ID conversion failed: %v", err)
+		}
+		subscription.GuildId = int32(guildId64)
+	}
+	if playerId := r.FormValue("player_id"); playerId != "" {
+		subscription.PlayerId, err = strconv.ParseInt(playerId, 10, 64)
+		if err != nil {
+			return subscription, fmt.Errorf("player ID conversion failed: %v", err)
+		}
+	}
+	if milestones := r.FormValue("milestones"); milestones != "" {
+		for _, milestone := range strings.Split(milestones, ",") {
+			count, err := strconv.ParseInt(strings.TrimSpace(milestone), 10, 64)
+			if err != nil || !webhook.IsMilestone(count) {
+				return subscription, fmt.Errorf("%v is not one of the milestones %v", milestone, webhook.Milestones)
+			}
+			subscription.Milestones = append(subscription.Milestones, count)
+		}
+	}
+
+	secret := make([]byte, 32)
+	_, err = rand.Read(secret)
+	if err != nil {
+		return subscription, fmt.Errorf("failed to generate secret: %v", err)
+	}
+	subscription.Secret = hex.EncodeToString(secret)
+	return subscription, nil
+}
+
+func deleteWebhookSubscription(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	subscriptionId string,
+	secret string,
+) error {
+	id, err := strconv.ParseInt(subscriptionId, 10, 64)
+	if err != nil {
+		return fmt.Errorf("subscription ID conversion failed: %v", err)
+	}
+
+	key := google_datastore.IDKey("webhook_subscription", id, nil)
+	var subscription datastore.WebhookSubscription
+	err = datastoreClient.Get(ctx, key, &subscription)
+	if err != nil {
+		return fmt.Errorf("datastore get webhook subscription %v failed: %v", id, err)
+	}
+	if !hmac.Equal([]byte(subscription.Secret), []byte(secret)) {
+		return fmt.Errorf("wrong secret for subscription %v", id)
+	}
+
+	err = datastoreClient.Delete(ctx, key)
+	if err != nil {
+		return fmt.Errorf("datastore delete webhook subscription %v failed: %v", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package http
+
+import (
+	go_http "net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"github.com/FabianHahn/raidlogscan/webhook"
+)
+
+func TestWebhooks(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+
+	rr := httptest.NewRecorder()
+	datastoreClient := datastore.CreateDatastoreClientOrDie()
+	Webhooks(rr, req, datastoreClient)
+
+	t.Log(rr.Body.String())
+}
+
+func TestWebhooksSubscribeWithoutSession(t *testing.T) {
+	form := url.Values{
+		"action": {"subscribe"},
+		"url":    {"https://example.com/webhook"},
+		"format": {webhook.FormatJson},
+		"event":  {webhook.EventTypes[0]},
+	}
+	req := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	Webhooks(rr, req, nil)
+	if rr.Code != go_http.StatusForbidden {
+		t.Fatalf("expected status %v without a session, got %v", go_http.StatusForbidden, rr.Code)
+	}
+
+	t.Log(rr.Body.String())
+}
@@ -5,6 +5,7 @@ import (
 	go_http "net/http"
 	"os"
 
+	"github.com/FabianHahn/raidlogscan/cache"
 	"github.com/FabianHahn/raidlogscan/datastore"
 	"github.com/FabianHahn/raidlogscan/event"
 	"github.com/FabianHahn/raidlogscan/graphql"
@@ -21,62 +22,218 @@ func init() {
 	claimAccountUrl := os.Getenv("RAIDLOGSCAN_CLAIMACCOUNT_URL")
 	playerStatsUrl := os.Getenv("RAIDLOGSCAN_PLAYERSTATS_URL")
 	guildStatsUrl := os.Getenv("RAIDLOGSCAN_GUILDSTATS_URL")
+	reportStatsUrl := os.Getenv("RAIDLOGSCAN_REPORTSTATS_URL")
+	guildRosterUrl := os.Getenv("RAIDLOGSCAN_GUILDROSTER_URL")
+	webhooksUrl := os.Getenv("RAIDLOGSCAN_WEBHOOKS_URL")
+	raidNetworkUrl := os.Getenv("RAIDLOGSCAN_RAIDNETWORK_URL")
+	raidGroupsUrl := os.Getenv("RAIDLOGSCAN_RAIDGROUPS_URL")
+	raidCalendarUrl := os.Getenv("RAIDLOGSCAN_RAIDCALENDAR_URL")
+	reportFeedUrl := os.Getenv("RAIDLOGSCAN_REPORTFEED_URL")
 	oauth2LoginUrl := os.Getenv("RAIDLOGSCAN_OAUTH2_LOGIN_URL")
+	searchUrl := os.Getenv("RAIDLOGSCAN_SEARCH_URL")
+	scanReportsUrl := os.Getenv("RAIDLOGSCAN_SCAN_REPORTS_URL")
 	oauth2RedirectUrl := os.Getenv("RAIDLOGSCAN_OAUTH2_REDIRECT_URL")
 	scanUserReportsUrl := os.Getenv("RAIDLOGSCAN_SCAN_USER_REPORTS_URL")
 	scanCharacterReportsUrl := os.Getenv("RAIDLOGSCAN_SCAN_CHARACTER_REPORTS_URL")
 	scanGuildReportsUrl := os.Getenv("RAIDLOGSCAN_SCAN_GUILD_REPORTS_URL")
+	claimUserCharactersUrl := os.Getenv("RAIDLOGSCAN_CLAIM_USER_CHARACTERS_URL")
+	discordPublicKey := os.Getenv("RAIDLOGSCAN_DISCORD_PUBLIC_KEY")
+	cacheDirectory := os.Getenv("RAIDLOGSCAN_CACHE_DIR")
 
 	oauth2UserConfig := oauth2.CreateOauth2UserConfig(oauth2RedirectUrl)
 	htmlRenderer := html.CreateRendererOrDie()
 	datastoreClient := datastore.CreateDatastoreClientOrDie()
+	pageCache := cache.CreatePageCache(datastoreClient, cacheDirectory)
 	pubsubClient := pubsub.CreatePubsubClientOrDie()
 	graphqlClient := graphql.CreateGraphqlClient()
 
-	functions.CloudEvent("CoraiderAccountClaim", func(ctx context.Context, e google_event.Event) error {
-		return event.CoraiderAccountClaim(ctx, e, datastoreClient)
-	})
-	functions.CloudEvent("ReportAccountClaim", func(ctx context.Context, e google_event.Event) error {
-		return event.ReportAccountClaim(ctx, e, datastoreClient)
-	})
-	functions.CloudEvent("FetchGuildReports", func(ctx context.Context, e google_event.Event) error {
-		return event.FetchGuildReports(ctx, e, pubsubClient, graphqlClient)
-	})
-	functions.CloudEvent("FetchReport", func(ctx context.Context, e google_event.Event) error {
-		return event.FetchReport(ctx, e, datastoreClient, pubsubClient, graphqlClient)
-	})
-	functions.CloudEvent("UpdatePlayerReport", func(ctx context.Context, e google_event.Event) error {
-		return event.UpdatePlayerReport(ctx, e, datastoreClient, pubsubClient)
-	})
-	functions.CloudEvent("FetchUserReports", func(ctx context.Context, e google_event.Event) error {
-		return event.FetchUserReports(ctx, e, pubsubClient, graphqlClient)
-	})
-	functions.CloudEvent("FetchRecentCharacterReports", func(ctx context.Context, e google_event.Event) error {
-		return event.FetchRecentCharacterReports(ctx, e, pubsubClient, graphqlClient)
-	})
+	functions.CloudEvent("CoraiderAccountClaim", event.ProcessOnce(
+		datastoreClient,
+		"CoraiderAccountClaim",
+		func(ctx context.Context, e google_event.Event) error {
+			return event.CoraiderAccountClaim(ctx, e, datastoreClient)
+		}))
+	functions.CloudEvent("ReportAccountClaim", event.ProcessOnce(
+		datastoreClient,
+		"ReportAccountClaim",
+		func(ctx context.Context, e google_event.Event) error {
+			return event.ReportAccountClaim(ctx, e, datastoreClient)
+		}))
+	functions.CloudEvent("FetchGuildReports", event.ProcessOnce(
+		datastoreClient,
+		"FetchGuildReports",
+		func(ctx context.Context, e google_event.Event) error {
+			return event.FetchGuildReports(ctx, e, datastoreClient, pubsubClient, graphqlClient)
+		}))
+	functions.CloudEvent("FetchReport", event.ProcessOnce(
+		datastoreClient,
+		"FetchReport",
+		func(ctx context.Context, e google_event.Event) error {
+			return event.FetchReport(ctx, e, datastoreClient, pubsubClient, graphqlClient, reportStatsUrl)
+		}))
+	functions.CloudEvent("UpdatePlayerReport", event.ProcessOnce(
+		datastoreClient,
+		"UpdatePlayerReport",
+		func(ctx context.Context, e google_event.Event) error {
+			return event.UpdatePlayerReport(ctx, e, datastoreClient, pubsubClient, reportStatsUrl)
+		}))
+	functions.CloudEvent("FetchUserReports", event.ProcessOnce(
+		datastoreClient,
+		"FetchUserReports",
+		func(ctx context.Context, e google_event.Event) error {
+			return event.FetchUserReports(ctx, e, pubsubClient, graphqlClient)
+		}))
+	functions.CloudEvent("FetchRecentCharacterReports", event.ProcessOnce(
+		datastoreClient,
+		"FetchRecentCharacterReports",
+		func(ctx context.Context, e google_event.Event) error {
+			return event.FetchRecentCharacterReports(ctx, e, pubsubClient, graphqlClient)
+		}))
+	functions.CloudEvent("DetectRaidGroups", event.ProcessOnce(
+		datastoreClient,
+		"DetectRaidGroups",
+		func(ctx context.Context, e google_event.Event) error {
+			return event.DetectRaidGroups(ctx, e, datastoreClient)
+		}))
+	functions.CloudEvent("DeliverWebhook", event.ProcessOnce(
+		datastoreClient,
+		"DeliverWebhook",
+		func(ctx context.Context, e google_event.Event) error {
+			return event.DeliverWebhook(ctx, e, datastoreClient)
+		}))
 
 	functions.HTTP("AccountStats", func(w go_http.ResponseWriter, r *go_http.Request) {
-		http.AccountStats(w, r, htmlRenderer, datastoreClient, playerStatsUrl, guildStatsUrl, oauth2LoginUrl)
+		http.AccountStats(
+			w,
+			r,
+			htmlRenderer,
+			datastoreClient,
+			pageCache,
+			playerStatsUrl,
+			guildStatsUrl,
+			claimAccountUrl,
+			raidNetworkUrl,
+			raidGroupsUrl,
+			raidCalendarUrl,
+			reportFeedUrl,
+			scanReportsUrl,
+			searchUrl,
+			oauth2LoginUrl)
 	})
 	functions.HTTP("ClaimAccount", func(w go_http.ResponseWriter, r *go_http.Request) {
 		http.ClaimAccount(w, r, datastoreClient, pubsubClient, playerStatsUrl, accountStatsUrl)
 	})
+	functions.HTTP("ClaimUserCharacters", func(w go_http.ResponseWriter, r *go_http.Request) {
+		http.ClaimUserCharacters(w, r, datastoreClient, pubsubClient, playerStatsUrl, accountStatsUrl)
+	})
 	functions.HTTP("PlayerStats", func(w go_http.ResponseWriter, r *go_http.Request) {
-		http.PlayerStats(w, r, htmlRenderer, datastoreClient, accountStatsUrl, guildStatsUrl, claimAccountUrl, oauth2LoginUrl)
+		http.PlayerStats(
+			w,
+			r,
+			htmlRenderer,
+			datastoreClient,
+			pageCache,
+			playerStatsUrl,
+			accountStatsUrl,
+			guildStatsUrl,
+			reportStatsUrl,
+			claimAccountUrl,
+			raidNetworkUrl,
+			reportFeedUrl,
+			scanReportsUrl,
+			searchUrl,
+			oauth2LoginUrl)
 	})
 	functions.HTTP("GuildStats", func(w go_http.ResponseWriter, r *go_http.Request) {
-		http.GuildStats(w, r, htmlRenderer, datastoreClient, scanGuildReportsUrl, accountStatsUrl, playerStatsUrl, oauth2LoginUrl)
+		http.GuildStats(
+			w,
+			r,
+			htmlRenderer,
+			datastoreClient,
+			pageCache,
+			scanGuildReportsUrl,
+			accountStatsUrl,
+			playerStatsUrl,
+			reportStatsUrl,
+			guildRosterUrl,
+			raidNetworkUrl,
+			raidCalendarUrl,
+			reportFeedUrl,
+			scanReportsUrl,
+			searchUrl,
+			oauth2LoginUrl)
+	})
+	functions.HTTP("ReportStats", func(w go_http.ResponseWriter, r *go_http.Request) {
+		http.ReportStats(
+			w,
+			r,
+			htmlRenderer,
+			datastoreClient,
+			pubsubClient,
+			pageCache,
+			accountStatsUrl,
+			playerStatsUrl,
+			guildStatsUrl,
+			scanReportsUrl,
+			searchUrl,
+			oauth2LoginUrl)
+	})
+	functions.HTTP("GuildRoster", func(w go_http.ResponseWriter, r *go_http.Request) {
+		http.GuildRoster(
+			w,
+			r,
+			htmlRenderer,
+			datastoreClient,
+			pageCache,
+			accountStatsUrl,
+			playerStatsUrl,
+			guildStatsUrl,
+			guildRosterUrl,
+			scanReportsUrl,
+			searchUrl,
+			oauth2LoginUrl)
+	})
+	functions.HTTP("RaidNetwork", func(w go_http.ResponseWriter, r *go_http.Request) {
+		http.RaidNetwork(w, r, htmlRenderer, datastoreClient, accountStatsUrl, playerStatsUrl, scanReportsUrl, searchUrl, oauth2LoginUrl)
+	})
+	functions.HTTP("RaidGroups", func(w go_http.ResponseWriter, r *go_http.Request) {
+		http.RaidGroups(w, r, htmlRenderer, datastoreClient, accountStatsUrl, playerStatsUrl, guildStatsUrl, scanReportsUrl, searchUrl, oauth2LoginUrl)
+	})
+	functions.HTTP("RaidCalendar", func(w go_http.ResponseWriter, r *go_http.Request) {
+		http.RaidCalendar(w, r, datastoreClient, reportStatsUrl)
+	})
+	functions.HTTP("ReportFeed", func(w go_http.ResponseWriter, r *go_http.Request) {
+		http.ReportFeed(w, r, datastoreClient, accountStatsUrl, playerStatsUrl, guildStatsUrl, reportStatsUrl, reportFeedUrl)
+	})
+	functions.HTTP("Search", func(w go_http.ResponseWriter, r *go_http.Request) {
+		http.Search(w, r, htmlRenderer, datastoreClient, accountStatsUrl, playerStatsUrl, guildStatsUrl, scanReportsUrl, searchUrl, oauth2LoginUrl)
+	})
+	functions.HTTP("Webhooks", func(w go_http.ResponseWriter, r *go_http.Request) {
+		http.Webhooks(w, r, datastoreClient)
+	})
+	functions.HTTP("DiscordInteractions", func(w go_http.ResponseWriter, r *go_http.Request) {
+		http.DiscordInteractions(w, r, datastoreClient, pubsubClient, discordPublicKey, accountStatsUrl, playerStatsUrl,
+			guildStatsUrl, scanReportsUrl)
+	})
+	functions.HTTP("MigratePlayers", func(w go_http.ResponseWriter, r *go_http.Request) {
+		http.MigratePlayers(w, r, datastoreClient)
+	})
+	functions.HTTP("BackfillSearch", func(w go_http.ResponseWriter, r *go_http.Request) {
+		http.BackfillSearch(w, r, datastoreClient)
 	})
 	functions.HTTP("Oauth2Login", func(w go_http.ResponseWriter, r *go_http.Request) {
 		http.Oauth2Login(w, r, oauth2UserConfig)
 	})
 	functions.HTTP("Oauth2Callback", func(w go_http.ResponseWriter, r *go_http.Request) {
-		http.Oauth2Callback(w, r, oauth2UserConfig, scanUserReportsUrl,
-			scanCharacterReportsUrl)
+		http.Oauth2Callback(w, r, oauth2UserConfig, datastoreClient, scanUserReportsUrl,
+			scanCharacterReportsUrl, claimUserCharactersUrl, guildRosterUrl, webhooksUrl)
 	})
 	functions.HTTP("ScanUserReports", func(w go_http.ResponseWriter, r *go_http.Request) {
 		http.ScanUserReports(w, r, pubsubClient)
 	})
+	functions.HTTP("ScanReports", func(w go_http.ResponseWriter, r *go_http.Request) {
+		http.ScanReports(w, r, htmlRenderer, datastoreClient, pubsubClient, reportStatsUrl)
+	})
 	functions.HTTP("ScanGuildReports", func(w go_http.ResponseWriter, r *go_http.Request) {
 		http.ScanGuildReports(w, r, datastoreClient, pubsubClient, guildStatsUrl)
 	})
@@ -0,0 +1,83 @@
+package network
+
+import (
+	"sort"
+)
+
+const (
+	maxLabelPropagationIterations = 50
+)
+
+// DetectCommunities clusters the graph using weighted label propagation and returns all communities with at least
+// minSize members, largest first. Node IDs within each community are sorted. Iteration order and tie breaking are
+// deterministic so that repeated runs on the same graph produce the same communities.
+func DetectCommunities(graph Graph, minSize int) [][]string {
+	neighbors := map[string]map[string]int64{}
+	for _, node := range graph.Nodes {
+		neighbors[node.Id] = map[string]int64{}
+	}
+	for _, edge := range graph.Edges {
+		if _, ok := neighbors[edge.Source]; !ok {
+			neighbors[edge.Source] = map[string]int64{}
+		}
+		if _, ok := neighbors[edge.Target]; !ok {
+			neighbors[edge.Target] = map[string]int64{}
+		}
+		neighbors[edge.Source][edge.Target] += edge.Weight
+		neighbors[edge.Target][edge.Source] += edge.Weight
+	}
+
+	nodeIds := []string{}
+	labels := map[string]string{}
+	for id := range neighbors {
+		nodeIds = append(nodeIds, id)
+		labels[id] = id
+	}
+	sort.Strings(nodeIds)
+
+	for iteration := 0; iteration < maxLabelPropagationIterations; iteration++ {
+		changed := false
+		for _, id := range nodeIds {
+			labelWeights := map[string]int64{}
+			for neighbor, weight := range neighbors[id] {
+				labelWeights[labels[neighbor]] += weight
+			}
+
+			bestLabel := labels[id]
+			bestWeight := labelWeights[bestLabel]
+			for label, weight := range labelWeights {
+				if weight > bestWeight || (weight == bestWeight && label < bestLabel) {
+					bestLabel = label
+					bestWeight = weight
+				}
+			}
+
+			if bestLabel != labels[id] {
+				labels[id] = bestLabel
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	members := map[string][]string{}
+	for _, id := range nodeIds {
+		members[labels[id]] = append(members[labels[id]], id)
+	}
+
+	communities := [][]string{}
+	for _, community := range members {
+		if len(community) >= minSize {
+			communities = append(communities, community)
+		}
+	}
+	sort.SliceStable(communities, func(i int, j int) bool {
+		if len(communities[i]) != len(communities[j]) {
+			return len(communities[i]) > len(communities[j])
+		}
+		return communities[i][0] < communities[j][0]
+	})
+	return communities
+}
@@ -0,0 +1,181 @@
+package network
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+type graphmlKey struct {
+	Id       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphmlData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphmlNode struct {
+	Id   string        `xml:"id,attr"`
+	Data []graphmlData `xml:"data"`
+}
+
+type graphmlEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphmlData `xml:"data"`
+}
+
+type graphmlDocument struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Keys    []graphmlKey `xml:"key"`
+	Graph   struct {
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphmlNode `xml:"node"`
+		Edges       []graphmlEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+func WriteGraphml(wr io.Writer, graph Graph) error {
+	document := graphmlDocument{
+		Xmlns: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphmlKey{
+			{Id: "label", For: "node", AttrName: "label", AttrType: "string"},
+			{Id: "type", For: "node", AttrName: "type", AttrType: "string"},
+			{Id: "class", For: "node", AttrName: "class", AttrType: "string"},
+			{Id: "server", For: "node", AttrName: "server", AttrType: "string"},
+			{Id: "weight", For: "edge", AttrName: "weight", AttrType: "long"},
+		},
+	}
+	document.Graph.EdgeDefault = "undirected"
+
+	for _, node := range graph.Nodes {
+		document.Graph.Nodes = append(document.Graph.Nodes, graphmlNode{
+			Id: node.Id,
+			Data: []graphmlData{
+				{Key: "label", Value: node.Label},
+				{Key: "type", Value: nodeType(node)},
+				{Key: "class", Value: node.Class},
+				{Key: "server", Value: node.Server},
+			},
+		})
+	}
+	for _, edge := range graph.Edges {
+		document.Graph.Edges = append(document.Graph.Edges, graphmlEdge{
+			Source: edge.Source,
+			Target: edge.Target,
+			Data: []graphmlData{
+				{Key: "weight", Value: strconv.FormatInt(edge.Weight, 10)},
+			},
+		})
+	}
+
+	return writeXml(wr, document)
+}
+
+type gexfAttribute struct {
+	Id    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type gexfAttValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type gexfNode struct {
+	Id        string         `xml:"id,attr"`
+	Label     string         `xml:"label,attr"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfEdge struct {
+	Id     string `xml:"id,attr"`
+	Source string `xml:"source,attr"`
+	Target string `xml:"target,attr"`
+	Weight int64  `xml:"weight,attr"`
+}
+
+type gexfDocument struct {
+	XMLName xml.Name `xml:"gexf"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Version string   `xml:"version,attr"`
+	Graph   struct {
+		DefaultEdgeType string `xml:"defaultedgetype,attr"`
+		Attributes      struct {
+			Class      string          `xml:"class,attr"`
+			Attributes []gexfAttribute `xml:"attribute"`
+		} `xml:"attributes"`
+		Nodes []gexfNode `xml:"nodes>node"`
+		Edges []gexfEdge `xml:"edges>edge"`
+	} `xml:"graph"`
+}
+
+func WriteGexf(wr io.Writer, graph Graph) error {
+	document := gexfDocument{
+		Xmlns:   "http://gexf.net/1.3",
+		Version: "1.3",
+	}
+	document.Graph.DefaultEdgeType = "undirected"
+	document.Graph.Attributes.Class = "node"
+	document.Graph.Attributes.Attributes = []gexfAttribute{
+		{Id: "type", Title: "type", Type: "string"},
+		{Id: "class", Title: "class", Type: "string"},
+		{Id: "server", Title: "server", Type: "string"},
+	}
+
+	for _, node := range graph.Nodes {
+		document.Graph.Nodes = append(document.Graph.Nodes, gexfNode{
+			Id:    node.Id,
+			Label: node.Label,
+			AttValues: []gexfAttValue{
+				{For: "type", Value: nodeType(node)},
+				{For: "class", Value: node.Class},
+				{For: "server", Value: node.Server},
+			},
+		})
+	}
+	for i, edge := range graph.Edges {
+		document.Graph.Edges = append(document.Graph.Edges, gexfEdge{
+			Id:     strconv.Itoa(i),
+			Source: edge.Source,
+			Target: edge.Target,
+			Weight: edge.Weight,
+		})
+	}
+
+	return writeXml(wr, document)
+}
+
+func WriteJson(wr io.Writer, graph Graph) error {
+	return json.NewEncoder(wr).Encode(graph)
+}
+
+func nodeType(node Node) string {
+	if node.IsAccount {
+		return "account"
+	}
+	return "character"
+}
+
+func writeXml(wr io.Writer, document interface{}) error {
+	_, err := io.WriteString(wr, xml.Header)
+	if err != nil {
+		return fmt.Errorf("failed to write xml header: %v", err)
+	}
+
+	encoder := xml.NewEncoder(wr)
+	encoder.Indent("", "  ")
+	err = encoder.Encode(document)
+	if err != nil {
+		return fmt.Errorf("failed to encode xml: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package network
+
+import (
+	"fmt"
+	"sort"
+)
+
+type Node struct {
+	Id        string `json:"id"`
+	Label     string `json:"label"`
+	IsAccount bool   `json:"isAccount"`
+	Account   string `json:"account,omitempty"`
+	PlayerId  int64  `json:"playerId,omitempty"`
+	Class     string `json:"class,omitempty"`
+	Server    string `json:"server,omitempty"`
+	IsRoot    bool   `json:"isRoot"`
+}
+
+type Edge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Weight int64  `json:"weight"`
+}
+
+type Graph struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+}
+
+type edgeKey struct {
+	source string
+	target string
+}
+
+// Builder accumulates nodes and undirected weighted edges and produces a Graph.
+type Builder struct {
+	nodes map[string]Node
+	edges map[edgeKey]int64
+}
+
+func CreateBuilder() *Builder {
+	return &Builder{
+		nodes: map[string]Node{},
+		edges: map[edgeKey]int64{},
+	}
+}
+
+func AccountNodeId(accountName string) string {
+	return fmt.Sprintf("account:%v", accountName)
+}
+
+func PlayerNodeId(playerId int64) string {
+	return fmt.Sprintf("player:%v", playerId)
+}
+
+func (b *Builder) AddAccountNode(accountName string, isRoot bool) string {
+	id := AccountNodeId(accountName)
+	node, ok := b.nodes[id]
+	if !ok {
+		node = Node{
+			Id:        id,
+			Label:     "#" + accountName,
+			IsAccount: true,
+			Account:   accountName,
+		}
+	}
+	node.IsRoot = node.IsRoot || isRoot
+	b.nodes[id] = node
+	return id
+}
+
+func (b *Builder) AddPlayerNode(playerId int64, name string, class string, server string, isRoot bool) string {
+	id := PlayerNodeId(playerId)
+	node, ok := b.nodes[id]
+	if !ok {
+		node = Node{
+			Id:       id,
+			Label:    fmt.Sprintf("%v-%v", name, server),
+			PlayerId: playerId,
+			Class:    class,
+			Server:   server,
+		}
+	}
+	node.IsRoot = node.IsRoot || isRoot
+	b.nodes[id] = node
+	return id
+}
+
+// AddEdgeWeight adds weight to the undirected edge between two nodes. Self loops are ignored.
+func (b *Builder) AddEdgeWeight(source string, target string, weight int64) {
+	if source == target {
+		return
+	}
+	if target < source {
+		source, target = target, source
+	}
+	b.edges[edgeKey{source: source, target: target}] += weight
+}
+
+// Build returns the graph with all edges lighter than minWeight removed, as well as all non-root nodes that are left
+// without any edges. Nodes and edges are sorted for deterministic output.
+func (b *Builder) Build(minWeight int64) Graph {
+	graph := Graph{
+		Nodes: []Node{},
+		Edges: []Edge{},
+	}
+
+	connected := map[string]struct{}{}
+	for key, weight := range b.edges {
+		if weight < minWeight {
+			continue
+		}
+		graph.Edges = append(graph.Edges, Edge{
+			Source: key.source,
+			Target: key.target,
+			Weight: weight,
+		})
+		connected[key.source] = struct{}{}
+		connected[key.target] = struct{}{}
+	}
+
+	for id, node := range b.nodes {
+		if _, ok := connected[id]; ok || node.IsRoot {
+			graph.Nodes = append(graph.Nodes, node)
+		}
+	}
+
+	sort.SliceStable(graph.Nodes, func(i int, j int) bool {
+		return graph.Nodes[i].Id < graph.Nodes[j].Id
+	})
+	sort.SliceStable(graph.Edges, func(i int, j int) bool {
+		if graph.Edges[i].Weight != graph.Edges[j].Weight {
+			return graph.Edges[i].Weight > graph.Edges[j].Weight
+		}
+		if graph.Edges[i].Source != graph.Edges[j].Source {
+			return graph.Edges[i].Source < graph.Edges[j].Source
+		}
+		return graph.Edges[i].Target < graph.Edges[j].Target
+	})
+	return graph
+}
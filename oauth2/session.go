@@ -0,0 +1,69 @@
+package oauth2
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sessionDuration = 24 * time.Hour
+)
+
+// CreateSessionToken creates a signed token identifying a Warcraft Logs user that logged in via oauth2. Since all
+// functions are served from different domains, the token is passed along as a query parameter rather than a cookie.
+func CreateSessionToken(userId int32) (string, error) {
+	payload := fmt.Sprintf("%v.%v", userId, time.Now().Add(sessionDuration).Unix())
+	signature, err := signSession(payload)
+	if err != nil {
+		return "", err
+	}
+	return payload + "." + signature, nil
+}
+
+// ParseSessionToken verifies a token created by CreateSessionToken and returns the user ID it identifies.
+func ParseSessionToken(token string) (int32, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("malformed session token")
+	}
+
+	payload := parts[0] + "." + parts[1]
+	signature, err := signSession(payload)
+	if err != nil {
+		return 0, err
+	}
+	if !hmac.Equal([]byte(signature), []byte(parts[2])) {
+		return 0, fmt.Errorf("invalid session token signature")
+	}
+
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("session token expiry conversion failed: %v", err)
+	}
+	if time.Now().Unix() > expiry {
+		return 0, fmt.Errorf("session token expired")
+	}
+
+	userId, err := strconv.ParseInt(parts[0], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("session token user ID conversion failed: %v", err)
+	}
+	return int32(userId), nil
+}
+
+func signSession(payload string) (string, error) {
+	secret := os.Getenv("RAIDLOGSCAN_SESSION_SECRET")
+	if secret == "" {
+		return "", fmt.Errorf("session secret not configured")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
@@ -16,7 +16,8 @@ func CreateOauth2UserConfig(redirectUrl string) *oauth2.Config {
 		ClientID:     os.Getenv("WARCRAFTLOGS_CLIENT_ID"),
 		ClientSecret: os.Getenv("WARCRAFTLOGS_CLIENT_SECRET"),
 		RedirectURL:  redirectUrl,
-		Scopes:       []string{},
+		// Needed to see which guilds the user belongs to and their rank in them.
+		Scopes: []string{"view-user-profile"},
 		Endpoint: oauth2.Endpoint{
 			AuthURL:   oauth2ApiUrl + "/authorize",
 			TokenURL:  oauth2ApiUrl + "/token",
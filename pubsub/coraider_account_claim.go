@@ -49,6 +49,7 @@ func ParseCoraiderAccountClaimEvent(e event.Event) (CoraiderAccountClaimEvent, e
 func PublishCoraiderAccountClaimEvents(
 	pubsubClient *google_pubsub.Client,
 	ctx context.Context,
+	causeId string,
 	claimedPlayerId int64,
 	claimedAccountName string,
 	playerIds []int64,
@@ -60,11 +61,11 @@ func PublishCoraiderAccountClaimEvents(
 	reportTopic := pubsubClient.Topic(coraiderAccountClaimTopicId)
 	for _, playerId := range playerIds {
 		result := reportTopic.Publish(ctx, &google_pubsub.Message{
-			Attributes: map[string]string{
+			Attributes: withEventId(coraiderAccountClaimTopicId, causeId, map[string]string{
 				"player_id":            strconv.FormatInt(playerId, 10),
 				"claimed_player_id":    claimedPlayerIdString,
 				"claimed_account_name": claimedAccountName,
-			},
+			}),
 		})
 
 		waitGroup.Add(1)
@@ -27,15 +27,16 @@ func ParseGuildReportsEvent(e event.Event) (int64, error) {
 func PublishGuildReportsEvent(
 	pubsubClient *google_pubsub.Client,
 	ctx context.Context,
+	causeId string,
 	guildId int32,
 ) error {
 	var waitGroup sync.WaitGroup
 	var totalErrors uint64
 	reportTopic := pubsubClient.Topic(guildReportsTopicId)
 	result := reportTopic.Publish(ctx, &google_pubsub.Message{
-		Attributes: map[string]string{
+		Attributes: withEventId(guildReportsTopicId, causeId, map[string]string{
 			"guild_id": strconv.FormatInt(int64(guildId), 10),
-		},
+		}),
 	})
 
 	waitGroup.Add(1)
@@ -1,9 +1,62 @@
 package pubsub
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
 	google_pubsub "cloud.google.com/go/pubsub"
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+const (
+	eventIdAttribute = "event_id"
 )
 
 type MessagePublishedData struct {
 	Message google_pubsub.Message
 }
+
+// ParseEventId returns the ID of the event carried by a message. Messages published before events had IDs fall back
+// to the pubsub message ID, which at least stays the same across redeliveries.
+func ParseEventId(e event.Event) string {
+	var message MessagePublishedData
+	if err := e.DataAs(&message); err == nil && message.Message.Attributes[eventIdAttribute] != "" {
+		return message.Message.Attributes[eventIdAttribute]
+	}
+	return e.ID()
+}
+
+// NewCauseId generates a unique ID for a request that publishes events without being triggered by an event itself.
+func NewCauseId() string {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		// Fall back to the current time, which is unique enough for requests.
+		return strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	return hex.EncodeToString(id)
+}
+
+// withEventId adds the ID of the event to the attributes of a message. The ID is derived from the topic, the ID of
+// whatever caused the event to be published and the attributes, so that publishing the same event again when its
+// cause gets retried results in the same ID.
+func withEventId(topicId string, causeId string, attributes map[string]string) map[string]string {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := []string{topicId, causeId}
+	for _, key := range keys {
+		parts = append(parts, key+"="+attributes[key])
+	}
+	hash := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	attributes[eventIdAttribute] = hex.EncodeToString(hash[:16])
+	return attributes
+}
@@ -0,0 +1,42 @@
+package pubsub
+
+import (
+	"testing"
+)
+
+func TestWithEventId(t *testing.T) {
+	first := withEventId("playerreport", "cause", map[string]string{
+		"report_code": "abc",
+		"player_ids":  "1,2",
+	})
+	second := withEventId("playerreport", "cause", map[string]string{
+		"player_ids":  "1,2",
+		"report_code": "abc",
+	})
+	if first[eventIdAttribute] == "" {
+		t.Fatalf("expected an event ID to be set")
+	}
+	if first[eventIdAttribute] != second[eventIdAttribute] {
+		t.Fatalf("expected the same event ID for the same event, got %v and %v",
+			first[eventIdAttribute],
+			second[eventIdAttribute])
+	}
+
+	otherCause := withEventId("playerreport", "other", map[string]string{
+		"report_code": "abc",
+		"player_ids":  "1,2",
+	})
+	otherTopic := withEventId("report", "cause", map[string]string{
+		"report_code": "abc",
+		"player_ids":  "1,2",
+	})
+	otherAttributes := withEventId("playerreport", "cause", map[string]string{
+		"report_code": "abc",
+		"player_ids":  "1,3",
+	})
+	for _, other := range []map[string]string{otherCause, otherTopic, otherAttributes} {
+		if other[eventIdAttribute] == first[eventIdAttribute] {
+			t.Fatalf("expected a different event ID for a different event, got %v", other[eventIdAttribute])
+		}
+	}
+}
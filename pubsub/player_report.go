@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 
@@ -14,13 +15,18 @@ import (
 
 const (
 	playerReportTopicId = "playerreport"
+
+	// PlayerReportBatchSize is the maximum number of players of a report that are updated by a single event.
+	PlayerReportBatchSize = 10
 )
 
 type PlayerReportEvent struct {
-	Code     string
-	PlayerId int64
+	Code      string
+	PlayerIds []int64
 }
 
+// ParsePlayerReportEvent reads the report code and the batch of players to update from an event. Events published
+// before players were batched carry a single player ID instead. Events without a report code or players are malformed.
 func ParsePlayerReportEvent(e event.Event) (PlayerReportEvent, error) {
 	var message MessagePublishedData
 	if err := e.DataAs(&message); err != nil {
@@ -28,32 +34,61 @@ func ParsePlayerReportEvent(e event.Event) (PlayerReportEvent, error) {
 	}
 
 	code := message.Message.Attributes["code"]
-	playerId, err := strconv.ParseInt(message.Message.Attributes["player_id"], 10, 64)
-	if err != nil {
-		return PlayerReportEvent{}, fmt.Errorf("player ID conversion failed: %v", err.Error())
+	playerIdsString, ok := message.Message.Attributes["player_ids"]
+	if !ok {
+		playerIdsString = message.Message.Attributes["player_id"]
+	}
+	if code == "" || playerIdsString == "" {
+		return PlayerReportEvent{}, fmt.Errorf("event has no report code or player IDs")
+	}
+
+	playerIds := []int64{}
+	for _, playerIdString := range strings.Split(playerIdsString, ",") {
+		playerId, err := strconv.ParseInt(playerIdString, 10, 64)
+		if err != nil {
+			return PlayerReportEvent{}, fmt.Errorf("player ID conversion failed: %v", err.Error())
+		}
+		playerIds = append(playerIds, playerId)
 	}
 
 	return PlayerReportEvent{
-		Code:     code,
-		PlayerId: playerId,
+		Code:      code,
+		PlayerIds: playerIds,
 	}, nil
 }
 
+// PublishPlayerReportEvents publishes events to update the players of a report, in batches of up to
+// PlayerReportBatchSize players each. Players appearing more than once are only published once.
 func PublishPlayerReportEvents(
 	pubsubClient *google_pubsub.Client,
 	ctx context.Context,
+	causeId string,
 	reportCode string,
 	playerIds []int64,
 ) error {
+	batches := [][]string{}
+	published := map[int64]struct{}{}
+	for _, playerId := range playerIds {
+		if _, ok := published[playerId]; ok {
+			continue
+		}
+		published[playerId] = struct{}{}
+
+		if len(batches) == 0 || len(batches[len(batches)-1]) == PlayerReportBatchSize {
+			batches = append(batches, []string{})
+		}
+		batches[len(batches)-1] = append(batches[len(batches)-1], strconv.FormatInt(playerId, 10))
+	}
+
 	var waitGroup sync.WaitGroup
 	var totalErrors uint64
 	reportTopic := pubsubClient.Topic(playerReportTopicId)
-	for _, playerId := range playerIds {
+	for _, batch := range batches {
 		result := reportTopic.Publish(ctx, &google_pubsub.Message{
-			Attributes: map[string]string{
-				"code":      reportCode,
-				"player_id": strconv.FormatInt(playerId, 10),
-			},
+			Attributes: withEventId(playerReportTopicId, causeId, map[string]string{
+				"code":       reportCode,
+				"player_ids": strings.Join(batch, ","),
+			}),
 		})
 
 		waitGroup.Add(1)
@@ -23,15 +23,20 @@ func ParseReportEvent(e event.Event) (string, error) {
 	return message.Message.Attributes["code"], nil
 }
 
-func PublishReportEvents(pubsubClient *google_pubsub.Client, ctx context.Context, reports []string) error {
+func PublishReportEvents(
+	pubsubClient *google_pubsub.Client,
+	ctx context.Context,
+	causeId string,
+	reports []string,
+) error {
 	var waitGroup sync.WaitGroup
 	var totalErrors uint64
 	reportTopic := pubsubClient.Topic(reportTopicId)
 	for _, code := range reports {
 		result := reportTopic.Publish(ctx, &google_pubsub.Message{
-			Attributes: map[string]string{
+			Attributes: withEventId(reportTopicId, causeId, map[string]string{
 				"code": code,
-			},
+			}),
 		})
 
 		waitGroup.Add(1)
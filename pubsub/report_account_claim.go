@@ -47,6 +47,7 @@ func ParseReportAccountClaimEvent(e event.Event) (ReportAccountClaimEvent, error
 func PublishReportAccountClaimEvents(
 	pubsubClient *google_pubsub.Client,
 	ctx context.Context,
+	causeId string,
 	claimedPlayerId int64,
 	claimedAccountName string,
 	reportCodes []string,
@@ -58,11 +59,11 @@ func PublishReportAccountClaimEvents(
 	reportTopic := pubsubClient.Topic(reportAccountClaimTopicId)
 	for _, reportCode := range reportCodes {
 		result := reportTopic.Publish(ctx, &google_pubsub.Message{
-			Attributes: map[string]string{
+			Attributes: withEventId(reportAccountClaimTopicId, causeId, map[string]string{
 				"report_code":          reportCode,
 				"claimed_player_id":    claimedPlayerIdString,
 				"claimed_account_name": claimedAccountName,
-			},
+			}),
 		})
 
 		waitGroup.Add(1)
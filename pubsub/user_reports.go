@@ -31,15 +31,16 @@ func ParseUserReportsEvent(e event.Event) (int32, error) {
 func PublishUserReportsEvent(
 	pubsubClient *google_pubsub.Client,
 	ctx context.Context,
+	causeId string,
 	userId int32,
 ) error {
 	var waitGroup sync.WaitGroup
 	var totalErrors uint64
 	reportTopic := pubsubClient.Topic(userReportsTopicId)
 	result := reportTopic.Publish(ctx, &google_pubsub.Message{
-		Attributes: map[string]string{
+		Attributes: withEventId(userReportsTopicId, causeId, map[string]string{
 			"user_id": strconv.FormatInt(int64(userId), 10),
-		},
+		}),
 	})
 
 	waitGroup.Add(1)
@@ -0,0 +1,89 @@
+package pubsub
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	google_pubsub "cloud.google.com/go/pubsub"
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+const (
+	webhookDeliveryTopicId = "webhookdelivery"
+)
+
+// WebhookDeliveryEvent asks for a webhook event to be delivered to a single subscription. The event itself is carried
+// as the JSON message data, since it may not fit into an attribute.
+type WebhookDeliveryEvent struct {
+	SubscriptionId int64
+	Payload        []byte
+}
+
+func ParseWebhookDeliveryEvent(e event.Event) (WebhookDeliveryEvent, error) {
+	var message MessagePublishedData
+	if err := e.DataAs(&message); err != nil {
+		return WebhookDeliveryEvent{}, fmt.Errorf("failed to parse event message data: %v", err)
+	}
+
+	subscriptionId, err := strconv.ParseInt(message.Message.Attributes["subscription_id"], 10, 64)
+	if err != nil {
+		return WebhookDeliveryEvent{}, fmt.Errorf("subscription ID conversion failed: %v", err.Error())
+	}
+
+	return WebhookDeliveryEvent{
+		SubscriptionId: subscriptionId,
+		Payload:        message.Message.Data,
+	}, nil
+}
+
+// PublishWebhookDeliveryEvents publishes one delivery of the same payload per subscription, so that every
+// subscription is retried on its own and slow webhooks don't hold up the event handler firing them.
+func PublishWebhookDeliveryEvents(
+	pubsubClient *google_pubsub.Client,
+	ctx context.Context,
+	causeId string,
+	subscriptionIds []int64,
+	payload []byte,
+) error {
+	// The payload is part of the event ID, so that different events for the same subscription and cause don't collide.
+	payloadHash := sha256.Sum256(payload)
+
+	var waitGroup sync.WaitGroup
+	var totalErrors uint64
+	webhookDeliveryTopic := pubsubClient.Topic(webhookDeliveryTopicId)
+	for _, subscriptionId := range subscriptionIds {
+		result := webhookDeliveryTopic.Publish(ctx, &google_pubsub.Message{
+			Data: payload,
+			Attributes: withEventId(webhookDeliveryTopicId, causeId, map[string]string{
+				"subscription_id": strconv.FormatInt(subscriptionId, 10),
+				"payload_sha256":  hex.EncodeToString(payloadHash[:]),
+			}),
+		})
+
+		waitGroup.Add(1)
+		go func(res *google_pubsub.PublishResult) {
+			defer waitGroup.Done()
+			// The Get method blocks until a server-generated ID or
+			// an error is returned for the published message.
+			_, err := res.Get(ctx)
+			if err != nil {
+				log.Printf("Failed to publish: %v", err)
+				atomic.AddUint64(&totalErrors, 1)
+				return
+			}
+		}(result)
+	}
+	waitGroup.Wait()
+
+	if totalErrors > 0 {
+		return fmt.Errorf("%d pubsub writes failed", totalErrors)
+	}
+
+	return nil
+}
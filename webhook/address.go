@@ -0,0 +1,74 @@
+package webhook
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+var privateNetworks = mustParseNetworks(
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"100.64.0.0/10",
+	"fc00::/7",
+)
+
+// CheckUrl returns an error unless the URL is an https URL that could point to a public host. Hosts given by name are
+// resolved at delivery time and checked again there by checkDialAddress.
+func CheckUrl(rawUrl string) error {
+	parsedUrl, err := url.Parse(rawUrl)
+	if err != nil || parsedUrl.Scheme != "https" || parsedUrl.Hostname() == "" {
+		return fmt.Errorf("URL %v is not a valid https URL", rawUrl)
+	}
+
+	host := strings.ToLower(parsedUrl.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || strings.HasSuffix(host, ".internal") {
+		return fmt.Errorf("URL %v doesn't point to a public host", rawUrl)
+	}
+	if ip := net.ParseIP(host); ip != nil && !isPublicIp(ip) {
+		return fmt.Errorf("URL %v doesn't point to a public host", rawUrl)
+	}
+	return nil
+}
+
+// checkDialAddress is used as the Control function of the delivery dialer, so that webhooks can't be pointed at the
+// metadata server or other internal addresses through DNS names resolving to them.
+func checkDialAddress(network string, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIp(ip) {
+		return fmt.Errorf("refusing to deliver to non-public address %v", address)
+	}
+	return nil
+}
+
+func isPublicIp(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() ||
+		ip.IsUnspecified() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func mustParseNetworks(cidrs ...string) []*net.IPNet {
+	networks := []*net.IPNet{}
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
@@ -0,0 +1,87 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/FabianHahn/raidlogscan/datastore"
+)
+
+const (
+	SignatureHeader = "X-Raidlogscan-Signature"
+	TimestampHeader = "X-Raidlogscan-Timestamp"
+
+	deliveryTimeout = 10 * time.Second
+)
+
+var deliveryClient = &http.Client{
+	Timeout: deliveryTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: deliveryTimeout,
+			Control: checkDialAddress,
+		}).DialContext,
+		TLSHandshakeTimeout: deliveryTimeout,
+	},
+	CheckRedirect: func(request *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// Deliver makes a single attempt to post an event to a subscription, and returns whether a failure is worth retrying:
+// network errors, rate limiting and server errors are, other responses aren't. The payload is signed with the
+// subscription's secret as an HMAC-SHA256 over the timestamp header, a dot and the body, so that receivers can verify
+// it and reject replays.
+func Deliver(ctx context.Context, subscription datastore.WebhookSubscription, event Event) (bool, error) {
+	body, err := FormatPayload(subscription.Format, event)
+	if err != nil {
+		return false, err
+	}
+
+	retry, err := deliverOnce(ctx, subscription, body)
+	if err != nil {
+		return retry, fmt.Errorf("webhook delivery to %v failed: %v", subscription.Url, err)
+	}
+	return false, nil
+}
+
+// deliverOnce posts a formatted payload and returns whether a failure is worth retrying.
+func deliverOnce(ctx context.Context, subscription datastore.WebhookSubscription, body []byte) (bool, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.Url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(TimestampHeader, timestamp)
+	request.Header.Set(SignatureHeader, "sha256="+Sign(subscription.Secret, timestamp, body))
+
+	response, err := deliveryClient.Do(request)
+	if err != nil {
+		return true, err
+	}
+	response.Body.Close()
+
+	if response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500 {
+		return true, fmt.Errorf("status %v", response.Status)
+	}
+	if response.StatusCode >= 300 {
+		return false, fmt.Errorf("status %v", response.Status)
+	}
+	return false, nil
+}
+
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,71 @@
+package webhook
+
+import (
+	"time"
+
+	"github.com/FabianHahn/raidlogscan/datastore"
+)
+
+const (
+	EventNewReport         = "new_report"
+	EventCoraiderMilestone = "coraider_milestone"
+	EventNewGuildRaider    = "new_guild_raider"
+
+	// Events about raids older than this are not delivered, so that scanning old reports doesn't flood subscribers.
+	maxEventAge = 7 * 24 * time.Hour
+)
+
+// Milestones are the numbers of raids together at which coraider milestone events are fired.
+var Milestones = []int64{10, 25, 50, 100, 250, 500, 1000}
+
+var EventTypes = []string{EventNewReport, EventCoraiderMilestone, EventNewGuildRaider}
+
+type Event struct {
+	Type        string    `json:"type"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Url         string    `json:"url,omitempty"`
+	Time        time.Time `json:"time"`
+	ReportCode  string    `json:"report_code,omitempty"`
+	GuildId     int32     `json:"guild_id,omitempty"`
+	GuildName   string    `json:"guild_name,omitempty"`
+	AccountName string    `json:"account_name,omitempty"`
+	PlayerId    int64     `json:"player_id,omitempty"`
+	Count       int64     `json:"count,omitempty"`
+}
+
+func IsMilestone(count int64) bool {
+	for _, milestone := range Milestones {
+		if count == milestone {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRecent returns whether a raid started recently enough for events about it to be delivered.
+func IsRecent(startTime time.Time) bool {
+	return time.Since(startTime) < maxEventAge
+}
+
+// Matches returns whether an event passes all filters of a subscription.
+func Matches(subscription datastore.WebhookSubscription, event Event) bool {
+	if subscription.GuildId != 0 && subscription.GuildId != event.GuildId {
+		return false
+	}
+	if subscription.AccountName != "" && subscription.AccountName != event.AccountName {
+		return false
+	}
+	if subscription.PlayerId != 0 && subscription.PlayerId != event.PlayerId {
+		return false
+	}
+	if event.Type == EventCoraiderMilestone && len(subscription.Milestones) > 0 {
+		for _, milestone := range subscription.Milestones {
+			if milestone == event.Count {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,43 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/FabianHahn/raidlogscan/discord"
+)
+
+const (
+	FormatDiscord = "discord"
+	FormatJson    = "json"
+
+	discordUsername = "WoW Raid Stats"
+)
+
+type discordPayload struct {
+	Username string          `json:"username"`
+	Embeds   []discord.Embed `json:"embeds"`
+}
+
+// FormatPayload serializes an event for delivery, either as a Discord webhook message or as plain JSON.
+func FormatPayload(format string, event Event) ([]byte, error) {
+	switch format {
+	case FormatDiscord:
+		return json.Marshal(discordPayload{
+			Username: discordUsername,
+			Embeds: []discord.Embed{
+				{
+					Title:       event.Title,
+					Description: event.Description,
+					Url:         event.Url,
+					Timestamp:   event.Time.Format(time.RFC3339),
+					Color:       discord.EmbedColor,
+				},
+			},
+		})
+	case FormatJson:
+		return json.Marshal(event)
+	}
+	return nil, fmt.Errorf("unknown webhook format %v", format)
+}
@@ -0,0 +1,58 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	google_datastore "cloud.google.com/go/datastore"
+	google_pubsub "cloud.google.com/go/pubsub"
+	"github.com/FabianHahn/raidlogscan/datastore"
+	"github.com/FabianHahn/raidlogscan/pubsub"
+	"google.golang.org/api/iterator"
+)
+
+// Notify publishes a delivery of an event to every subscription matching it. The deliveries themselves happen in the
+// DeliverWebhook event handler, so that slow or broken webhooks can't hold up or fail the event handler firing them.
+func Notify(
+	ctx context.Context,
+	datastoreClient *google_datastore.Client,
+	pubsubClient *google_pubsub.Client,
+	causeId string,
+	event Event,
+) error {
+	query := google_datastore.NewQuery("webhook_subscription").FilterField("EventTypes", "=", event.Type)
+	responseIter := datastoreClient.Run(ctx, query)
+	subscriptionIds := []int64{}
+	for {
+		var subscription datastore.WebhookSubscription
+		key, err := responseIter.Next(&subscription)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("datastore webhook subscription query failed: %v", err)
+		}
+
+		if Matches(subscription, event) {
+			subscriptionIds = append(subscriptionIds, key.ID)
+		}
+	}
+	if len(subscriptionIds) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode %v event: %v", event.Type, err)
+	}
+
+	err = pubsub.PublishWebhookDeliveryEvents(pubsubClient, ctx, causeId, subscriptionIds, payload)
+	if err != nil {
+		return fmt.Errorf("failed to publish %v event deliveries: %v", event.Type, err)
+	}
+
+	log.Printf("Published %v event to %v webhook subscriptions.\n", event.Type, len(subscriptionIds))
+	return nil
+}